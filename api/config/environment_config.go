@@ -23,6 +23,7 @@ func (c EnvironmentConfig) ConfigToString() string {
 	sb.WriteString("  Services:\n")
 	for _, service := range c.Services {
 		sb.WriteString(fmt.Sprintln("    Name: ", service.Name))
+		sb.WriteString(fmt.Sprintln("    Type: ", service.Type))
 		sb.WriteString(fmt.Sprintln("    QueryInterval: ", service.QueryInterval))
 		sb.WriteString("    Database:\n")
 		sb.WriteString(fmt.Sprintln("      User: ", service.Database.User))
@@ -30,9 +31,89 @@ func (c EnvironmentConfig) ConfigToString() string {
 		sb.WriteString(fmt.Sprintln("      Port: ", service.Database.Port))
 		sb.WriteString(fmt.Sprintln("      DBName: ", service.Database.DBName))
 		sb.WriteString(fmt.Sprintln("      ReconnectTimout: ", service.Database.ReconnectTimout))
+		sb.WriteString(fmt.Sprintln("      Timezone: ", service.Database.Timezone))
+		sb.WriteString(fmt.Sprintln("      QueryTimeout: ", service.Database.QueryTimeout))
+		sb.WriteString(fmt.Sprintln("      QueryTimeouts: ", service.Database.QueryTimeouts))
+		sb.WriteString(fmt.Sprintln("      MaxParallelQueries: ", service.Database.MaxParallelQueries))
+		sb.WriteString(fmt.Sprintln("      TickTimeout: ", service.Database.TickTimeout))
+		sb.WriteString("      Push:\n")
+		sb.WriteString(fmt.Sprintln("        Channel: ", service.Database.Push.Channel))
+		sb.WriteString(fmt.Sprintln("        InstallTriggers: ", service.Database.Push.InstallTriggers))
+		sb.WriteString(fmt.Sprintln("        PollInterval: ", service.Database.Push.PollInterval))
+		sb.WriteString(fmt.Sprintln("        Debounce: ", service.Database.Push.Debounce))
+		sb.WriteString("      Binlog:\n")
+		sb.WriteString(fmt.Sprintln("        ServerId: ", service.Database.Binlog.ServerId))
+		sb.WriteString(fmt.Sprintln("        ServerPublicKeyFile: ", service.Database.Binlog.ServerPublicKeyFile))
+		sb.WriteString(fmt.Sprintln("        AllowPublicKeyRetrieval: ", service.Database.Binlog.AllowPublicKeyRetrieval))
+		sb.WriteString(fmt.Sprintln("        TLS: ", service.Database.Binlog.TLS))
+		sb.WriteString(fmt.Sprintln("        CaFile: ", service.Database.Binlog.CaFile))
 		sb.WriteString("    Websocket:\n")
+		sb.WriteString(fmt.Sprintln("      Address: ", service.Websocket.Address))
+		sb.WriteString(fmt.Sprintln("      Port: ", service.Websocket.Port))
 		sb.WriteString(fmt.Sprintln("      EndpointPath: ", service.Websocket.EndpointPath))
+		sb.WriteString(fmt.Sprintln("      SSEPath: ", service.Websocket.SSEPath))
 		sb.WriteString(fmt.Sprintln("      MaxConnections: ", service.Websocket.MaxConnections))
+		sb.WriteString(fmt.Sprintln("      ReplayDuration: ", service.Websocket.ReplayDuration))
+		sb.WriteString(fmt.Sprintln("      MaxQueuedFrames: ", service.Websocket.MaxQueuedFrames))
+		sb.WriteString(fmt.Sprintln("      WriteTimeout: ", service.Websocket.WriteTimeout))
+		sb.WriteString(fmt.Sprintln("      PingInterval: ", service.Websocket.PingInterval))
+		sb.WriteString(fmt.Sprintln("      PongTimeout: ", service.Websocket.PongTimeout))
+		sb.WriteString(fmt.Sprintln("      IdleTimeout: ", service.Websocket.IdleTimeout))
+		sb.WriteString(fmt.Sprintln("      AllowedOrigins: ", service.Websocket.AllowedOrigins))
+		sb.WriteString(fmt.Sprintln("      MaxConnectionsPerIp: ", service.Websocket.MaxConnectionsPerIp))
+		sb.WriteString(fmt.Sprintln("      UpgradesPerMinute: ", service.Websocket.UpgradesPerMinute))
+		sb.WriteString(fmt.Sprintln("      UpgradeBurst: ", service.Websocket.UpgradeBurst))
+		sb.WriteString(fmt.Sprintln("      TrustedProxies: ", service.Websocket.TrustedProxies))
+		sb.WriteString(fmt.Sprintln("      DrainTimeout: ", service.Websocket.DrainTimeout))
+		sb.WriteString(fmt.Sprintln("      ReconnectDelay: ", service.Websocket.ReconnectDelay))
+		sb.WriteString(fmt.Sprintln("      ReconnectJitter: ", service.Websocket.ReconnectJitter))
+		sb.WriteString("      Compression:\n")
+		sb.WriteString(fmt.Sprintln("        Enabled: ", service.Websocket.Compression.Enabled))
+		sb.WriteString(fmt.Sprintln("        Level: ", service.Websocket.Compression.Level))
+		sb.WriteString(fmt.Sprintln("        MinSize: ", service.Websocket.Compression.MinSize))
+		sb.WriteString("      Broker:\n")
+		sb.WriteString(fmt.Sprintln("        Type: ", service.Websocket.Broker.Type))
+		sb.WriteString(fmt.Sprintln("        Address: ", service.Websocket.Broker.Address))
+		sb.WriteString(fmt.Sprintln("        ReconnectInterval: ", service.Websocket.Broker.ReconnectInterval))
+		sb.WriteString("      Auth:\n")
+		for _, key := range service.Websocket.Auth.Keys {
+			// secrets must not end up in the log
+			sb.WriteString(fmt.Sprintln("        Key: ", key.Id))
+		}
+		sb.WriteString("      TLS:\n")
+		sb.WriteString(fmt.Sprintln("        CertFile: ", service.Websocket.TLS.CertFile))
+		sb.WriteString(fmt.Sprintln("        KeyFile: ", service.Websocket.TLS.KeyFile))
+		sb.WriteString(fmt.Sprintln("        MinVersion: ", service.Websocket.TLS.MinVersion))
+		sb.WriteString(fmt.Sprintln("        ClientCAFile: ", service.Websocket.TLS.ClientCAFile))
+		sb.WriteString("    Upstream:\n")
+		sb.WriteString(fmt.Sprintln("      URL: ", service.Upstream.URL))
+		sb.WriteString(fmt.Sprintln("      ReconnectInterval: ", service.Upstream.ReconnectInterval))
+		sb.WriteString(fmt.Sprintln("      IdleTimeout: ", service.Upstream.IdleTimeout))
+		sb.WriteString("    Watermark:\n")
+		sb.WriteString(fmt.Sprintln("      File: ", service.Watermark.File))
+		sb.WriteString(fmt.Sprintln("      Lookback: ", service.Watermark.Lookback))
+		sb.WriteString(fmt.Sprintln("      MaxCatchUp: ", service.Watermark.MaxCatchUp))
+		if len(service.Sql.Driver) > 0 {
+			sb.WriteString("    Sql:\n")
+			sb.WriteString(fmt.Sprintln("      Driver: ", service.Sql.Driver))
+			sb.WriteString(fmt.Sprintln("      Query: ", service.Sql.Query))
+			sb.WriteString(fmt.Sprintln("      Columns: ", service.Sql.Columns))
+			sb.WriteString(fmt.Sprintln("      Kind: ", service.Sql.Kind))
+		}
+		sb.WriteString("    Keeper:\n")
+		sb.WriteString(fmt.Sprintln("      FileDeletions: ", service.Keeper.FileDeletions))
+		sb.WriteString(fmt.Sprintln("      Renames: ", service.Keeper.Renames))
+		sb.WriteString(fmt.Sprintln("      Shares: ", service.Keeper.Shares))
+		sb.WriteString(fmt.Sprintln("      FileDownloads: ", service.Keeper.FileDownloads))
+		sb.WriteString(fmt.Sprintln("      FileSizes: ", service.Keeper.FileSizes))
+		if len(service.Webhook.Path) > 0 {
+			sb.WriteString("    Webhook:\n")
+			sb.WriteString(fmt.Sprintln("      Path: ", service.Webhook.Path))
+			sb.WriteString(fmt.Sprintln("      Tokens: ", len(service.Webhook.Tokens)))
+			sb.WriteString(fmt.Sprintln("      Kind: ", service.Webhook.Kind))
+			sb.WriteString(fmt.Sprintln("      MaxBodySize: ", service.Webhook.MaxBodySize))
+			sb.WriteString(fmt.Sprintln("      MaxEvents: ", service.Webhook.MaxEvents))
+		}
 		sb.WriteString("    ----------\n")
 	}
 	sb.WriteString("  Institutes data:\n")
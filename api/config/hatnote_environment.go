@@ -4,9 +4,12 @@ import (
 	"api/geo"
 	"api/institutes"
 	"api/service"
-	"api/service/bloxberg"
-	"api/service/keeper"
-	"api/service/minerva"
+	_ "api/service/bloxberg"
+	_ "api/service/keeper"
+	_ "api/service/minerva"
+	"api/service/relay"
+	_ "api/service/sqlsource"
+	"api/service/webhook"
 	"api/utils/log"
 	"api/websocket"
 	"errors"
@@ -39,15 +42,85 @@ func LoadEnvironment(envName string, appEnvironmentFileDir string) (environment
 
 	// Check for breaking values
 	// You have to work with indices here, otherwise you only modify a copy of an array item
-	for i, service := range appConfig.Services {
-		if (service.Name == "minerva" || service.Name == "bloxberg") && appConfig.Services[i].QueryInterval < 1000 {
-			appConfig.Services[i].QueryInterval = 1000
-		} else if service.Name == "keeper" && appConfig.Services[i].QueryInterval < 1 {
-			appConfig.Services[i].QueryInterval = 1
+	for i := range appConfig.Services {
+		if minInterval := service.MinQueryInterval(appConfig.Services[i].SourceName()); appConfig.Services[i].QueryInterval < minInterval {
+			appConfig.Services[i].QueryInterval = minInterval
 		}
 		if appConfig.Services[i].Websocket.MaxConnections <= 0 {
 			appConfig.Services[i].Websocket.MaxConnections = 1
 		}
+		if appConfig.Services[i].Websocket.Port <= 0 {
+			appConfig.Services[i].Websocket.Port = 8080
+		}
+		if appConfig.Services[i].Websocket.MaxQueuedFrames <= 0 {
+			appConfig.Services[i].Websocket.MaxQueuedFrames = 16
+		}
+		if appConfig.Services[i].Websocket.WriteTimeout <= 0 {
+			appConfig.Services[i].Websocket.WriteTimeout = 10000
+		}
+		if appConfig.Services[i].Websocket.PingInterval <= 0 {
+			appConfig.Services[i].Websocket.PingInterval = 30000
+		}
+		if appConfig.Services[i].Websocket.PongTimeout <= 0 {
+			appConfig.Services[i].Websocket.PongTimeout = 10000
+		}
+		// the idle timeout has to outlast the ping interval, otherwise healthy clients are dropped between pings
+		if appConfig.Services[i].Websocket.IdleTimeout <= appConfig.Services[i].Websocket.PingInterval {
+			appConfig.Services[i].Websocket.IdleTimeout = appConfig.Services[i].Websocket.PingInterval + appConfig.Services[i].Websocket.PongTimeout
+		}
+		if appConfig.Services[i].Websocket.DrainTimeout <= 0 {
+			appConfig.Services[i].Websocket.DrainTimeout = 5000
+		}
+		if appConfig.Services[i].Websocket.ReconnectDelay < 0 {
+			appConfig.Services[i].Websocket.ReconnectDelay = 0
+		}
+		if appConfig.Services[i].Websocket.ReconnectJitter < 0 {
+			appConfig.Services[i].Websocket.ReconnectJitter = 0
+		}
+		if appConfig.Services[i].Websocket.Broker.ReconnectInterval <= 0 {
+			appConfig.Services[i].Websocket.Broker.ReconnectInterval = 5000
+		}
+		if appConfig.Services[i].Upstream.ReconnectInterval <= 0 {
+			appConfig.Services[i].Upstream.ReconnectInterval = 5000
+		}
+		if appConfig.Services[i].Upstream.IdleTimeout <= 0 {
+			appConfig.Services[i].Upstream.IdleTimeout = 90000
+		}
+		if appConfig.Services[i].Database.QueryTimeout <= 0 {
+			appConfig.Services[i].Database.QueryTimeout = 30000
+		}
+		if appConfig.Services[i].Database.MaxParallelQueries <= 0 {
+			appConfig.Services[i].Database.MaxParallelQueries = 3
+		}
+		if appConfig.Services[i].Database.TickTimeout < 0 {
+			appConfig.Services[i].Database.TickTimeout = 0
+		}
+		if appConfig.Services[i].Database.Push.PollInterval <= 0 {
+			appConfig.Services[i].Database.Push.PollInterval = 30000
+		}
+		if appConfig.Services[i].Database.Push.Debounce < 0 {
+			appConfig.Services[i].Database.Push.Debounce = 0
+		}
+		if _, timezoneErr := appConfig.Services[i].Database.Location(); timezoneErr != nil {
+			log.Error("Unknown database timezone. Using UTC.", timezoneErr, log.Config)
+			appConfig.Services[i].Database.Timezone = ""
+		}
+		if appConfig.Services[i].Watermark.Lookback < 0 {
+			appConfig.Services[i].Watermark.Lookback = 0
+		}
+		// a frame catches up on at most 60 query intervals, but on a minute at least, e.g. for second intervals
+		if appConfig.Services[i].Watermark.MaxCatchUp <= 0 {
+			appConfig.Services[i].Watermark.MaxCatchUp = 60 * service.QueryInterval(appConfig.Services[i]).Milliseconds()
+			if appConfig.Services[i].Watermark.MaxCatchUp < 60000 {
+				appConfig.Services[i].Watermark.MaxCatchUp = 60000
+			}
+		}
+		if appConfig.Services[i].Webhook.MaxBodySize <= 0 {
+			appConfig.Services[i].Webhook.MaxBodySize = 1048576
+		}
+		if appConfig.Services[i].Webhook.MaxEvents <= 0 {
+			appConfig.Services[i].Webhook.MaxEvents = 10000
+		}
 	}
 
 	switch envName {
@@ -59,6 +132,8 @@ func LoadEnvironment(envName string, appEnvironmentFileDir string) (environment
 		dependencies = hatnoteMockDbDependencies(appConfig.Services)
 	case "mock-db-ws":
 		dependencies = hatnoteMockWsDbDependencies(appConfig.Services)
+	case "relay":
+		dependencies = hatnoteRelayDependencies(appConfig.Services)
 	default:
 		err = errors.New("environment not known")
 		log.Error("Error while loading environment: ", err, log.Config)
@@ -96,31 +171,56 @@ func loadConfigFromFile(fileName string) (config EnvironmentConfig, loadError er
 }
 
 func hatnoteDependencies(services []service.ServiceConfig) *Dependencies {
+	dependencies := &Dependencies{
+		InstitutesDataController: institutes.Controller{},
+		GeoController:            geo.Controller{},
+	}
+
+	for _, serviceItem := range services {
+		// every service serves its own endpoint with its own connections
+		var websocketController websocket.WebsocketInterface = new(websocket.Websocket)
+		serviceController, err := newService(serviceItem, websocketController, false)
+		if err != nil {
+			log.Error("Skipping service of the environment.", err, log.Config)
+			continue
+		}
+		dependencies.HatnoteServiceController = append(dependencies.HatnoteServiceController, serviceController)
+	}
+
+	return dependencies
+}
+
+// newService creates a webhook service for services of type webhook, which receive their events instead of querying a
+// database, and a poller for the registered sources
+func newService(config service.ServiceConfig, websocketController websocket.WebsocketInterface, mockDatabase bool) (service.ServiceInterface, error) {
+	if config.SourceName() == "webhook" {
+		webhookService, err := webhook.NewService(config, websocketController)
+		if err != nil {
+			return nil, err
+		}
+		return webhookService, nil
+	}
+	poller, err := service.NewPoller(config, websocketController, mockDatabase)
+	if err != nil {
+		return nil, err
+	}
+	return poller, nil
+}
+
+// services that take their frames from an upstream hatnote api instead of a database
+func hatnoteRelayDependencies(services []service.ServiceConfig) *Dependencies {
 	dependencies := &Dependencies{
 		InstitutesDataController: institutes.Controller{},
 		GeoController:            geo.Controller{},
 		HatnoteServiceController: make([]service.ServiceInterface, len(services)),
 	}
 
-	var websocketController websocket.WebsocketInterface = new(websocket.Websocket)
 	for i, serviceItem := range services {
-		switch serviceItem.Name {
-		case "minerva":
-			var mmDatabaseController minerva.DatabaseInterface = &minerva.Database{Config: serviceItem.Database}
-			var mmServiceController service.ServiceInterface = &minerva.Service{
-				DatabaseController: mmDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = mmServiceController
-		case "keeper":
-			var keeperDatabaseController keeper.DatabaseInterface = &keeper.Database{Config: serviceItem.Database}
-			var keeperServiceController service.ServiceInterface = &keeper.Service{
-				DatabaseController: keeperDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = keeperServiceController
-		case "bloxberg":
-			var bloxbergDatabaseController bloxberg.DatabaseInterface = &bloxberg.Database{Config: serviceItem.Database}
-			var bloxbergServiceController service.ServiceInterface = &bloxberg.Service{
-				DatabaseController: bloxbergDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = bloxbergServiceController
-		}
+		// every service serves its own endpoint with its own connections
+		var websocketController websocket.WebsocketInterface = new(websocket.Websocket)
+		var relayServiceController service.ServiceInterface = &relay.Service{
+			WebsocketController: websocketController, Config: serviceItem}
+		dependencies.HatnoteServiceController[i] = relayServiceController
 	}
 
 	return dependencies
@@ -131,28 +231,17 @@ func hatnoteMockDbDependencies(services []service.ServiceConfig) *Dependencies {
 	dependencies := &Dependencies{
 		InstitutesDataController: institutes.Controller{},
 		GeoController:            geo.Controller{},
-		HatnoteServiceController: make([]service.ServiceInterface, len(services)),
 	}
 
-	var websocketController websocket.WebsocketInterface = new(websocket.Websocket)
-	for i, serviceItem := range services {
-		switch serviceItem.Name {
-		case "minerva":
-			var mmDatabaseController minerva.DatabaseInterface = &minerva.DatabaseMock{Config: serviceItem}
-			var mmServiceController service.ServiceInterface = &minerva.Service{
-				DatabaseController: mmDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = mmServiceController
-		case "keeper":
-			var keeperDatabaseController keeper.DatabaseInterface = &keeper.DatabaseMock{Config: serviceItem}
-			var keeperServiceController service.ServiceInterface = &keeper.Service{
-				DatabaseController: keeperDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = keeperServiceController
-		case "bloxberg":
-			var bloxbergDatabaseController bloxberg.DatabaseInterface = &bloxberg.DatabaseMock{Config: serviceItem}
-			var bloxbergServiceController service.ServiceInterface = &bloxberg.Service{
-				DatabaseController: bloxbergDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = bloxbergServiceController
+	for _, serviceItem := range services {
+		// every service serves its own endpoint with its own connections
+		var websocketController websocket.WebsocketInterface = new(websocket.Websocket)
+		serviceController, err := newService(serviceItem, websocketController, true)
+		if err != nil {
+			log.Error("Skipping service of the environment.", err, log.Config)
+			continue
 		}
+		dependencies.HatnoteServiceController = append(dependencies.HatnoteServiceController, serviceController)
 	}
 
 	return dependencies
@@ -163,28 +252,16 @@ func hatnoteMockWsDbDependencies(services []service.ServiceConfig) *Dependencies
 	dependencies := &Dependencies{
 		InstitutesDataController: institutes.Controller{},
 		GeoController:            geo.Controller{},
-		HatnoteServiceController: make([]service.ServiceInterface, len(services)),
 	}
 
-	var websocketController websocket.WebsocketInterface = new(websocket.WebsocketMock)
-	for i, serviceItem := range services {
-		switch serviceItem.Name {
-		case "minerva":
-			var mmDatabaseController minerva.DatabaseInterface = &minerva.DatabaseMock{}
-			var mmServiceController service.ServiceInterface = &minerva.Service{
-				DatabaseController: mmDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = mmServiceController
-		case "keeper":
-			var keeperDatabaseController keeper.DatabaseInterface = &keeper.DatabaseMock{}
-			var keeperServiceController service.ServiceInterface = &keeper.Service{
-				DatabaseController: keeperDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = keeperServiceController
-		case "bloxberg":
-			var bloxbergDatabaseController bloxberg.DatabaseInterface = &bloxberg.DatabaseMock{Config: serviceItem}
-			var bloxbergServiceController service.ServiceInterface = &bloxberg.Service{
-				DatabaseController: bloxbergDatabaseController, WebsocketController: websocketController, Config: serviceItem}
-			dependencies.HatnoteServiceController[i] = bloxbergServiceController
+	for _, serviceItem := range services {
+		var websocketController websocket.WebsocketInterface = new(websocket.WebsocketMock)
+		serviceController, err := newService(serviceItem, websocketController, true)
+		if err != nil {
+			log.Error("Skipping service of the environment.", err, log.Config)
+			continue
 		}
+		dependencies.HatnoteServiceController = append(dependencies.HatnoteServiceController, serviceController)
 	}
 
 	return dependencies
@@ -0,0 +1,317 @@
+package binlog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+)
+
+const (
+	comQuery      = 0x03
+	comBinlogDump = 0x12
+
+	okPacket   = 0x00
+	eofPacket  = 0xfe
+	errPacket  = 0xff
+	authSwitch = 0xfe
+	authMore   = 0x01
+
+	clientLongPassword     = 0x1
+	clientLongFlag         = 0x4
+	clientProtocol41       = 0x200
+	clientSSL              = 0x800
+	clientTransactions     = 0x2000
+	clientSecureConnection = 0x8000
+	clientPluginAuth       = 0x80000
+
+	charsetUtf8mb4 = 45
+
+	nativePasswordPlugin      = "mysql_native_password"
+	cachingSha2PasswordPlugin = "caching_sha2_password"
+)
+
+var errPublicKeyRequired = errors.New("server has not cached the password of the replica user, sending it needs the " +
+	"public key of the server, configure it or allow retrieving it from the server")
+
+// handshake authenticates the connection, see
+// https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_connection_phase.html. With a tls config the
+// connection is encrypted before the credentials are sent.
+func (c *conn) handshake(r Replica) error {
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if len(packet) > 0 && packet[0] == errPacket {
+		return parseServerError(packet)
+	}
+
+	d := decoder{data: packet}
+	if version := d.uint(1); version != 10 {
+		return fmt.Errorf("unsupported protocol version %d", version)
+	}
+	d.nulString() // server version
+	d.uint(4)     // connection id
+	scramble := append([]byte{}, d.bytes(8)...)
+	d.uint(1) // filler
+	capabilities := d.uint(2)
+	plugin := nativePasswordPlugin
+	if d.remaining() > 0 {
+		d.uint(1) // character set
+		d.uint(2) // status
+		capabilities |= d.uint(2) << 16
+		scrambleLength := int(d.uint(1))
+		d.bytes(10) // reserved
+		if capabilities&clientSecureConnection != 0 {
+			length := scrambleLength - 8
+			if length < 13 {
+				length = 13
+			}
+			// the second part is NUL terminated
+			part := d.bytes(length)
+			if len(part) > 0 {
+				scramble = append(scramble, part[:len(part)-1]...)
+			}
+		}
+		if capabilities&clientPluginAuth != 0 {
+			plugin = d.nulString()
+		}
+	}
+	if d.err != nil {
+		return d.err
+	}
+	if capabilities&clientProtocol41 == 0 || capabilities&clientSecureConnection == 0 {
+		return errors.New("server does not support the 4.1 protocol")
+	}
+
+	flags := uint32(clientLongPassword | clientLongFlag | clientProtocol41 | clientTransactions | clientSecureConnection | clientPluginAuth)
+	if r.TLS != nil {
+		if capabilities&clientSSL == 0 {
+			return errors.New("server does not support tls")
+		}
+		flags |= clientSSL
+		if err = c.startTLS(r.TLS, flags); err != nil {
+			return err
+		}
+	}
+
+	authResponse, err := scramblePassword(plugin, r.Password, scramble)
+	if err != nil {
+		return err
+	}
+	response := handshakeResponse(flags)
+	response = append(append(response, r.User...), 0)
+	response = append(append(response, byte(len(authResponse))), authResponse...)
+	response = append(append(response, plugin...), 0)
+	if err = c.writePacket(response); err != nil {
+		return err
+	}
+	return c.authResult(r, plugin, scramble)
+}
+
+// handshakeResponse starts the handshake response and the ssl request, which is the handshake response up to the user
+func handshakeResponse(flags uint32) []byte {
+	response := binary.LittleEndian.AppendUint32(nil, flags)
+	response = binary.LittleEndian.AppendUint32(response, maxPacketSize)
+	response = append(response, charsetUtf8mb4)
+	return append(response, make([]byte, 23)...)
+}
+
+// startTLS sends the ssl request and continues the handshake encrypted
+func (c *conn) startTLS(config *tls.Config, flags uint32) error {
+	if err := c.writePacket(handshakeResponse(flags)); err != nil {
+		return err
+	}
+	tlsConn := tls.Client(c.netConn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.netConn = tlsConn
+	c.reader = bufio.NewReader(tlsConn)
+	c.secure = true
+	return nil
+}
+
+func (c *conn) authResult(r Replica, plugin string, scramble []byte) error {
+	for {
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(packet) == 0 {
+			return errMalformedPacket
+		}
+
+		switch packet[0] {
+		case okPacket:
+			return nil
+		case errPacket:
+			return parseServerError(packet)
+		case authSwitch:
+			d := decoder{data: packet[1:]}
+			plugin = d.nulString()
+			scramble = d.rest()
+			if len(scramble) > 0 && scramble[len(scramble)-1] == 0 {
+				scramble = scramble[:len(scramble)-1]
+			}
+			authResponse, err := scramblePassword(plugin, r.Password, scramble)
+			if err != nil {
+				return err
+			}
+			if err = c.writePacket(authResponse); err != nil {
+				return err
+			}
+		case authMore:
+			if plugin != cachingSha2PasswordPlugin || len(packet) < 2 {
+				return fmt.Errorf("unexpected auth data for %s", plugin)
+			}
+			switch packet[1] {
+			case 3:
+				// fast auth succeeded, the ok packet follows
+			case 4:
+				if err = c.fullAuth(r, scramble); err != nil {
+					return err
+				}
+			default:
+				return fmt.Errorf("unexpected caching_sha2_password state %d", packet[1])
+			}
+		default:
+			return fmt.Errorf("unexpected auth packet 0x%02x", packet[0])
+		}
+	}
+}
+
+// fullAuth sends the password if it is not cached by the server. Over TLS it is sent as it is, otherwise it is encrypted
+// with the public key of the server. Without TLS only a configured key can be trusted: a man in the middle can replace
+// a key requested from the server by its own and decrypt the password, so requesting it has to be allowed explicitly.
+func (c *conn) fullAuth(r Replica, scramble []byte) error {
+	if c.secure {
+		return c.writePacket(append([]byte(r.Password), 0))
+	}
+	publicKey := r.ServerPublicKey
+	if publicKey == nil {
+		if !r.AllowPublicKeyRetrieval {
+			return errPublicKeyRequired
+		}
+		if err := c.writePacket([]byte{2}); err != nil {
+			return err
+		}
+		packet, err := c.readPacket()
+		if err != nil {
+			return err
+		}
+		if len(packet) == 0 || packet[0] != authMore {
+			return errors.New("server did not send its public key")
+		}
+		if publicKey, err = ParsePublicKey(packet[1:]); err != nil {
+			return err
+		}
+	}
+
+	if len(scramble) == 0 {
+		return errors.New("server sent no scramble")
+	}
+	plain := append([]byte(r.Password), 0)
+	for i := range plain {
+		plain[i] ^= scramble[i%len(scramble)]
+	}
+	encrypted, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, publicKey, plain, nil)
+	if err != nil {
+		return err
+	}
+	return c.writePacket(encrypted)
+}
+
+// ParsePublicKey reads the pem encoded rsa public key of a server, e.g. the file of caching_sha2_password_public_key_path
+func ParsePublicKey(encoded []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(encoded)
+	if block == nil {
+		return nil, errors.New("could not decode the public key of the server")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	publicKey, isRsa := key.(*rsa.PublicKey)
+	if !isRsa {
+		return nil, errors.New("public key of the server is no rsa key")
+	}
+	return publicKey, nil
+}
+
+// LoadPublicKey reads the public key of a server from a pem file
+func LoadPublicKey(file string) (*rsa.PublicKey, error) {
+	encoded, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(encoded)
+}
+
+// TLSConfig verifies the certificate of the server against the system roots, or against the certificates of the pem file
+// if one is set
+func TLSConfig(serverName string, caFile string) (*tls.Config, error) {
+	config := &tls.Config{ServerName: serverName, MinVersion: tls.VersionTLS12}
+	if len(caFile) == 0 {
+		return config, nil
+	}
+	encoded, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(encoded) {
+		return nil, fmt.Errorf("no certificate in %s", caFile)
+	}
+	return config, nil
+}
+
+func scramblePassword(plugin string, password string, scramble []byte) ([]byte, error) {
+	if len(password) == 0 {
+		return nil, nil
+	}
+	switch plugin {
+	case nativePasswordPlugin:
+		return nativePassword(password, scramble), nil
+	case cachingSha2PasswordPlugin:
+		return cachingSha2Password(password, scramble), nil
+	default:
+		return nil, fmt.Errorf("unsupported auth plugin %s", plugin)
+	}
+}
+
+// nativePassword is SHA1(password) XOR SHA1(scramble + SHA1(SHA1(password)))
+func nativePassword(password string, scramble []byte) []byte {
+	hash := sha1.Sum([]byte(password))
+	doubleHash := sha1.Sum(hash[:])
+	salted := sha1.New()
+	salted.Write(scramble)
+	salted.Write(doubleHash[:])
+	response := salted.Sum(nil)
+	for i := range response {
+		response[i] ^= hash[i]
+	}
+	return response
+}
+
+// cachingSha2Password is SHA256(password) XOR SHA256(SHA256(SHA256(password)) + scramble)
+func cachingSha2Password(password string, scramble []byte) []byte {
+	hash := sha256.Sum256([]byte(password))
+	doubleHash := sha256.Sum256(hash[:])
+	salted := sha256.New()
+	salted.Write(doubleHash[:])
+	salted.Write(scramble)
+	response := salted.Sum(nil)
+	for i := range response {
+		response[i] ^= hash[i]
+	}
+	return response
+}
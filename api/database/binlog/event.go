@@ -0,0 +1,302 @@
+package binlog
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// event types hatnote reads, see https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_replication_binlog_event.html
+const (
+	rotateEvent            = 4
+	formatDescriptionEvent = 15
+	tableMapEvent          = 19
+	writeRowsEventV1       = 23
+	updateRowsEventV1      = 24
+	deleteRowsEventV1      = 25
+	writeRowsEventV2       = 30
+	updateRowsEventV2      = 31
+	deleteRowsEventV2      = 32
+	partialUpdateRowsEvent = 39
+
+	eventHeaderLength = 19
+	checksumLength    = 4
+	checksumCrc32     = 1
+	ignorableFlag     = 0x80 // replicas that do not know the event may skip it
+)
+
+// skippedEvents are the events that do not contain rows hatnote streams. Every event ends a statement, except for the
+// row events of other changes. Events that are neither read nor skipped are unsupported, e.g. the compressed
+// transactions of binlog_transaction_compression or the compressed row events of MariaDB, a replica that skipped them
+// would lose rows.
+var skippedEvents = map[byte]bool{
+	2:  true, // query, e.g. BEGIN or DDL
+	3:  true, // stop
+	5:  true, // intvar
+	13: true, // rand
+	14: true, // user var
+	16: true, // xid, the commit of a transaction
+	27: true, // heartbeat
+	29: true, // rows query
+	33: true, // gtid
+	34: true, // anonymous gtid
+	35: true, // previous gtids
+	36: true, // transaction context
+	37: true, // view change
+	38: true, // xa prepare
+	41: true, // heartbeat v2
+	42: true, // tagged gtid
+	// MariaDB
+	160: true, // annotate rows
+	161: true, // binlog checkpoint
+	162: true, // gtid
+	163: true, // gtid list
+	164: true, // start encryption, the events are decrypted for replicas
+	165: true, // compressed query
+}
+
+var errChecksum = errors.New("binlog event checksum mismatch")
+
+// ErrUnsupportedEvent ends a stream at an event that may contain rows the parser can not read
+var ErrUnsupportedEvent = errors.New("unsupported binlog event")
+
+type eventHeader struct {
+	eventType byte
+	eventSize uint32
+	logPos    uint32 // position of the next event, 0 for events the server generated for the dump
+}
+
+type tableMap struct {
+	schema      string
+	table       string
+	columnTypes []byte
+	columnMeta  []uint16
+}
+
+// parser keeps the state of a binlog stream. The table ids of the row events refer to the table map events of their
+// statement.
+type parser struct {
+	formatKnown bool
+	checksum    bool
+	tableIdSize int
+	tables      map[uint64]*tableMap
+	watched     map[string]bool // "schema.table", rows of other tables are skipped
+}
+
+func newParser(tables []string) *parser {
+	p := &parser{tableIdSize: 6, tables: make(map[uint64]*tableMap), watched: make(map[string]bool)}
+	for _, table := range tables {
+		p.watched[table] = true
+	}
+	return p
+}
+
+// parse reads one event and moves the position behind it. It returns the inserted rows of row events of watched tables,
+// every other event only changes the state of the parser. Outside of a statement, which is a table map event followed
+// by its row events, the position is a boundary the stream can be resumed from.
+func (p *parser) parse(event []byte, position *Position) (rows []Row, boundary bool, err error) {
+	d := decoder{data: event}
+	d.uint(4) // timestamp
+	header := eventHeader{eventType: byte(d.uint(1))}
+	d.uint(4) // server id
+	header.eventSize = uint32(d.uint(4))
+	header.logPos = uint32(d.uint(4))
+	flags := d.uint(2)
+	if d.err != nil || int(header.eventSize) != len(event) {
+		return nil, false, errMalformedPacket
+	}
+
+	if header.eventType == formatDescriptionEvent {
+		if err = p.parseFormatDescription(event); err != nil {
+			return nil, false, err
+		}
+	} else if p.checksum || (!p.formatKnown && hasValidChecksum(event)) {
+		// before the format description event, e.g. for the rotate event that starts the dump, the checksum is not
+		// known yet and only checked
+		if !hasValidChecksum(event) {
+			return nil, false, errChecksum
+		}
+		event = event[:len(event)-checksumLength]
+	}
+	body := decoder{data: event, pos: eventHeaderLength}
+
+	switch header.eventType {
+	case rotateEvent:
+		offset := body.uint(8)
+		name := string(body.rest())
+		if body.err != nil {
+			return nil, false, body.err
+		}
+		*position = Position{File: name, Offset: uint32(offset)}
+		return nil, true, nil
+	case tableMapEvent:
+		err = p.parseTableMap(&body)
+	case writeRowsEventV1, writeRowsEventV2:
+		rows, err = p.parseWriteRows(&body, header.eventType == writeRowsEventV2)
+	case updateRowsEventV1, deleteRowsEventV1, updateRowsEventV2, deleteRowsEventV2, partialUpdateRowsEvent:
+	default:
+		if !skippedEvents[header.eventType] && header.eventType != formatDescriptionEvent && flags&ignorableFlag == 0 {
+			return nil, false, fmt.Errorf("%w %d at %v:%d", ErrUnsupportedEvent, header.eventType, position.File, position.Offset)
+		}
+		boundary = true
+		// a statement repeats the table map events of its tables
+		if len(p.tables) > 0 {
+			p.tables = make(map[uint64]*tableMap)
+		}
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if header.logPos > 0 {
+		position.Offset = header.logPos
+	}
+	return rows, boundary, nil
+}
+
+func hasValidChecksum(event []byte) bool {
+	if len(event) < eventHeaderLength+checksumLength {
+		return false
+	}
+	data, checksum := event[:len(event)-checksumLength], event[len(event)-checksumLength:]
+	return crc32.ChecksumIEEE(data) == uint32(checksum[0])|uint32(checksum[1])<<8|uint32(checksum[2])<<16|uint32(checksum[3])<<24
+}
+
+func (p *parser) parseFormatDescription(event []byte) error {
+	d := decoder{data: event, pos: eventHeaderLength}
+	d.uint(2) // binlog version
+	serverVersion := strings.TrimRight(string(d.bytes(50)), "\x00")
+	d.uint(4) // created
+	d.uint(1) // event header length
+	postHeaderLengths := d.rest()
+	if d.err != nil {
+		return d.err
+	}
+
+	// servers that support checksums append the algorithm and the checksum of this event
+	p.checksum = false
+	if supportsChecksum(serverVersion) {
+		if len(postHeaderLengths) < 1+checksumLength {
+			return errMalformedPacket
+		}
+		algorithm := postHeaderLengths[len(postHeaderLengths)-checksumLength-1]
+		postHeaderLengths = postHeaderLengths[:len(postHeaderLengths)-checksumLength-1]
+		if algorithm == checksumCrc32 {
+			if !hasValidChecksum(event) {
+				return errChecksum
+			}
+			p.checksum = true
+		}
+	}
+	p.tableIdSize = 6
+	if len(postHeaderLengths) >= tableMapEvent && postHeaderLengths[tableMapEvent-1] == 6 {
+		p.tableIdSize = 4
+	}
+	p.formatKnown = true
+	return nil
+}
+
+// supportsChecksum is true for MySQL 5.6.1 and MariaDB 5.3 and newer
+func supportsChecksum(serverVersion string) bool {
+	minimum := []int{5, 6, 1}
+	if strings.Contains(serverVersion, "MariaDB") {
+		minimum = []int{5, 3, 0}
+	}
+	parts := strings.SplitN(strings.SplitN(serverVersion, "-", 2)[0], ".", 3)
+	for i, part := range parts {
+		number, err := strconv.Atoi(part)
+		if err != nil {
+			return false
+		}
+		if number != minimum[i] {
+			return number > minimum[i]
+		}
+	}
+	return len(parts) == 3
+}
+
+func (p *parser) parseTableMap(d *decoder) error {
+	tableId := d.uint(p.tableIdSize)
+	d.uint(2) // flags
+	table := &tableMap{}
+	table.schema = string(d.bytes(int(d.uint(1))))
+	d.uint(1) // NUL
+	table.table = string(d.bytes(int(d.uint(1))))
+	d.uint(1) // NUL
+	columnCount := int(d.lengthEncodedInt())
+	table.columnTypes = append([]byte{}, d.bytes(columnCount)...)
+	meta := decoder{data: d.bytes(int(d.lengthEncodedInt()))}
+	for _, columnType := range table.columnTypes {
+		table.columnMeta = append(table.columnMeta, readColumnMeta(&meta, columnType))
+	}
+	// the null bitmap and the optional metadata of MySQL 8 follow, they are not needed
+	if d.err != nil || meta.err != nil {
+		return errMalformedPacket
+	}
+	p.tables[tableId] = table
+	return nil
+}
+
+func (p *parser) parseWriteRows(d *decoder, hasExtraData bool) ([]Row, error) {
+	tableId := d.uint(p.tableIdSize)
+	d.uint(2) // flags
+	if hasExtraData {
+		// the length includes its own two bytes
+		d.bytes(int(d.uint(2)) - 2)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	table, exists := p.tables[tableId]
+	if !exists {
+		return nil, fmt.Errorf("rows event of unknown table id %d", tableId)
+	}
+	if !p.watched[table.schema+"."+table.table] {
+		return nil, nil
+	}
+
+	columnCount := int(d.lengthEncodedInt())
+	if columnCount != len(table.columnTypes) {
+		return nil, fmt.Errorf("rows event of %s.%s has %d columns, the table map %d", table.schema, table.table, columnCount, len(table.columnTypes))
+	}
+	present := d.bytes((columnCount + 7) / 8)
+	presentCount := 0
+	for column := 0; column < columnCount; column++ {
+		if isSet(present, column) {
+			presentCount++
+		}
+	}
+
+	var rows []Row
+	for d.err == nil && d.remaining() > 0 {
+		nulls := d.bytes((presentCount + 7) / 8)
+		row := Row{Schema: table.schema, Table: table.table, Values: make([]interface{}, columnCount)}
+		presentIndex := 0
+		for column := 0; column < columnCount; column++ {
+			if !isSet(present, column) {
+				// not logged with binlog_row_image=MINIMAL
+				continue
+			}
+			isNull := isSet(nulls, presentIndex)
+			presentIndex++
+			if isNull {
+				continue
+			}
+			value, err := readValue(d, table.columnTypes[column], table.columnMeta[column])
+			if err != nil {
+				return nil, fmt.Errorf("column %d of %s.%s: %w", column, table.schema, table.table, err)
+			}
+			row.Values[column] = value
+		}
+		rows = append(rows, row)
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return rows, nil
+}
+
+func isSet(bitmap []byte, bit int) bool {
+	return bit/8 < len(bitmap) && bitmap[bit/8]&(1<<(bit%8)) != 0
+}
@@ -0,0 +1,204 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"reflect"
+	"testing"
+)
+
+// within this directory: go test
+
+func buildEvent(eventType byte, logPos uint32, body []byte, checksum bool) []byte {
+	size := eventHeaderLength + len(body)
+	if checksum {
+		size += checksumLength
+	}
+	event := binary.LittleEndian.AppendUint32(nil, 1700000000)
+	event = append(event, eventType)
+	event = binary.LittleEndian.AppendUint32(event, 1)
+	event = binary.LittleEndian.AppendUint32(event, uint32(size))
+	event = binary.LittleEndian.AppendUint32(event, logPos)
+	event = binary.LittleEndian.AppendUint16(event, 0)
+	event = append(event, body...)
+	if checksum {
+		event = binary.LittleEndian.AppendUint32(event, crc32.ChecksumIEEE(event))
+	}
+	return event
+}
+
+func formatDescriptionBody(serverVersion string, checksum bool) []byte {
+	body := binary.LittleEndian.AppendUint16(nil, 4)
+	version := make([]byte, 50)
+	copy(version, serverVersion)
+	body = append(body, version...)
+	body = binary.LittleEndian.AppendUint32(body, 0)
+	body = append(body, eventHeaderLength)
+	postHeaderLengths := make([]byte, 40)
+	postHeaderLengths[tableMapEvent-1] = 8
+	body = append(body, postHeaderLengths...)
+	if checksum {
+		body = append(body, checksumCrc32)
+	} else {
+		body = append(body, 0)
+	}
+	return body
+}
+
+func rotateBody(file string, offset uint64) []byte {
+	return append(binary.LittleEndian.AppendUint64(nil, offset), file...)
+}
+
+// the table has the columns id BIGINT, op_user VARCHAR(255), timestamp DATETIME, detail TEXT, commit_id VARCHAR(40)
+func tableMapBody(tableId uint64, schema string, table string) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, tableId)[:6]
+	body = append(body, 0, 0)
+	body = append(append(append(body, byte(len(schema))), schema...), 0)
+	body = append(append(append(body, byte(len(table))), table...), 0)
+	body = append(body, 5, typeLongLong, typeVarchar, typeDateTime2, typeBlob, typeVarchar)
+	meta := []byte{0xff, 0x00, 0, 2, 40, 0}
+	body = append(append(body, byte(len(meta))), meta...)
+	return append(body, 0x1e)
+}
+
+func writeRowsBody(tableId uint64, rows ...[]byte) []byte {
+	body := binary.LittleEndian.AppendUint64(nil, tableId)[:6]
+	body = append(body, 0, 0, 2, 0, 5, 0x1f)
+	for _, row := range rows {
+		body = append(body, row...)
+	}
+	return body
+}
+
+func activityRow(id uint64, user string, year, month, day, hour, minute, second uint64, detail string, commitId string) []byte {
+	var row []byte
+	if len(commitId) == 0 {
+		row = append(row, 0x10)
+	} else {
+		row = append(row, 0)
+	}
+	row = binary.LittleEndian.AppendUint64(row, id)
+	row = append(append(row, byte(len(user))), user...)
+	date := (year*13+month)<<5 | day
+	clock := hour<<12 | minute<<6 | second
+	packed := binary.BigEndian.AppendUint64(nil, (date<<17|clock)+0x8000000000)
+	row = append(row, packed[3:]...)
+	row = append(binary.LittleEndian.AppendUint16(row, uint16(len(detail))), detail...)
+	if len(commitId) > 0 {
+		row = append(append(row, byte(len(commitId))), commitId...)
+	}
+	return row
+}
+
+func TestParseInsertedRows(t *testing.T) {
+	p := newParser([]string{"seahub-db.Activity"})
+	position := Position{File: "binlog.000001", Offset: 4}
+
+	events := []struct {
+		event    []byte
+		rows     int
+		boundary bool
+		position Position
+		message  string
+	}{
+		{buildEvent(rotateEvent, 0, rotateBody("binlog.000002", 4), true), 0, true, Position{"binlog.000002", 4}, "Rotate event before the format is known"},
+		{buildEvent(formatDescriptionEvent, 0, formatDescriptionBody("8.0.36", true), true), 0, true, Position{"binlog.000002", 4}, "Format description event"},
+		{buildEvent(tableMapEvent, 200, tableMapBody(7, "seahub-db", "Activity"), true), 0, false, Position{"binlog.000002", 200}, "Table map event"},
+		{buildEvent(writeRowsEventV2, 300, writeRowsBody(7,
+			activityRow(42, "a@mpg.de", 2024, 5, 6, 7, 8, 9, `{"size": 12}`, ""),
+			activityRow(43, "b@mpg.de", 2024, 12, 31, 23, 59, 58, "", "abc")), true), 2, false, Position{"binlog.000002", 300}, "Write rows event"},
+		{buildEvent(16, 331, binary.LittleEndian.AppendUint64(nil, 1), true), 0, true, Position{"binlog.000002", 331}, "Xid event"},
+		{buildEvent(tableMapEvent, 400, tableMapBody(8, "seahub-db", "Other"), true), 0, false, Position{"binlog.000002", 400}, "Table map event of another table"},
+		{buildEvent(writeRowsEventV2, 500, writeRowsBody(8, activityRow(1, "c@mpg.de", 2024, 1, 1, 0, 0, 0, "", "")), true), 0, false, Position{"binlog.000002", 500}, "Write rows event of another table"},
+	}
+
+	var rows []Row
+	for _, test := range events {
+		parsed, boundary, err := p.parse(test.event, &position)
+		if err != nil {
+			t.Fatalf("%v. Unexpected error: %v", test.message, err)
+		}
+		if len(parsed) != test.rows || boundary != test.boundary || position != test.position {
+			t.Errorf("%v. Expected: %v rows, boundary %v, %v, Got: %v rows, boundary %v, %v", test.message, test.rows, test.boundary, test.position,
+				len(parsed), boundary, position)
+		}
+		rows = append(rows, parsed...)
+	}
+
+	expected := [][]interface{}{
+		{int64(42), "a@mpg.de", "2024-05-06 07:08:09", `{"size": 12}`, nil},
+		{int64(43), "b@mpg.de", "2024-12-31 23:59:58", "", "abc"},
+	}
+	for i, row := range rows {
+		if row.Schema != "seahub-db" || row.Table != "Activity" || !reflect.DeepEqual(row.Values, expected[i]) {
+			t.Errorf("Row %v. Expected: seahub-db.Activity %v, Got: %v.%v %v", i, expected[i], row.Schema, row.Table, row.Values)
+		}
+	}
+}
+
+func TestParseRejectsCorruptEvents(t *testing.T) {
+	p := newParser([]string{"seahub-db.Activity"})
+	position := Position{}
+	if _, _, err := p.parse(buildEvent(formatDescriptionEvent, 0, formatDescriptionBody("10.6.12-MariaDB-log", true), true), &position); err != nil {
+		t.Fatalf("Format description event of MariaDB. Unexpected error: %v", err)
+	}
+
+	corrupt := buildEvent(tableMapEvent, 200, tableMapBody(7, "seahub-db", "Activity"), true)
+	corrupt[eventHeaderLength+10] ^= 0xff
+	if _, _, err := p.parse(corrupt, &position); err != errChecksum {
+		t.Errorf("Event with a wrong checksum. Expected: %v, Got: %v", errChecksum, err)
+	}
+	if _, _, err := p.parse(buildEvent(tableMapEvent, 200, []byte{1, 2}, true), &position); err == nil {
+		t.Errorf("Truncated table map event was accepted.")
+	}
+	if _, _, err := p.parse(buildEvent(writeRowsEventV2, 300, writeRowsBody(9), true), &position); err == nil {
+		t.Errorf("Rows event of an unknown table was accepted.")
+	}
+}
+
+func TestParseRejectsUnsupportedEvents(t *testing.T) {
+	tests := []struct {
+		eventType byte
+		message   string
+	}{
+		{40, "Transaction payload event"},
+		{169, "Compressed write rows event of MariaDB"},
+		{200, "Unknown event"},
+	}
+
+	for _, test := range tests {
+		p := newParser([]string{"seahub-db.Activity"})
+		position := Position{File: "binlog.000001", Offset: 4}
+		if _, _, err := p.parse(buildEvent(test.eventType, 200, []byte{1, 2, 3}, false), &position); !errors.Is(err, ErrUnsupportedEvent) {
+			t.Errorf("%v. Expected: %v, Got: %v", test.message, ErrUnsupportedEvent, err)
+		}
+	}
+
+	p := newParser([]string{"seahub-db.Activity"})
+	position := Position{File: "binlog.000001", Offset: 4}
+	ignorable := buildEvent(200, 200, []byte{1, 2, 3}, false)
+	ignorable[17] |= ignorableFlag
+	if _, boundary, err := p.parse(ignorable, &position); err != nil || !boundary || position.Offset != 200 {
+		t.Errorf("Unknown event flagged as ignorable. Expected: skipped, Got: boundary %v, %v, %v", boundary, position, err)
+	}
+}
+
+func TestSupportsChecksum(t *testing.T) {
+	tests := []struct {
+		version  string
+		expected bool
+	}{
+		{"5.5.62-log", false},
+		{"5.6.1", true},
+		{"8.0.36", true},
+		{"5.5.68-MariaDB", true},
+		{"5.2.14-MariaDB", false},
+	}
+
+	for _, test := range tests {
+		if supportsChecksum(test.version) != test.expected {
+			t.Errorf("Checksum support of %v. Expected: %v, Got: %v", test.version, test.expected, !test.expected)
+		}
+	}
+}
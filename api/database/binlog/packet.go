@@ -0,0 +1,184 @@
+package binlog
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// payloads of this size continue in the next packet
+const maxPacketSize = 1<<24 - 1
+
+// ServerError is an error packet of the server, e.g. 1236 if the binlog file of the position was purged
+type ServerError struct {
+	Code    uint16
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprint("mysql error ", e.Code, ": ", e.Message)
+}
+
+var errMalformedPacket = errors.New("malformed packet")
+
+// conn speaks the client/server protocol, see https://dev.mysql.com/doc/dev/mysql-server/latest/page_protocol_basic_packets.html
+type conn struct {
+	netConn     net.Conn
+	reader      *bufio.Reader
+	sequence    byte
+	readTimeout time.Duration // 0 means no timeout
+	secure      bool          // tls is established
+}
+
+func newConn(netConn net.Conn) *conn {
+	return &conn{netConn: netConn, reader: bufio.NewReader(netConn)}
+}
+
+func (c *conn) readPacket() ([]byte, error) {
+	if c.readTimeout > 0 {
+		c.netConn.SetReadDeadline(time.Now().Add(c.readTimeout))
+	}
+	var payload []byte
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(c.reader, header); err != nil {
+			return nil, err
+		}
+		length := int(uint32(header[0]) | uint32(header[1])<<8 | uint32(header[2])<<16)
+		c.sequence = header[3] + 1
+		chunk := make([]byte, length)
+		if _, err := io.ReadFull(c.reader, chunk); err != nil {
+			return nil, err
+		}
+		payload = append(payload, chunk...)
+		if length < maxPacketSize {
+			return payload, nil
+		}
+	}
+}
+
+func (c *conn) writePacket(payload []byte) error {
+	for {
+		length := len(payload)
+		if length > maxPacketSize {
+			length = maxPacketSize
+		}
+		packet := make([]byte, 4+length)
+		packet[0], packet[1], packet[2] = byte(length), byte(length>>8), byte(length>>16)
+		packet[3] = c.sequence
+		c.sequence++
+		copy(packet[4:], payload[:length])
+		if _, err := c.netConn.Write(packet); err != nil {
+			return err
+		}
+		payload = payload[length:]
+		if length < maxPacketSize {
+			return nil
+		}
+	}
+}
+
+// command starts a new command phase
+func (c *conn) command(payload []byte) error {
+	c.sequence = 0
+	return c.writePacket(payload)
+}
+
+// exec runs a statement without result set
+func (c *conn) exec(query string) error {
+	if err := c.command(append([]byte{comQuery}, query...)); err != nil {
+		return err
+	}
+	packet, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(packet) > 0 && packet[0] == okPacket:
+		return nil
+	case len(packet) > 0 && packet[0] == errPacket:
+		return parseServerError(packet)
+	default:
+		return fmt.Errorf("unexpected result set of %q", query)
+	}
+}
+
+func parseServerError(packet []byte) error {
+	d := decoder{data: packet[1:]}
+	serverError := &ServerError{Code: uint16(d.uint(2))}
+	// the sql state marker and state are only sent after the handshake
+	if d.remaining() > 0 && d.data[d.pos] == '#' {
+		d.bytes(6)
+	}
+	serverError.Message = string(d.rest())
+	if d.err != nil {
+		return errMalformedPacket
+	}
+	return serverError
+}
+
+// decoder reads little endian protocol values. After the first read past the end every read returns zero values and
+// err is set, so a sequence of reads only has to be checked once.
+type decoder struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (d *decoder) remaining() int {
+	return len(d.data) - d.pos
+}
+
+func (d *decoder) bytes(n int) []byte {
+	if d.err != nil || n < 0 || n > d.remaining() {
+		d.err = errMalformedPacket
+		return nil
+	}
+	value := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return value
+}
+
+func (d *decoder) uint(n int) uint64 {
+	value := d.bytes(n)
+	var padded [8]byte
+	copy(padded[:], value)
+	return binary.LittleEndian.Uint64(padded[:])
+}
+
+func (d *decoder) lengthEncodedInt() uint64 {
+	first := d.uint(1)
+	switch first {
+	case 0xfc:
+		return d.uint(2)
+	case 0xfd:
+		return d.uint(3)
+	case 0xfe:
+		return d.uint(8)
+	default:
+		return first
+	}
+}
+
+// nulString reads up to the next NUL byte, or to the end if there is none
+func (d *decoder) nulString() string {
+	if d.err != nil {
+		return ""
+	}
+	for end := d.pos; end < len(d.data); end++ {
+		if d.data[end] == 0 {
+			value := string(d.data[d.pos:end])
+			d.pos = end + 1
+			return value
+		}
+	}
+	return string(d.rest())
+}
+
+func (d *decoder) rest() []byte {
+	return d.bytes(d.remaining())
+}
@@ -0,0 +1,194 @@
+// Package binlog reads the row based binlog of a MySQL or MariaDB server as a replica. It only implements what the
+// keeper binlog source needs: authentication, optionally over TLS, the binlog dump and the inserted rows of some
+// tables. Events it can not read, e.g. compressed transactions, end the stream with ErrUnsupportedEvent.
+package binlog
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// the server sends heartbeats while the binlog is idle, a stream without events for longer is considered dead
+const heartbeatPeriod = 30 * time.Second
+
+// Position is a position in the binlog of the server
+type Position struct {
+	File   string
+	Offset uint32
+}
+
+// Row is an inserted row. The values are in the order of the columns of the table, columns that were not logged are nil.
+type Row struct {
+	Schema string
+	Table  string
+	Values []interface{}
+}
+
+// Replica connects to the server like a replica does. The user needs the REPLICATION SLAVE privilege and the server
+// has to log with binlog_format=ROW.
+type Replica struct {
+	Address  string // host:port
+	User     string
+	Password string
+	ServerId uint32   // has to differ from the ids of the server and its other replicas
+	Tables   []string // "schema.table" of which inserts are streamed
+	// with caching_sha2_password the server asks for the password encrypted with its public key if it has not cached
+	// the password yet, e.g. after a restart
+	ServerPublicKey         *rsa.PublicKey // configured key of the server, see LoadPublicKey
+	AllowPublicKeyRetrieval bool           // requests the key from the server if none is configured, open to a man in the middle
+	TLS                     *tls.Config    // encrypts the connection if set, the server has to support TLS
+}
+
+// Stream is a running binlog dump
+type Stream struct {
+	conn     *conn
+	parser   *parser
+	position Position // behind the last event
+	resume   Position // behind the last event outside of a statement
+	pending  []Row
+}
+
+// Dump connects and starts streaming the binlog from the position
+func (r Replica) Dump(ctx context.Context, from Position) (*Stream, error) {
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", r.Address)
+	if err != nil {
+		return nil, err
+	}
+	// the handshake has no context support, the deadline of the context is used instead
+	if deadline, hasDeadline := ctx.Deadline(); hasDeadline {
+		netConn.SetDeadline(deadline)
+	}
+
+	stream := &Stream{conn: newConn(netConn), parser: newParser(r.Tables), position: from, resume: from}
+	if err = stream.start(r, from); err != nil {
+		netConn.Close()
+		return nil, err
+	}
+	netConn.SetDeadline(time.Time{})
+	stream.conn.readTimeout = 3 * heartbeatPeriod
+	return stream, nil
+}
+
+func (s *Stream) start(r Replica, from Position) error {
+	if err := s.conn.handshake(r); err != nil {
+		return err
+	}
+	// without announcing checksum support the server stops the dump if it writes checksums
+	if err := s.conn.exec("SET @master_binlog_checksum = @@global.binlog_checksum"); err != nil {
+		var serverError *ServerError
+		if !errors.As(err, &serverError) {
+			return err
+		}
+		// servers before checksums do not know the variable
+	}
+	if err := s.conn.exec(fmt.Sprint("SET @master_heartbeat_period = ", heartbeatPeriod.Nanoseconds())); err != nil {
+		return err
+	}
+
+	command := []byte{comBinlogDump}
+	command = binary.LittleEndian.AppendUint32(command, from.Offset)
+	command = binary.LittleEndian.AppendUint16(command, 0) // flags, block at the end of the binlog
+	command = binary.LittleEndian.AppendUint32(command, r.ServerId)
+	command = append(command, from.File...)
+	return s.conn.command(command)
+}
+
+// Next blocks until the next inserted row of the tables. It fails if the connection fails or is closed.
+func (s *Stream) Next() (Row, error) {
+	for len(s.pending) == 0 {
+		packet, err := s.conn.readPacket()
+		if err != nil {
+			return Row{}, err
+		}
+		if len(packet) == 0 {
+			return Row{}, errMalformedPacket
+		}
+		switch packet[0] {
+		case okPacket:
+		case errPacket:
+			return Row{}, parseServerError(packet)
+		case eofPacket:
+			return Row{}, errors.New("server ended the binlog dump")
+		default:
+			return Row{}, fmt.Errorf("unexpected packet 0x%02x in binlog dump", packet[0])
+		}
+
+		rows, boundary, err := s.parser.parse(packet[1:], &s.position)
+		if err != nil {
+			return Row{}, err
+		}
+		if boundary {
+			s.resume = s.position
+		}
+		s.pending = rows
+	}
+	row := s.pending[0]
+	s.pending = s.pending[1:]
+	return row, nil
+}
+
+// Position is where a new stream resumes without missing rows. The table ids of row events refer to the table map
+// event of their statement, so a stream can only be resumed between statements and the rows of the last statement may
+// be streamed again.
+func (s *Stream) Position() Position {
+	return s.resume
+}
+
+// Close ends the dump, a blocked Next returns
+func (s *Stream) Close() error {
+	return s.conn.netConn.Close()
+}
+
+// CurrentPosition is the end of the binlog of the server
+func CurrentPosition(ctx context.Context, db *sqlx.DB) (position Position, err error) {
+	// MySQL 8.4 renamed the statement, MariaDB only knows the old one
+	for _, statement := range []string{"SHOW MASTER STATUS", "SHOW BINARY LOG STATUS"} {
+		var rows *sqlx.Rows
+		if rows, err = db.QueryxContext(ctx, statement); err != nil {
+			continue
+		}
+		var columns []interface{}
+		if columns, err = scanFirstRow(rows); err != nil {
+			return
+		}
+		file, offset := columns[0].(*sql.NullString), columns[1].(*sql.NullInt64)
+		if !file.Valid {
+			return position, errors.New("binary log of the server is disabled")
+		}
+		return Position{File: file.String, Offset: uint32(offset.Int64)}, nil
+	}
+	return
+}
+
+// scanFirstRow scans the file and position of the status, the number of the other columns differs between versions
+func scanFirstRow(rows *sqlx.Rows) ([]interface{}, error) {
+	defer rows.Close()
+	names, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(names) < 2 {
+		return nil, errors.New("unexpected binary log status")
+	}
+	columns := []interface{}{&sql.NullString{}, &sql.NullInt64{}}
+	for range names[2:] {
+		columns = append(columns, &sql.RawBytes{})
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, errors.New("binary log of the server is disabled")
+	}
+	return columns, rows.Scan(columns...)
+}
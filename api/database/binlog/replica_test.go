@@ -0,0 +1,384 @@
+package binlog
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+var testScramble = []byte("abcdefghijklmnopqrst")
+
+// fakeServer accepts one replica connection, checks its password and streams the events after the dump command
+type fakeServer struct {
+	t        *testing.T
+	plugin   string
+	fullAuth bool
+	key      *rsa.PrivateKey // decrypts the password of the full auth
+	aborts   bool            // the replica is expected to give up during the handshake
+	password string
+	tls      *tls.Config // the replica has to encrypt the connection
+	events   [][]byte
+	dump     chan []byte
+}
+
+func (fs *fakeServer) listen() string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fs.t.Fatalf("Could not listen. Error: %v", err)
+	}
+	fs.dump = make(chan []byte, 1)
+	go func() {
+		defer listener.Close()
+		netConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer netConn.Close()
+		if err = fs.serve(newConn(netConn)); err != nil && !fs.aborts {
+			fs.t.Errorf("Fake server failed. Error: %v", err)
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func (fs *fakeServer) serve(c *conn) error {
+	handshake := []byte{10}
+	handshake = append(append(handshake, "8.0.36"...), 0)
+	handshake = binary.LittleEndian.AppendUint32(handshake, 1)
+	handshake = append(append(handshake, testScramble[:8]...), 0)
+	capabilities := uint32(clientProtocol41 | clientSecureConnection | clientPluginAuth)
+	if fs.tls != nil {
+		capabilities |= clientSSL
+	}
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities))
+	handshake = append(handshake, charsetUtf8mb4, 2, 0)
+	handshake = binary.LittleEndian.AppendUint16(handshake, uint16(capabilities>>16))
+	handshake = append(handshake, 21)
+	handshake = append(handshake, make([]byte, 10)...)
+	handshake = append(append(handshake, testScramble[8:]...), 0)
+	handshake = append(append(handshake, fs.plugin...), 0)
+	if err := c.writePacket(handshake); err != nil {
+		return err
+	}
+
+	response, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if fs.tls != nil {
+		if len(response) != 32 || binary.LittleEndian.Uint32(response)&clientSSL == 0 {
+			return errors.New("expected an ssl request")
+		}
+		// the reader may already hold the start of the tls handshake
+		tlsConn := tls.Server(bufferedConn{c.netConn, c.reader}, fs.tls)
+		if err = tlsConn.Handshake(); err != nil {
+			return err
+		}
+		c.netConn, c.reader, c.secure = tlsConn, bufio.NewReader(tlsConn), true
+		if response, err = c.readPacket(); err != nil {
+			return err
+		}
+	}
+	d := decoder{data: response, pos: 32}
+	user := d.nulString()
+	authResponse := d.bytes(int(d.uint(1)))
+	if user != "replica" || !fs.checkPassword(authResponse) {
+		return c.writePacket(append([]byte{errPacket, 0x15, 0x04}, "#28000Access denied"...))
+	}
+	if fs.plugin == cachingSha2PasswordPlugin {
+		if err = fs.cachingSha2Auth(c); err != nil {
+			return err
+		}
+	}
+	if err = c.writePacket([]byte{okPacket, 0, 0, 2, 0, 0, 0}); err != nil {
+		return err
+	}
+
+	// the checksum and heartbeat statements
+	for i := 0; i < 2; i++ {
+		if _, err = c.readPacket(); err != nil {
+			return err
+		}
+		if err = c.writePacket([]byte{okPacket, 0, 0, 2, 0, 0, 0}); err != nil {
+			return err
+		}
+	}
+	command, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	fs.dump <- command
+	for _, event := range fs.events {
+		if err = c.writePacket(append([]byte{okPacket}, event...)); err != nil {
+			return err
+		}
+	}
+	// block like a server at the end of the binlog until the replica closes the connection
+	c.readPacket()
+	return nil
+}
+
+// bufferedConn reads what the reader of a conn buffered before reading the connection
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (bc bufferedConn) Read(b []byte) (int, error) {
+	return bc.reader.Read(b)
+}
+
+// checkPassword verifies the auth response with the hashes a server stores
+func (fs *fakeServer) checkPassword(authResponse []byte) bool {
+	if fs.plugin == nativePasswordPlugin {
+		hash := sha1.Sum([]byte(fs.password))
+		stored := sha1.Sum(hash[:])
+		salted := sha1.Sum(append(append([]byte{}, testScramble...), stored[:]...))
+		for i := range salted {
+			salted[i] ^= authResponse[i]
+		}
+		return sha1.Sum(salted[:]) == stored
+	}
+	hash := sha256.Sum256([]byte(fs.password))
+	stored := sha256.Sum256(hash[:])
+	salted := sha256.Sum256(append(append([]byte{}, stored[:]...), testScramble...))
+	for i := range salted {
+		salted[i] ^= authResponse[i]
+	}
+	return sha256.Sum256(salted[:]) == stored
+}
+
+func (fs *fakeServer) cachingSha2Auth(c *conn) error {
+	if !fs.fullAuth {
+		return c.writePacket([]byte{authMore, 3})
+	}
+	if err := c.writePacket([]byte{authMore, 4}); err != nil {
+		return err
+	}
+	// the encrypted password, or the request for the public key
+	encrypted, err := c.readPacket()
+	if err != nil {
+		return err
+	}
+	if c.secure {
+		if string(encrypted) != fs.password+"\x00" {
+			return errors.New("wrong password in full auth")
+		}
+		return nil
+	}
+	if bytes.Equal(encrypted, []byte{2}) {
+		if err = c.writePacket(append([]byte{authMore}, encodePublicKey(fs.t, fs.key)...)); err != nil {
+			return err
+		}
+		if encrypted, err = c.readPacket(); err != nil {
+			return err
+		}
+	}
+	plain, err := rsa.DecryptOAEP(sha1.New(), rand.Reader, fs.key, encrypted, nil)
+	if err != nil {
+		return err
+	}
+	for i := range plain {
+		plain[i] ^= testScramble[i%len(testScramble)]
+	}
+	if string(plain) != fs.password+"\x00" {
+		return errors.New("wrong password in full auth")
+	}
+	return nil
+}
+
+func encodePublicKey(t *testing.T, key *rsa.PrivateKey) []byte {
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Could not encode the public key. Error: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+}
+
+func TestReplicaStreamsInsertedRows(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate the key of the server. Error: %v", err)
+	}
+	tests := []struct {
+		plugin                  string
+		fullAuth                bool
+		serverPublicKey         *rsa.PublicKey
+		allowPublicKeyRetrieval bool
+		message                 string
+	}{
+		{nativePasswordPlugin, false, nil, false, "mysql_native_password"},
+		{cachingSha2PasswordPlugin, false, nil, false, "caching_sha2_password fast auth"},
+		{cachingSha2PasswordPlugin, true, &key.PublicKey, false, "caching_sha2_password full auth with the configured key"},
+		{cachingSha2PasswordPlugin, true, nil, true, "caching_sha2_password full auth with the retrieved key"},
+	}
+
+	for _, test := range tests {
+		server := &fakeServer{t: t, plugin: test.plugin, fullAuth: test.fullAuth, key: key, password: "secret", events: [][]byte{
+			buildEvent(rotateEvent, 0, rotateBody("binlog.000002", 120), true),
+			buildEvent(formatDescriptionEvent, 0, formatDescriptionBody("8.0.36", true), true),
+			buildEvent(tableMapEvent, 200, tableMapBody(7, "seahub-db", "Activity"), true),
+			buildEvent(writeRowsEventV2, 300, writeRowsBody(7, activityRow(42, "a@mpg.de", 2024, 5, 6, 7, 8, 9, "", "")), true),
+			buildEvent(16, 331, binary.LittleEndian.AppendUint64(nil, 1), true),
+		}}
+		replica := Replica{Address: server.listen(), User: "replica", Password: "secret", ServerId: 99, Tables: []string{"seahub-db.Activity"},
+			ServerPublicKey: test.serverPublicKey, AllowPublicKeyRetrieval: test.allowPublicKeyRetrieval}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stream, err := replica.Dump(ctx, Position{File: "binlog.000002", Offset: 120})
+		cancel()
+		if err != nil {
+			t.Fatalf("%v. Could not start the dump. Error: %v", test.message, err)
+		}
+		expectedDump := append([]byte{comBinlogDump, 120, 0, 0, 0, 0, 0, 99, 0, 0, 0}, "binlog.000002"...)
+		if dump := <-server.dump; !bytes.Equal(dump, expectedDump) {
+			t.Errorf("%v. Dump command. Expected: %v, Got: %v", test.message, expectedDump, dump)
+		}
+
+		row, err := stream.Next()
+		if err != nil || row.Values[0] != int64(42) {
+			t.Errorf("%v. First row. Expected: id 42, Got: %v, %v", test.message, row.Values, err)
+		}
+		// the statement of the row is not complete yet
+		if position := stream.Position(); position != (Position{"binlog.000002", 120}) {
+			t.Errorf("%v. Position within the statement. Expected: binlog.000002:120, Got: %v", test.message, position)
+		}
+
+		blocked := make(chan error)
+		go func() {
+			_, err := stream.Next()
+			blocked <- err
+		}()
+		time.Sleep(20 * time.Millisecond)
+		stream.Close()
+		select {
+		case err = <-blocked:
+			if err == nil {
+				t.Errorf("%v. Next after close did not fail.", test.message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%v. Close did not unblock Next.", test.message)
+		}
+		if position := stream.Position(); position != (Position{"binlog.000002", 331}) {
+			t.Errorf("%v. Position after the transaction. Expected: binlog.000002:331, Got: %v", test.message, position)
+		}
+	}
+}
+
+// selfSignedCertificate returns the config of a server for 127.0.0.1 and the pool of a client that trusts it
+func selfSignedCertificate(t *testing.T) (*tls.Config, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate the key of the certificate. Error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "fake server"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create the certificate. Error: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Could not parse the certificate. Error: %v", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(certificate)
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}}, pool
+}
+
+func TestReplicaOverTLS(t *testing.T) {
+	serverConfig, pool := selfSignedCertificate(t)
+	clientConfig := &tls.Config{ServerName: "127.0.0.1", RootCAs: pool, MinVersion: tls.VersionTLS12}
+	tests := []struct {
+		plugin   string
+		fullAuth bool
+		message  string
+	}{
+		{nativePasswordPlugin, false, "mysql_native_password"},
+		{cachingSha2PasswordPlugin, true, "caching_sha2_password full auth without a public key"},
+	}
+
+	for _, test := range tests {
+		server := &fakeServer{t: t, plugin: test.plugin, fullAuth: test.fullAuth, password: "secret", tls: serverConfig,
+			events: [][]byte{buildEvent(rotateEvent, 0, rotateBody("binlog.000002", 120), true)}}
+		replica := Replica{Address: server.listen(), User: "replica", Password: "secret", ServerId: 99, TLS: clientConfig}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		stream, err := replica.Dump(ctx, Position{File: "binlog.000002", Offset: 120})
+		cancel()
+		if err != nil {
+			t.Fatalf("%v. Could not start the dump over tls. Error: %v", test.message, err)
+		}
+		<-server.dump
+		stream.Close()
+	}
+
+	// a server without tls must not get the credentials in clear
+	server := &fakeServer{t: t, plugin: nativePasswordPlugin, aborts: true, password: "secret"}
+	replica := Replica{Address: server.listen(), User: "replica", Password: "secret", ServerId: 99, TLS: clientConfig}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := replica.Dump(ctx, Position{File: "binlog.000001", Offset: 4}); err == nil {
+		t.Errorf("Dump over tls from a server without tls. Expected an error.")
+	}
+}
+
+func TestReplicaRejectsWrongPassword(t *testing.T) {
+	server := &fakeServer{t: t, plugin: nativePasswordPlugin, password: "secret"}
+	replica := Replica{Address: server.listen(), User: "replica", Password: "wrong", ServerId: 99}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_, err := replica.Dump(ctx, Position{File: "binlog.000001", Offset: 4})
+	var serverError *ServerError
+	if !errors.As(err, &serverError) || serverError.Code != 1045 || serverError.Message != "Access denied" {
+		t.Errorf("Dump with a wrong password. Expected: mysql error 1045: Access denied, Got: %v", err)
+	}
+}
+
+func TestReplicaRequiresPublicKeyForFullAuth(t *testing.T) {
+	server := &fakeServer{t: t, plugin: cachingSha2PasswordPlugin, fullAuth: true, aborts: true, password: "secret"}
+	replica := Replica{Address: server.listen(), User: "replica", Password: "secret", ServerId: 99}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := replica.Dump(ctx, Position{File: "binlog.000001", Offset: 4}); !errors.Is(err, errPublicKeyRequired) {
+		t.Errorf("Full auth without a public key. Expected: %v, Got: %v", errPublicKeyRequired, err)
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Could not generate a key. Error: %v", err)
+	}
+	if parsed, err := ParsePublicKey(encodePublicKey(t, key)); err != nil || !parsed.Equal(&key.PublicKey) {
+		t.Errorf("Parsed key. Expected: the public key, Got: %v, %v", parsed, err)
+	}
+	if _, err = ParsePublicKey([]byte("no pem")); err == nil {
+		t.Errorf("Parsing no pem. Expected an error.")
+	}
+}
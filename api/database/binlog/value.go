@@ -0,0 +1,175 @@
+package binlog
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// column types of the table map event, see https://dev.mysql.com/doc/dev/mysql-server/latest/field__types_8h.html
+const (
+	typeDecimal    = 0
+	typeTiny       = 1
+	typeShort      = 2
+	typeLong       = 3
+	typeFloat      = 4
+	typeDouble     = 5
+	typeNull       = 6
+	typeTimestamp  = 7
+	typeLongLong   = 8
+	typeInt24      = 9
+	typeDate       = 10
+	typeTime       = 11
+	typeDateTime   = 12
+	typeYear       = 13
+	typeVarchar    = 15
+	typeBit        = 16
+	typeTimestamp2 = 17
+	typeDateTime2  = 18
+	typeTime2      = 19
+	typeJson       = 245
+	typeNewDecimal = 246
+	typeEnum       = 247
+	typeSet        = 248
+	typeTinyBlob   = 249
+	typeMediumBlob = 250
+	typeLongBlob   = 251
+	typeBlob       = 252
+	typeVarString  = 253
+	typeString     = 254
+	typeGeometry   = 255
+)
+
+// readColumnMeta reads the metadata of the table map event of one column
+func readColumnMeta(d *decoder, columnType byte) uint16 {
+	switch columnType {
+	case typeFloat, typeDouble, typeBlob, typeGeometry, typeJson, typeTimestamp2, typeDateTime2, typeTime2:
+		return uint16(d.uint(1))
+	case typeVarchar, typeVarString, typeBit:
+		return uint16(d.uint(2))
+	case typeString, typeNewDecimal:
+		// big endian: real type and length, or precision and scale
+		return uint16(d.uint(1))<<8 | uint16(d.uint(1))
+	default:
+		return 0
+	}
+}
+
+// readValue reads one column of a row. Integers are int64, text and blobs are strings, DATETIME is a string in the
+// format of time.DateTime like the driver returns it and TIMESTAMP is a time.Time in UTC. Values hatnote does not use,
+// e.g. decimals, are returned as their raw bytes.
+func readValue(d *decoder, columnType byte, meta uint16) (interface{}, error) {
+	switch columnType {
+	case typeNull:
+		return nil, nil
+	case typeTiny:
+		return int64(int8(d.uint(1))), nil
+	case typeShort:
+		return int64(int16(d.uint(2))), nil
+	case typeInt24:
+		value := int64(d.uint(3))
+		if value&0x800000 != 0 {
+			value -= 1 << 24
+		}
+		return value, nil
+	case typeLong:
+		return int64(int32(d.uint(4))), nil
+	case typeLongLong:
+		return int64(d.uint(8)), nil
+	case typeYear:
+		return int64(d.uint(1)) + 1900, nil
+	case typeFloat:
+		return float64(math.Float32frombits(uint32(d.uint(4)))), nil
+	case typeDouble:
+		return math.Float64frombits(d.uint(8)), nil
+	case typeVarchar, typeVarString:
+		return readString(d, int(meta)), nil
+	case typeString:
+		return readStringColumn(d, meta)
+	case typeBlob, typeGeometry, typeJson, typeTinyBlob, typeMediumBlob, typeLongBlob:
+		return string(d.bytes(int(d.uint(int(meta))))), nil
+	case typeBit:
+		bits := int(meta>>8)*8 + int(meta&0xff)
+		return d.bytes((bits + 7) / 8), nil
+	case typeNewDecimal:
+		return d.bytes(decimalSize(int(meta>>8), int(meta&0xff))), nil
+	case typeDate:
+		value := d.uint(3)
+		return fmt.Sprintf("%04d-%02d-%02d", value>>9, value>>5&0xf, value&0x1f), nil
+	case typeTime:
+		return d.bytes(3), nil
+	case typeTime2:
+		return d.bytes(3 + fractionSize(meta)), nil
+	case typeDateTime:
+		value := d.uint(8)
+		return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", value/10000000000, value/100000000%100, value/1000000%100,
+			value/10000%100, value/100%100, value%100), nil
+	case typeDateTime2:
+		return readDateTime2(d, meta), nil
+	case typeTimestamp:
+		return time.Unix(int64(d.uint(4)), 0).UTC(), nil
+	case typeTimestamp2:
+		seconds := d.bytes(4)
+		d.bytes(fractionSize(meta))
+		if d.err != nil {
+			return nil, d.err
+		}
+		return time.Unix(int64(binary.BigEndian.Uint32(seconds)), 0).UTC(), nil
+	default:
+		return nil, fmt.Errorf("unsupported column type %d", columnType)
+	}
+}
+
+// readString reads a string with a length prefix of one byte, or two if the column can be longer than 255 bytes
+func readString(d *decoder, maxLength int) string {
+	if maxLength < 256 {
+		return string(d.bytes(int(d.uint(1))))
+	}
+	return string(d.bytes(int(d.uint(2))))
+}
+
+// readStringColumn reads CHAR, ENUM and SET columns, which share the type STRING in the binlog
+func readStringColumn(d *decoder, meta uint16) (interface{}, error) {
+	realType, length := byte(meta>>8), int(meta&0xff)
+	if meta >= 256 && realType&0x30 != 0x30 {
+		// CHAR longer than 255 bytes keeps the upper bits of the length in the real type
+		length |= int((realType&0x30)^0x30) << 4
+		realType |= 0x30
+	}
+	switch realType {
+	case typeEnum:
+		return int64(d.uint(length)), nil
+	case typeSet:
+		return int64(d.uint(length)), nil
+	default:
+		return readString(d, length), nil
+	}
+}
+
+// readDateTime2 decodes the big endian DATETIME format of MySQL 5.6.4 and newer without the fraction
+func readDateTime2(d *decoder, meta uint16) string {
+	packed := d.bytes(5)
+	d.bytes(fractionSize(meta))
+	if len(packed) < 5 {
+		return ""
+	}
+	value := (uint64(packed[0])<<32 | uint64(binary.BigEndian.Uint32(packed[1:]))) - 0x8000000000
+	date, clock := value>>17, value&(1<<17-1)
+	yearMonth := date >> 5
+	return fmt.Sprintf("%04d-%02d-%02d %02d:%02d:%02d", yearMonth/13, yearMonth%13, date&0x1f,
+		clock>>12, clock>>6&0x3f, clock&0x3f)
+}
+
+func fractionSize(precision uint16) int {
+	return int(precision+1) / 2
+}
+
+func decimalSize(precision int, scale int) int {
+	digitBytes := []int{0, 1, 1, 2, 2, 3, 3, 4, 4, 4}
+	integral := precision - scale
+	if integral < 0 || scale < 0 {
+		return 0
+	}
+	return integral/9*4 + digitBytes[integral%9] + scale/9*4 + digitBytes[scale%9]
+}
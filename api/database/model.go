@@ -1,10 +1,46 @@
 package database
 
 type Config struct {
-	User            string `yaml:"user"`
-	Password        string `yaml:"password"`
-	Host            string `yaml:"host"`
-	Port            int    `yaml:"port"`
-	DBName          string `yaml:"dbname"`
-	ReconnectTimout int    `yaml:"reconnectTimout"`
+	User               string         `yaml:"user"`
+	Password           string         `yaml:"password"`
+	Host               string         `yaml:"host"`
+	Port               int            `yaml:"port"`
+	DBName             string         `yaml:"dbname"`
+	ReconnectTimout    int            `yaml:"reconnectTimout"`
+	Timezone           string         `yaml:"timezone"`           // of the stored timestamps, e.g. "Europe/Berlin" or "auto", UTC if empty
+	QueryTimeout       int            `yaml:"queryTimeout"`       // milliseconds, applies to every query without its own timeout
+	QueryTimeouts      map[string]int `yaml:"queryTimeouts"`      // milliseconds by query name, e.g. "blocks: 5000"
+	MaxParallelQueries int            `yaml:"maxParallelQueries"` // queries of a tick that run at the same time
+	TickTimeout        int            `yaml:"tickTimeout"`        // milliseconds the queries of a tick share, the query interval if not set
+	Push               PushConfig     `yaml:"push"`               // postgres only
+	Binlog             BinlogConfig   `yaml:"binlog"`             // mysql only
+}
+
+// PushConfig enables the push mode: triggers on the tables NOTIFY the channel and the service loads its window right away
+type PushConfig struct {
+	Channel         string `yaml:"channel"`         // push mode is off if empty
+	InstallTriggers bool   `yaml:"installTriggers"` // create the triggers at connect, otherwise they have to exist
+	PollInterval    int    `yaml:"pollInterval"`    // milliseconds between polls while the listener is connected
+	Debounce        int    `yaml:"debounce"`        // milliseconds notifications are collected before the window is loaded
+}
+
+func (c PushConfig) IsEnabled() bool {
+	return len(c.Channel) > 0
+}
+
+// BinlogConfig enables the binlog mode: the service reads the inserted rows from the binlog as a replica instead of
+// polling the tables. The user needs the REPLICATION SLAVE and REPLICATION CLIENT privileges.
+type BinlogConfig struct {
+	ServerId uint32 `yaml:"serverId"` // binlog mode is off if 0, has to differ from the ids of the database and its replicas
+	// with caching_sha2_password the password is sent encrypted with the public key of the server if the server has not
+	// cached it, e.g. after a restart. Without either option the binlog mode falls back to polling then.
+	ServerPublicKeyFile     string `yaml:"serverPublicKeyFile"`     // pem of the server, see caching_sha2_password_public_key_path
+	AllowPublicKeyRetrieval bool   `yaml:"allowPublicKeyRetrieval"` // requests the key from the server instead, a man in the middle can replace it
+	// encrypts the replication connection, the password is sent as it is then and no public key is needed
+	TLS    bool   `yaml:"tls"`
+	CaFile string `yaml:"caFile"` // pem of the certificates the server certificate is verified against, the system roots if empty
+}
+
+func (c BinlogConfig) IsEnabled() bool {
+	return c.ServerId != 0
 }
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"api/utils/log"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// PushListener listens for the NOTIFY of the triggers on the tables of a postgres database. A notification carries no
+// rows, it only tells the service to load its window right away instead of waiting for the next tick.
+type PushListener struct {
+	channel       string
+	concern       log.Concern
+	notifications chan struct{}
+	listening     atomic.Bool
+	lock          sync.Mutex
+	listener      *pq.Listener
+}
+
+func NewPushListener(channel string, concern log.Concern) *PushListener {
+	// one pending notification is enough, the window covers every row committed meanwhile
+	return &PushListener{channel: channel, concern: concern, notifications: make(chan struct{}, 1)}
+}
+
+// Listen connects the listener. It does not block, the listener connects and reconnects in the background.
+func (pl *PushListener) Listen(dataSourceName string) {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+	if pl.listener != nil {
+		return
+	}
+
+	listener := pq.NewListener(dataSourceName, time.Second, time.Minute, pl.event)
+	pl.listener = listener
+	go func() {
+		// blocks until the first connection is established
+		if err := listener.Listen(pl.channel); err != nil {
+			log.Error(fmt.Sprint("Could not listen on channel ", pl.channel, "."), err, pl.concern, log.Database)
+		}
+	}()
+	go pl.forward(listener)
+}
+
+func (pl *PushListener) event(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventConnected, pq.ListenerEventReconnected:
+		log.Info(fmt.Sprint("Listening for notifications on channel ", pl.channel, "."), pl.concern, log.Database)
+		pl.listening.Store(true)
+	case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+		if pl.listening.Swap(false) {
+			log.Warn(fmt.Sprint("Lost listener of channel ", pl.channel, ". Falling back to polling. Error: ", err), pl.concern, log.Database)
+		}
+	}
+}
+
+func (pl *PushListener) forward(listener *pq.Listener) {
+	// the channel is closed when the listener is closed. After a reconnect a nil notification is sent, because rows
+	// may have been committed while disconnected.
+	for range listener.Notify {
+		select {
+		case pl.notifications <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (pl *PushListener) Notifications() <-chan struct{} {
+	return pl.notifications
+}
+
+// IsListening is false while the listener is not connected, the service polls every tick then
+func (pl *PushListener) IsListening() bool {
+	return pl.listening.Load()
+}
+
+func (pl *PushListener) Close() error {
+	pl.lock.Lock()
+	defer pl.lock.Unlock()
+	pl.listening.Store(false)
+	if pl.listener == nil {
+		return nil
+	}
+	err := pl.listener.Close()
+	pl.listener = nil
+	return err
+}
+
+// Push is embedded by the database controllers of postgres services and makes them a service.Notifier. The listener
+// is started and closed with the connection, while the poller reads the notifications from its own goroutine, so it
+// is guarded by the lock.
+type Push struct {
+	pushLock     sync.Mutex
+	pushListener *PushListener
+}
+
+// StartPush installs the triggers on the tables if configured and starts listening, unless push mode is off. If the
+// triggers can not be installed, the service keeps polling.
+func (p *Push) StartPush(db *sqlx.DB, dataSourceName string, config PushConfig, tables []string, concern log.Concern) {
+	if !config.IsEnabled() {
+		return
+	}
+	if config.InstallTriggers {
+		if err := InstallNotifyTriggers(db, config.Channel, tables); err != nil {
+			log.Error("Could not install notify triggers. Falling back to polling.", err, concern, log.Database)
+			return
+		}
+	}
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	if p.pushListener == nil {
+		p.pushListener = NewPushListener(config.Channel, concern)
+	}
+	p.pushListener.Listen(dataSourceName)
+}
+
+// StopPush closes the listener, StartPush connects it again
+func (p *Push) StopPush() {
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	if p.pushListener != nil {
+		p.pushListener.Close()
+	}
+}
+
+// Notifications is nil until push mode was started, a nil channel never receives
+func (p *Push) Notifications() <-chan struct{} {
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	if p.pushListener == nil {
+		return nil
+	}
+	return p.pushListener.Notifications()
+}
+
+func (p *Push) IsListening() bool {
+	p.pushLock.Lock()
+	defer p.pushLock.Unlock()
+	return p.pushListener != nil && p.pushListener.IsListening()
+}
+
+// InstallNotifyTriggers creates a statement level trigger on each table that notifies the channel with the table name.
+// It replaces triggers of earlier installs, so it can run at every connect.
+func InstallNotifyTriggers(db *sqlx.DB, channel string, tables []string) error {
+	statements := []string{
+		"CREATE OR REPLACE FUNCTION hatnote_notify() RETURNS trigger AS $$ " +
+			"BEGIN PERFORM pg_notify(TG_ARGV[0], TG_TABLE_NAME); RETURN NULL; END; " +
+			"$$ LANGUAGE plpgsql",
+	}
+	for _, table := range tables {
+		statements = append(statements,
+			fmt.Sprint("DROP TRIGGER IF EXISTS hatnote_notify ON ", pq.QuoteIdentifier(table)),
+			fmt.Sprint("CREATE TRIGGER hatnote_notify AFTER INSERT OR UPDATE ON ", pq.QuoteIdentifier(table),
+				" FOR EACH STATEMENT EXECUTE PROCEDURE hatnote_notify(", pq.QuoteLiteral(channel), ")"))
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	for _, statement := range statements {
+		if _, err = tx.Exec(statement); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("could not install notify triggers on %s: %w", strings.Join(tables, ", "), err)
+		}
+	}
+	return tx.Commit()
+}
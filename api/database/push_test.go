@@ -0,0 +1,78 @@
+package database
+
+import (
+	"api/utils/log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// needs a local postgres, e.g. HATNOTE_TEST_POSTGRES="host=localhost user=postgres password=postgres sslmode=disable"
+func TestPushListenerNotifiesOnInsert(t *testing.T) {
+	dataSourceName := os.Getenv("HATNOTE_TEST_POSTGRES")
+	if len(dataSourceName) == 0 {
+		t.Skip("HATNOTE_TEST_POSTGRES is not set.")
+	}
+
+	db, err := sqlx.Connect("postgres", dataSourceName)
+	if err != nil {
+		t.Fatalf("Could not connect. Error: %v", err)
+	}
+	defer db.Close()
+	db.MustExec("CREATE TABLE IF NOT EXISTS hatnote_push_test (id serial PRIMARY KEY, inserted_at timestamp DEFAULT now())")
+	defer db.Exec("DROP TABLE IF EXISTS hatnote_push_test")
+
+	if err = InstallNotifyTriggers(db, "hatnote_push_test", []string{"hatnote_push_test"}); err != nil {
+		t.Fatalf("Could not install the triggers. Error: %v", err)
+	}
+	listener := NewPushListener("hatnote_push_test", log.Service)
+	listener.Listen(dataSourceName)
+	defer listener.Close()
+	for start := time.Now(); !listener.IsListening(); time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("Listener did not connect.")
+		}
+	}
+	// the notification of the connect
+	select {
+	case <-listener.Notifications():
+	default:
+	}
+
+	db.MustExec("INSERT INTO hatnote_push_test DEFAULT VALUES")
+	select {
+	case <-listener.Notifications():
+	case <-time.After(time.Second):
+		t.Errorf("No notification after an insert.")
+	}
+}
+
+func TestPushIsSafeForConcurrentUse(t *testing.T) {
+	var push Push
+	if push.Notifications() != nil || push.IsListening() {
+		t.Errorf("Push before start. Expected: no notifications and not listening")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// the poller goroutine reads while the connection is started and closed
+		for i := 0; i < 100; i++ {
+			push.Notifications()
+			push.IsListening()
+		}
+	}()
+	// nothing listens on the port, the listener keeps trying in the background until it is closed
+	config := PushConfig{Channel: "hatnote_push_test"}
+	for i := 0; i < 3; i++ {
+		push.StartPush(nil, "host=127.0.0.1 port=1 connect_timeout=1 sslmode=disable", config, nil, log.Service)
+		push.StopPush()
+	}
+	<-done
+
+	if push.Notifications() == nil || push.IsListening() {
+		t.Errorf("Push after stop. Expected: notifications channel and not listening")
+	}
+}
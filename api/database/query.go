@@ -0,0 +1,19 @@
+package database
+
+import (
+	"context"
+	"time"
+)
+
+// QueryContext limits a query to the timeout configured for its name. A timed out query returns
+// context.DeadlineExceeded and counts as failed query like any other database error.
+func (c Config) QueryContext(ctx context.Context, query string) (context.Context, context.CancelFunc) {
+	timeout := c.QueryTimeout
+	if queryTimeout, exists := c.QueryTimeouts[query]; exists {
+		timeout = queryTimeout
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Duration(timeout)*time.Millisecond)
+}
@@ -0,0 +1,35 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestQueryContext(t *testing.T) {
+	config := Config{QueryTimeout: 30000, QueryTimeouts: map[string]int{"blocks": 5000, "ping": 0}}
+
+	tests := []struct {
+		query    string
+		expected time.Duration // 0 for no deadline
+	}{
+		{"blocks", 5 * time.Second},
+		{"messages", 30 * time.Second},
+		{"ping", 0},
+	}
+
+	for _, test := range tests {
+		ctx, cancel := config.QueryContext(context.Background(), test.query)
+		deadline, hasDeadline := ctx.Deadline()
+		cancel()
+		if test.expected == 0 {
+			if hasDeadline {
+				t.Errorf("Deadline of query %v. Expected: none, Got: %v", test.query, deadline)
+			}
+			continue
+		}
+		if remaining := time.Until(deadline); !hasDeadline || remaining > test.expected || remaining < test.expected-time.Second {
+			t.Errorf("Timeout of query %v. Expected: %v, Got: %v", test.query, test.expected, remaining)
+		}
+	}
+}
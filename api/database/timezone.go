@@ -0,0 +1,178 @@
+package database
+
+import (
+	"api/utils/log"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TimezoneAuto as timezone of a database config detects the time zone of the database clock at every connect
+const TimezoneAuto = "auto"
+
+// offsetRecheckInterval is how long a detected fixed offset is used before it is detected again
+const offsetRecheckInterval = time.Minute
+
+// ClockQueries select the time zone of a database clock for the timezone 'auto'
+type ClockQueries struct {
+	Zone   string // name of the time zone, only used if it is an IANA name like 'Europe/Berlin'
+	Offset string // offset to UTC in seconds, the fallback for abbreviations like 'CEST' or offsets like '+01:00'
+}
+
+var (
+	// the system time zone of mysql is an abbreviation in most installations, named zones need the time zone tables
+	MysqlClock = ClockQueries{
+		Zone:   "SELECT IF(@@session.time_zone = 'SYSTEM', @@global.system_time_zone, @@session.time_zone)",
+		Offset: "SELECT TIMESTAMPDIFF(SECOND, UTC_TIMESTAMP(), NOW())",
+	}
+	PostgresClock = ClockQueries{
+		Zone:   "SELECT current_setting('TimeZone')",
+		Offset: "SELECT CAST(EXTRACT(TIMEZONE FROM now()) AS INTEGER)",
+	}
+)
+
+// Location returns the time zone the timestamps of the database are stored in. It is UTC if no timezone is configured
+// and nil for 'auto', which is resolved by a Clock once connected.
+func (c Config) Location() (*time.Location, error) {
+	switch c.Timezone {
+	case "":
+		return time.UTC, nil
+	case TimezoneAuto:
+		return nil, nil
+	}
+	return time.LoadLocation(c.Timezone)
+}
+
+// Clock is the time zone of the timestamps of a database connection. For 'auto' a named time zone of the database
+// follows daylight saving time changes by itself. If the database only reports a fixed offset, Refresh detects it again
+// after the offsetRecheckInterval, so a change is picked up while the connection stays open.
+type Clock struct {
+	config       Config
+	queries      ClockQueries
+	concern      log.Concern
+	lock         sync.Mutex
+	location     *time.Location
+	detectedAt   time.Time                                                // of a fixed offset, zero for named and configured zones
+	detectOffset func(ctx context.Context) (offsetSeconds int, err error) // nil until connected
+}
+
+// NewClock resolves configured time zones right away, 'auto' is resolved by Connect
+func NewClock(config Config, queries ClockQueries, concern log.Concern) *Clock {
+	location, err := config.Location()
+	if err != nil {
+		log.Error(fmt.Sprint("Could not load database time zone ", config.Timezone, ". Using UTC."), err, concern, log.Database)
+		location = time.UTC
+	}
+	return &Clock{config: config, queries: queries, concern: concern, location: location}
+}
+
+// Connect detects the time zone of the database clock with the new connection for 'auto'. It falls back to UTC if
+// the time zone can not be detected, and detects it again with the next Refresh after the offsetRecheckInterval.
+func (c *Clock) Connect(db *sqlx.DB) {
+	if c.config.Timezone != TimezoneAuto {
+		return
+	}
+	detectOffset := func(ctx context.Context) (offsetSeconds int, err error) {
+		err = db.GetContext(ctx, &offsetSeconds, c.queries.Offset)
+		return
+	}
+	ctx, cancel := c.config.QueryContext(context.Background(), "timezone")
+	defer cancel()
+
+	var zone string
+	if err := db.GetContext(ctx, &zone, c.queries.Zone); err != nil {
+		log.Warn(fmt.Sprint("Could not query the database time zone. Detecting its offset instead. Error: ", err), c.concern, log.Database)
+	} else if location := namedLocation(zone); location != nil {
+		log.Info(fmt.Sprint("Detected database time zone ", location, "."), c.concern, log.Database)
+		c.set(location, time.Time{}, detectOffset)
+		return
+	}
+	offsetSeconds, err := detectOffset(ctx)
+	if err != nil {
+		log.Error("Could not detect the offset of the database clock. Using UTC.", err, c.concern, log.Database)
+		c.set(time.UTC, time.Now(), detectOffset)
+		return
+	}
+	location := fixedLocation(offsetSeconds)
+	log.Info(fmt.Sprint("Detected database clock offset ", location, ". Detecting it again every ", offsetRecheckInterval, "."), c.concern, log.Database)
+	c.set(location, time.Now(), detectOffset)
+}
+
+func (c *Clock) set(location *time.Location, detectedAt time.Time, detectOffset func(ctx context.Context) (int, error)) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.location = location
+	c.detectedAt = detectedAt
+	c.detectOffset = detectOffset
+}
+
+// Location returns UTC until 'auto' is connected. It never queries the database, the location only changes with
+// Connect and Refresh.
+func (c *Clock) Location() *time.Location {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.location == nil {
+		return time.UTC
+	}
+	return c.location
+}
+
+// Refresh detects a fixed offset again once it is older than the offsetRecheckInterval. The poller calls it once per
+// tick before the window is loaded, so all rows of a window are converted with the same offset. Location returns the
+// old offset during the query, if the query fails the old offset is kept until the next check.
+func (c *Clock) Refresh(ctx context.Context) {
+	c.lock.Lock()
+	detectOffset, detectedAt, previous := c.detectOffset, c.detectedAt, c.location
+	c.lock.Unlock()
+	if detectOffset == nil || detectedAt.IsZero() || time.Since(detectedAt) < offsetRecheckInterval {
+		return
+	}
+
+	queryCtx, cancel := c.config.QueryContext(ctx, "timezone")
+	defer cancel()
+	offsetSeconds, err := detectOffset(queryCtx)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.detectedAt.Equal(detectedAt) {
+		// connected again during the query
+		return
+	}
+	c.detectedAt = time.Now()
+	if err != nil {
+		log.Warn(fmt.Sprint("Could not detect the offset of the database clock again. Keeping ", previous, ". Error: ", err), c.concern, log.Database)
+		return
+	}
+	location := fixedLocation(offsetSeconds)
+	if location.String() != previous.String() {
+		log.Info(fmt.Sprint("Offset of the database clock changed from ", previous, " to ", location, "."), c.concern, log.Database)
+	}
+	c.location = location
+}
+
+func fixedLocation(offsetSeconds int) *time.Location {
+	return time.FixedZone(fmt.Sprint("UTC", time.Duration(offsetSeconds)*time.Second), offsetSeconds)
+}
+
+// namedLocation loads IANA time zone names. Abbreviations are ambiguous and do not change with daylight saving time,
+// e.g. mysql keeps the system time zone 'CET' of its start all summer long, so they are not loaded.
+func namedLocation(zone string) *time.Location {
+	if zone != "UTC" && !strings.Contains(zone, "/") {
+		return nil
+	}
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil
+	}
+	return location
+}
+
+// WallClockIn reads the date and time of t as wall clock of the location. Drivers return timestamps without time zone
+// as UTC, no matter in which time zone they were written.
+func WallClockIn(t time.Time, location *time.Location) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), location)
+}
@@ -0,0 +1,170 @@
+package database
+
+import (
+	"api/utils/log"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLocation(t *testing.T) {
+	tests := []struct {
+		timezone  string
+		expected  string
+		expectErr bool
+	}{
+		{"", "UTC", false},
+		{"Europe/Berlin", "Europe/Berlin", false},
+		{TimezoneAuto, "", false},
+		{"Mars/Olympus", "", true},
+	}
+
+	for _, test := range tests {
+		location, err := Config{Timezone: test.timezone}.Location()
+		if (err != nil) != test.expectErr {
+			t.Errorf("Error for timezone %q. Expected: %v, Got: %v", test.timezone, test.expectErr, err)
+		}
+		name := ""
+		if location != nil {
+			name = location.String()
+		}
+		if name != test.expected {
+			t.Errorf("Location for timezone %q. Expected: %q, Got: %q", test.timezone, test.expected, name)
+		}
+	}
+}
+
+func TestWallClockIn(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("No time zone database available.")
+	}
+	// the driver returns the stored wall clock as UTC
+	stored := time.Date(2023, 7, 2, 12, 0, 0, 0, time.UTC)
+	// summer time, Berlin is two hours ahead of UTC
+	if got := WallClockIn(stored, berlin).UnixMilli(); got != stored.Add(-2*time.Hour).UnixMilli() {
+		t.Errorf("Summer time. Expected: %v, Got: %v", stored.Add(-2*time.Hour).UnixMilli(), got)
+	}
+	winter := time.Date(2023, 12, 2, 12, 0, 0, 0, time.UTC)
+	if got := WallClockIn(winter, berlin).UnixMilli(); got != winter.Add(-time.Hour).UnixMilli() {
+		t.Errorf("Winter time. Expected: %v, Got: %v", winter.Add(-time.Hour).UnixMilli(), got)
+	}
+}
+
+func TestNamedLocation(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skip("No time zone database available.")
+	}
+	tests := []struct {
+		zone     string
+		expected string
+	}{
+		{"Europe/Berlin", "Europe/Berlin"},
+		{"UTC", "UTC"},
+		{"CET", ""},
+		{"CEST", ""},
+		{"+01:00", ""},
+		{"Mars/Olympus", ""},
+	}
+
+	for _, test := range tests {
+		name := ""
+		if location := namedLocation(test.zone); location != nil {
+			name = location.String()
+		}
+		if name != test.expected {
+			t.Errorf("Location of zone %q. Expected: %q, Got: %q", test.zone, test.expected, name)
+		}
+	}
+}
+
+func TestClockFollowsDaylightSavingTime(t *testing.T) {
+	// the offset of a database in Berlin, before and after the switch to summer time
+	offsets := []int{3600, 7200}
+	var detectErr error
+	clock := NewClock(Config{Timezone: TimezoneAuto}, MysqlClock, log.Database)
+	clock.detectOffset = func(ctx context.Context) (int, error) {
+		if detectErr != nil {
+			return 0, detectErr
+		}
+		offset := offsets[0]
+		offsets = offsets[1:]
+		return offset, nil
+	}
+	clock.set(time.UTC, time.Now().Add(-offsetRecheckInterval), clock.detectOffset)
+	clock.Refresh(context.Background())
+
+	stored := time.Date(2024, 3, 31, 12, 0, 0, 0, time.UTC)
+	if got := WallClockIn(stored, clock.Location()); !got.Equal(stored.Add(-time.Hour)) {
+		t.Errorf("Winter time. Expected: %v, Got: %v", stored.Add(-time.Hour), got.UTC())
+	}
+	// the check is not due yet
+	clock.Refresh(context.Background())
+	if _, offset := time.Now().In(clock.Location()).Zone(); offset != 3600 || len(offsets) != 1 {
+		t.Errorf("Offset before the check. Expected: %v, Got: %v", 3600, offset)
+	}
+
+	// reading the location never detects the offset, only the refresh of the next tick does
+	clock.detectedAt = clock.detectedAt.Add(-offsetRecheckInterval)
+	if _, offset := time.Now().In(clock.Location()).Zone(); offset != 3600 || len(offsets) != 1 {
+		t.Errorf("Offset before the refresh. Expected: %v, Got: %v", 3600, offset)
+	}
+	clock.Refresh(context.Background())
+	if got := WallClockIn(stored, clock.Location()); !got.Equal(stored.Add(-2 * time.Hour)) {
+		t.Errorf("Summer time. Expected: %v, Got: %v", stored.Add(-2*time.Hour), got.UTC())
+	}
+
+	// a failed check keeps the offset
+	detectErr = errors.New("connection lost")
+	clock.detectedAt = clock.detectedAt.Add(-offsetRecheckInterval)
+	clock.Refresh(context.Background())
+	if _, offset := time.Now().In(clock.Location()).Zone(); offset != 7200 {
+		t.Errorf("Offset after a failed check. Expected: %v, Got: %v", 7200, offset)
+	}
+}
+
+func TestClockOfConfiguredTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Berlin"); err != nil {
+		t.Skip("No time zone database available.")
+	}
+	// named zones change their offset by themselves and are never detected again
+	clock := NewClock(Config{Timezone: "Europe/Berlin"}, PostgresClock, log.Database)
+	winter := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	summer := time.Date(2024, 7, 15, 12, 0, 0, 0, time.UTC)
+	if got := WallClockIn(winter, clock.Location()); !got.Equal(winter.Add(-time.Hour)) {
+		t.Errorf("Winter time. Expected: %v, Got: %v", winter.Add(-time.Hour), got.UTC())
+	}
+	if got := WallClockIn(summer, clock.Location()); !got.Equal(summer.Add(-2 * time.Hour)) {
+		t.Errorf("Summer time. Expected: %v, Got: %v", summer.Add(-2*time.Hour), got.UTC())
+	}
+	if !clock.detectedAt.IsZero() {
+		t.Errorf("Detection of a configured time zone. Expected: none, Got: %v", clock.detectedAt)
+	}
+}
+
+func TestClockLocationDuringRefresh(t *testing.T) {
+	querying, release := make(chan struct{}), make(chan struct{})
+	clock := NewClock(Config{Timezone: TimezoneAuto}, MysqlClock, log.Database)
+	clock.set(time.FixedZone("UTC+1h0m0s", 3600), time.Now().Add(-offsetRecheckInterval), func(ctx context.Context) (int, error) {
+		close(querying)
+		<-release
+		return 7200, nil
+	})
+
+	refreshed := make(chan struct{})
+	go func() {
+		clock.Refresh(context.Background())
+		close(refreshed)
+	}()
+	<-querying
+	// a slow database does not block the rows that are converted meanwhile
+	if _, offset := time.Now().In(clock.Location()).Zone(); offset != 3600 {
+		t.Errorf("Offset during the refresh. Expected: %v, Got: %v", 3600, offset)
+	}
+	close(release)
+	<-refreshed
+	if _, offset := time.Now().In(clock.Location()).Zone(); offset != 7200 {
+		t.Errorf("Offset after the refresh. Expected: %v, Got: %v", 7200, offset)
+	}
+}
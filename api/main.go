@@ -2,6 +2,7 @@ package main
 
 import (
 	"api/config"
+	"api/service"
 	"api/utils/log"
 	"api/utils/mail"
 	"api/utils/observer"
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 )
 
@@ -107,9 +109,16 @@ func ListenToSystemSignals(dependencies *config.Dependencies) *chan bool {
 
 		if sig == syscall.SIGTERM || sig == syscall.SIGINT {
 			log.Info(fmt.Sprintf("Received system signal: %s", sig.String()), log.Main)
+			// the services drain their websocket clients in parallel, so the drain timeouts do not add up
+			var stopped sync.WaitGroup
 			for _, controller := range dependencies.HatnoteServiceController {
-				controller.StopService()
+				stopped.Add(1)
+				go func(controller service.ServiceInterface) {
+					defer stopped.Done()
+					controller.StopService()
+				}(controller)
 			}
+			stopped.Wait()
 			dependencies.InstitutesDataController.StopPeriodicSync()
 			logMessage := "Application stopped."
 			log.Info(logMessage, log.Main)
@@ -2,7 +2,9 @@ package bloxberg
 
 import (
 	"api/database"
+	"api/service"
 	"api/utils/log"
+	"context"
 	"encoding/hex"
 	"fmt"
 	"github.com/jmoiron/sqlx"
@@ -11,20 +13,20 @@ import (
 )
 
 type Database struct {
-	db           *sqlx.DB
-	Config       database.Config
-	isConnecting bool
+	database.Push // notifications of the push mode
+	db            *sqlx.DB
+	Config        database.Config
+	isConnecting  bool
+	clock         *database.Clock
 }
+
 type DatabaseInterface interface {
-	Init() error
-	IsInitialised() bool
-	IsConnecting() bool
-	SetIsConnecting(bool)
-	Ping() error
-	CloseConnection() error
-	LoadBlocks(fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error)
-	LoadConfirmedTransactions(fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error)
-	LoadLicensedContributors(fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error)
+	service.Database
+	// Location is the time zone of the timestamp columns, the timepoint strings are formatted in it
+	Location() *time.Location
+	LoadBlocks(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error)
+	LoadConfirmedTransactions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error)
+	LoadLicensedContributors(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error)
 }
 
 func (dbc *Database) Init() error {
@@ -37,17 +39,38 @@ func (dbc *Database) Init() error {
 	if err != nil {
 		dbc.db = nil
 		dbc.isConnecting = false
-		logMessage := "Can not connect to Minerva DB"
+		logMessage := "Can not connect to Bloxberg DB"
 		log.Error(logMessage, err, log.Bloxberg, log.Database)
 		return err
 	}
 
+	if dbc.clock == nil {
+		dbc.clock = database.NewClock(dbc.Config, database.PostgresClock, log.Bloxberg)
+	}
+	dbc.clock.Connect(db)
 	dbc.isConnecting = false
 	dbc.db = db
+	dbc.StartPush(db, dataSourceName, dbc.Config.Push, pushTables, log.Bloxberg)
 
 	return err
 }
 
+// tables with notify triggers in push mode
+var pushTables = []string{"blocks", "transactions", "address_names"}
+
+func (dbc *Database) Location() *time.Location {
+	if dbc.clock == nil {
+		return time.UTC
+	}
+	return dbc.clock.Location()
+}
+
+func (dbc *Database) RefreshLocation(ctx context.Context) {
+	if dbc.clock != nil {
+		dbc.clock.Refresh(ctx)
+	}
+}
+
 func (dbc *Database) IsInitialised() bool {
 	if dbc.db == nil {
 		return false
@@ -64,22 +87,23 @@ func (dbc *Database) SetIsConnecting(isConnecting bool) {
 	dbc.isConnecting = isConnecting
 }
 
-func (dbc *Database) Ping() error {
-	return dbc.db.Ping()
+func (dbc *Database) Ping(ctx context.Context) error {
+	return dbc.db.PingContext(ctx)
 }
 
 func (dbc *Database) CloseConnection() error {
 	log.Warn("Closing Bloxberg DB connection.", log.Bloxberg, log.Database)
 	err := dbc.db.Close()
 	if err != nil {
-		log.Error("Can not close Minerva DB connection", err, log.Bloxberg, log.Database)
+		log.Error("Can not close Bloxberg DB connection", err, log.Bloxberg, log.Database)
 	}
 	dbc.db = nil
+	dbc.StopPush()
 
 	return err
 }
 
-func (dbc *Database) LoadBlocks(fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error) {
+func (dbc *Database) LoadBlocks(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Bloxberg DB not initialised.", log.Bloxberg, log.Database)
 		return
@@ -88,18 +112,20 @@ func (dbc *Database) LoadBlocks(fromTimepoint string, toTimepoint string) (valid
 	bloxbergBlocks := []DBBlock{}
 
 	blocksQuery := fmt.Sprintf("%s%s%s%s%s%s",
-		"SELECT size, inserted_at, miner_hash, ("+
+		"SELECT a.hash, size, inserted_at, miner_hash, ("+
 			"SELECT name "+
 			"FROM address_names "+
 			"WHERE address_hash = a.miner_hash "+
 			") "+
 			"FROM blocks a "+
 			"WHERE inserted_at BETWEEN '", fromTimepoint, "' AND '", toTimepoint, "' ",
-		"ORDER BY inserted_at ASC")
+		"ORDER BY inserted_at ASC, a.hash ASC")
 
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "blocks")
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&bloxbergBlocks, blocksQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &bloxbergBlocks, blocksQuery)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
 		logMessage := fmt.Sprint("Query for loading bloxberg blocks took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
@@ -126,7 +152,7 @@ func (dbc *Database) LoadBlocks(fromTimepoint string, toTimepoint string) (valid
 		if err != nil {
 			log.Error("There was a problem converting bloxberg db string date to Time object", err, log.Bloxberg, log.Database)
 		}
-		TimestampMs := InsertedAt.UnixMilli()
+		TimestampMs := database.WallClockIn(InsertedAt, dbc.Location()).UnixMilli()
 
 		MinerName := ""
 		if block.Miner.Valid {
@@ -135,14 +161,14 @@ func (dbc *Database) LoadBlocks(fromTimepoint string, toTimepoint string) (valid
 
 		MinerHash := hex.EncodeToString(block.BlockMinerHash)
 
-		validBlock := ValidBlock{ByteSize: ByteSize, InsertedAt: TimestampMs, Miner: MinerName, MinerHash: MinerHash}
+		validBlock := ValidBlock{Hash: hex.EncodeToString(block.Hash), ByteSize: ByteSize, InsertedAt: TimestampMs, Miner: MinerName, MinerHash: MinerHash}
 		validData = append(validData, validBlock)
 	}
 
 	return
 }
 
-func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error) {
+func (dbc *Database) LoadConfirmedTransactions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Bloxberg DB not initialised.", log.Bloxberg, log.Database)
 		return
@@ -151,7 +177,7 @@ func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint
 	bloxbergConfirmedTransactions := []DBConfirmedTransaction{}
 
 	confirmedTransactionsQuery := fmt.Sprintf("%s%s%s%s%s%s",
-		"SELECT gas_price, gas_used, updated_at, ("+
+		"SELECT a.hash, gas_price, gas_used, updated_at, ("+
 			"SELECT (SELECT name "+
 			"FROM address_names "+
 			"WHERE address_hash = b.miner_hash"+
@@ -165,11 +191,13 @@ func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint
 			") "+
 			"FROM transactions a "+
 			"WHERE status=1 AND updated_at BETWEEN '", fromTimepoint, "' AND '", toTimepoint, "' ",
-		"ORDER BY updated_at ASC")
+		"ORDER BY updated_at ASC, a.hash ASC")
 
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "confirmedTransactions")
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&bloxbergConfirmedTransactions, confirmedTransactionsQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &bloxbergConfirmedTransactions, confirmedTransactionsQuery)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
 		logMessage := fmt.Sprint("Query for loading bloxberg confirmed transactions took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
@@ -207,7 +235,7 @@ func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint
 		if err != nil {
 			log.Error("There was a problem converting bloxberg db string date to Time object", err, log.Bloxberg, log.Database)
 		}
-		TimestampMs := UpdatedAt.UnixMilli()
+		TimestampMs := database.WallClockIn(UpdatedAt, dbc.Location()).UnixMilli()
 
 		BlockMiner := ""
 		if confirmedTransaction.BlockMiner.Valid {
@@ -216,7 +244,7 @@ func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint
 
 		BlockMinerHash := hex.EncodeToString(confirmedTransaction.BlockMinerHash)
 
-		validConfirmedTransaction := ValidConfirmedTransaction{TransactionFee: TransactionFee, UpdatedAt: TimestampMs,
+		validConfirmedTransaction := ValidConfirmedTransaction{Hash: hex.EncodeToString(confirmedTransaction.Hash), TransactionFee: TransactionFee, UpdatedAt: TimestampMs,
 			BlockMiner: BlockMiner, BlockMinerHash: BlockMinerHash}
 		validData = append(validData, validConfirmedTransaction)
 	}
@@ -224,7 +252,7 @@ func (dbc *Database) LoadConfirmedTransactions(fromTimepoint string, toTimepoint
 	return
 }
 
-func (dbc *Database) LoadLicensedContributors(fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error) {
+func (dbc *Database) LoadLicensedContributors(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Bloxberg DB not initialised.", log.Bloxberg, log.Database)
 		return
@@ -233,14 +261,16 @@ func (dbc *Database) LoadLicensedContributors(fromTimepoint string, toTimepoint
 	bloxbergLicensedContributors := []DBLicensedContributor{}
 
 	licensedContributorsQuery := fmt.Sprintf("%s%s%s%s%s%s",
-		"SELECT name, inserted_at "+
+		"SELECT address_hash, name, inserted_at "+
 			"FROM address_names "+
 			"WHERE \"primary\" IS TRUE AND inserted_at BETWEEN '", fromTimepoint, "' AND '", toTimepoint, "' ",
-		"ORDER BY inserted_at ASC")
+		"ORDER BY inserted_at ASC, address_hash ASC")
 
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "licensedContributors")
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&bloxbergLicensedContributors, licensedContributorsQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &bloxbergLicensedContributors, licensedContributorsQuery)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
 		logMessage := fmt.Sprint("Query for loading bloxberg LicensedContributors took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
@@ -258,9 +288,9 @@ func (dbc *Database) LoadLicensedContributors(fromTimepoint string, toTimepoint
 		if err != nil {
 			log.Error("There was a problem converting bloxberg db string date to Time object", err, log.Bloxberg, log.Database)
 		}
-		TimestampMs := InsertedAt.UnixMilli()
+		TimestampMs := database.WallClockIn(InsertedAt, dbc.Location()).UnixMilli()
 
-		validLicensedContributor := ValidLicensedContributor{InsertedAt: TimestampMs, Name: licensedContributor.Name}
+		validLicensedContributor := ValidLicensedContributor{AddressHash: hex.EncodeToString(licensedContributor.AddressHash), InsertedAt: TimestampMs, Name: licensedContributor.Name}
 		validData = append(validData, validLicensedContributor)
 	}
 
@@ -3,6 +3,7 @@ package bloxberg
 import (
 	"api/service"
 	"api/utils/log"
+	"context"
 	"github.com/jmoiron/sqlx"
 	"math/rand"
 	"time"
@@ -39,11 +40,17 @@ func (dbc *DatabaseMock) IsConnecting() bool {
 func (dbc *DatabaseMock) SetIsConnecting(isConnecting bool) {
 	return
 }
-func (dbc *DatabaseMock) Ping() error {
+func (dbc *DatabaseMock) Ping(ctx context.Context) error {
 	return nil
 }
 func (dbc *DatabaseMock) CloseConnection() error { return nil }
-func (dbc *DatabaseMock) LoadBlocks(fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error) {
+func (dbc *DatabaseMock) Location() *time.Location {
+	if dbc.location == nil {
+		return time.UTC
+	}
+	return dbc.location
+}
+func (dbc *DatabaseMock) LoadBlocks(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidBlock, queryError error) {
 	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
 	if dbc.location == nil {
 		log.Warn("database time location is nil", log.Bloxberg, log.Mock, log.Database)
@@ -92,7 +99,7 @@ func (dbc *DatabaseMock) LoadBlocks(fromTimepoint string, toTimepoint string) (v
 	return
 }
 
-func (dbc *DatabaseMock) LoadConfirmedTransactions(fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error) {
+func (dbc *DatabaseMock) LoadConfirmedTransactions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidConfirmedTransaction, queryError error) {
 	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
 	if dbc.location == nil {
 		log.Warn("database time location is nil", log.Bloxberg, log.Mock, log.Database)
@@ -122,7 +129,7 @@ func (dbc *DatabaseMock) LoadConfirmedTransactions(fromTimepoint string, toTimep
 	return
 }
 
-func (dbc *DatabaseMock) LoadLicensedContributors(fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error) {
+func (dbc *DatabaseMock) LoadLicensedContributors(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLicensedContributor, queryError error) {
 	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
 	if dbc.location == nil {
 		log.Warn("database time location is nil", log.Bloxberg, log.Mock, log.Database)
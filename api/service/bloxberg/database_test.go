@@ -6,6 +6,7 @@ package bloxberg
 
 import (
 	"api/database"
+	"context"
 	"testing"
 )
 
@@ -29,7 +30,7 @@ func TestLoadBlocks(t *testing.T) {
 		t.Errorf("bloxberg db could not be initiated. Error: %v", err)
 	}
 
-	blocks, _ := dbc.LoadBlocks("2023-08-12 09:04:05", "2023-08-12 10:04:05")
+	blocks, _ := dbc.LoadBlocks(context.Background(), "2023-08-12 09:04:05", "2023-08-12 10:04:05")
 	if "Fraunhofer Institute for Applied Information Technology FIT" != blocks[0].Miner {
 		t.Errorf("First entry should have a miner. Expected: %v, Got: %v", "Fraunhofer Institute for Applied Information Technology FIT", blocks[0].Miner)
 	}
@@ -46,7 +47,7 @@ func TestLoadConfirmedTransactions(t *testing.T) {
 		t.Errorf("bloxberg db could not be initiated. Error: %v", err)
 	}
 
-	confirmedTransactions, _ := dbc.LoadConfirmedTransactions("2023-08-13 12:04:05", "2023-08-13 13:04:05")
+	confirmedTransactions, _ := dbc.LoadConfirmedTransactions(context.Background(), "2023-08-13 12:04:05", "2023-08-13 13:04:05")
 	if "University of West Attica Consert lab" != confirmedTransactions[0].BlockMiner {
 		t.Errorf("First entry should have a block miner. Expected: %v, Got: %v", "University of West Attica Consert lab", confirmedTransactions[0].BlockMiner)
 	}
@@ -63,7 +64,7 @@ func TestLoadLicensedContributors(t *testing.T) {
 		t.Errorf("bloxberg db could not be initiated. Error: %v", err)
 	}
 
-	licensedContributors, _ := dbc.LoadLicensedContributors("2020-08-13 12:04:05", "2023-08-13 12:04:05")
+	licensedContributors, _ := dbc.LoadLicensedContributors(context.Background(), "2020-08-13 12:04:05", "2023-08-13 12:04:05")
 	if "Mendel University in Brno" != licensedContributors[0].Name {
 		t.Errorf("First entry should have a name. Expected: %v, Got: %v", "Mendel University in Brno", licensedContributors[0].Name)
 	}
@@ -3,6 +3,7 @@ package bloxberg
 import "database/sql"
 
 type DBBlock struct {
+	Hash       []byte        `db:"hash"`
 	ByteSize   sql.NullInt32 `db:"size"`
 	InsertedAt string        `db:"inserted_at"`
 	// while joining tables this could be NULL since it is not enforced to be there with a foreign key
@@ -11,6 +12,7 @@ type DBBlock struct {
 }
 
 type ValidBlock struct {
+	Hash       string
 	ByteSize   int32
 	InsertedAt int64
 	Miner      string
@@ -18,6 +20,7 @@ type ValidBlock struct {
 }
 
 type DBConfirmedTransaction struct {
+	Hash      []byte          `db:"hash"`
 	GasPrice  sql.NullFloat64 `db:"gas_price"`
 	GasUsed   sql.NullFloat64 `db:"gas_used"`
 	UpdatedAt string          `db:"updated_at"`
@@ -27,6 +30,7 @@ type DBConfirmedTransaction struct {
 }
 
 type ValidConfirmedTransaction struct {
+	Hash           string
 	TransactionFee float64
 	UpdatedAt      int64
 	BlockMiner     string
@@ -34,11 +38,13 @@ type ValidConfirmedTransaction struct {
 }
 
 type DBLicensedContributor struct {
-	InsertedAt string `db:"inserted_at"`
-	Name       string `db:"name"`
+	AddressHash []byte `db:"address_hash"`
+	InsertedAt  string `db:"inserted_at"`
+	Name        string `db:"name"`
 }
 
 type ValidLicensedContributor struct {
-	InsertedAt int64
-	Name       string
+	AddressHash string
+	InsertedAt  int64
+	Name        string
 }
@@ -0,0 +1,149 @@
+package bloxberg
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/service"
+	"api/utils/log"
+	"api/utils/mail"
+	"api/websocket"
+	"context"
+	"time"
+)
+
+func init() {
+	service.RegisterSource("bloxberg", service.SourceRegistration{
+		NewSource: func(config service.ServiceConfig, mockDatabase bool) service.Source {
+			if mockDatabase {
+				return &Source{DatabaseController: &DatabaseMock{Config: config}, MaxParallelQueries: config.Database.MaxParallelQueries}
+			}
+			return &Source{DatabaseController: &Database{Config: config.Database}, MaxParallelQueries: config.Database.MaxParallelQueries}
+		},
+		IntervalUnit: time.Millisecond,
+		MinInterval:  1000,
+		LogConcern:   log.Bloxberg,
+	})
+}
+
+type Source struct {
+	DatabaseController DatabaseInterface
+	MaxParallelQueries int // queries of a window that run at the same time
+	GeoController      geo.Controller
+	geoInformation     map[string]geo.Location
+}
+
+type rows struct {
+	blocks                []ValidBlock
+	confirmedTransactions []ValidConfirmedTransaction
+	licensedContributors  []ValidLicensedContributor
+}
+
+func (s *Source) Init(_ institutes.Controller, geoController geo.Controller) {
+	// geo controller
+	s.GeoController = geoController
+	s.loadGeoInformation()
+}
+
+func (s *Source) Database() service.Database {
+	return s.DatabaseController
+}
+
+func (s *Source) Load(ctx context.Context, window service.Window) (interface{}, error) {
+	// the timestamp columns are compared in the time zone of the database
+	location := s.DatabaseController.Location()
+	var fromTimePointStr = window.From.In(location).Format(time.DateTime)
+	var toTimePointStr = window.To.In(location).Format(time.DateTime)
+
+	var loaded rows
+	err := service.RunQueries(ctx, s.MaxParallelQueries,
+		func(ctx context.Context) (queryError error) {
+			loaded.blocks, queryError = s.DatabaseController.LoadBlocks(ctx, fromTimePointStr, toTimePointStr)
+			return
+		},
+		func(ctx context.Context) (queryError error) {
+			loaded.confirmedTransactions, queryError = s.DatabaseController.LoadConfirmedTransactions(ctx, fromTimePointStr, toTimePointStr)
+			return
+		},
+		func(ctx context.Context) (queryError error) {
+			loaded.licensedContributors, queryError = s.DatabaseController.LoadLicensedContributors(ctx, fromTimePointStr, toTimePointStr)
+			return
+		})
+	return loaded, err
+}
+
+// Filter drops the rows of the lookback overlap that were already sent
+func (s *Source) Filter(loadedRows interface{}, fresh func(key service.RowKey) bool) interface{} {
+	loaded := loadedRows.(rows)
+	var freshRows rows
+	for _, block := range loaded.blocks {
+		if fresh(service.RowKey{Stream: "block", Timestamp: block.InsertedAt, Id: block.Hash}) {
+			freshRows.blocks = append(freshRows.blocks, block)
+		}
+	}
+	for _, confirmedTransaction := range loaded.confirmedTransactions {
+		if fresh(service.RowKey{Stream: "transaction", Timestamp: confirmedTransaction.UpdatedAt, Id: confirmedTransaction.Hash}) {
+			freshRows.confirmedTransactions = append(freshRows.confirmedTransactions, confirmedTransaction)
+		}
+	}
+	for _, licensedContributor := range loaded.licensedContributors {
+		if fresh(service.RowKey{Stream: "contributor", Timestamp: licensedContributor.InsertedAt, Id: licensedContributor.AddressHash}) {
+			freshRows.licensedContributors = append(freshRows.licensedContributors, licensedContributor)
+		}
+	}
+	return freshRows
+}
+
+func (s *Source) Map(loadedRows interface{}) interface{} {
+	loaded := loadedRows.(rows)
+	var websocketEventData websocket.BloxbergData
+
+	// create websocket data for blocks
+	for _, block := range loaded.blocks {
+		websocketEventData.Blocks = append(websocketEventData.Blocks, websocket.BloxbergBlock{
+			ByteSize:   block.ByteSize,
+			InsertedAt: block.InsertedAt,
+			Miner:      block.Miner,
+			MinerHash:  block.MinerHash,
+			Location:   s.geoInformation[block.MinerHash],
+		})
+	}
+
+	// create websocket data for ConfirmedTransaction
+	for _, confirmedTransaction := range loaded.confirmedTransactions {
+		websocketEventData.ConfirmedTransactions = append(websocketEventData.ConfirmedTransactions, websocket.BloxbergConfirmedTransaction{
+			TransactionFee: confirmedTransaction.TransactionFee,
+			UpdatedAt:      confirmedTransaction.UpdatedAt,
+			BlockMiner:     confirmedTransaction.BlockMiner,
+			BlockMinerHash: confirmedTransaction.BlockMinerHash,
+			Location:       s.geoInformation[confirmedTransaction.BlockMinerHash],
+		})
+	}
+
+	// create websocket data for licensedContributors
+	for _, licensedContributor := range loaded.licensedContributors {
+		websocketEventData.LicensedContributors = append(websocketEventData.LicensedContributors, websocket.BloxbergLicensedContributor{
+			InsertedAt: licensedContributor.InsertedAt,
+			Name:       licensedContributor.Name,
+		})
+	}
+
+	return websocketEventData
+}
+
+func (s *Source) UpdateInstitutesData() {}
+
+func (s *Source) UpdateGeoInformation() {
+	s.loadGeoInformation()
+}
+
+func (s *Source) loadGeoInformation() {
+	// no need to use mutex lock/unlock since the usage of the data is not sensible
+	var geoInformation, geoInformationErr = s.GeoController.Load("bloxberg-validators")
+	if geoInformationErr != nil {
+		logMessage := "Error while loading geo information data."
+		log.Error(logMessage, geoInformationErr, log.Bloxberg, log.Service)
+		mail.SendErrorMail(logMessage, geoInformationErr)
+	} else {
+		s.geoInformation = geoInformation
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/utils/log"
+	"api/utils/mail"
+	"fmt"
+)
+
+// Enrichment finds the institute names and world map locations of email domains. Sources and services embed it, their
+// Init, UpdateInstitutesData and UpdateGeoInformation are the ones of the Enrichment then.
+type Enrichment struct {
+	Concern              log.Concern // of the log messages, e.g. log.Keeper
+	InstitutesController institutes.Controller
+	InstitutesData       institutes.InstituteData
+	GeoController        geo.Controller
+	geoInformation       map[string]geo.Location
+}
+
+func (e *Enrichment) Init(institutesController institutes.Controller, geoController geo.Controller) {
+	// world map controller
+	e.GeoController = geoController
+	e.UpdateGeoInformation()
+	// institute controller
+	e.InstitutesController = institutesController
+	e.UpdateInstitutesData()
+}
+
+// InstituteName returns the institute name of the domain. Domains of several institutes and institutes without a name
+// fall back to the domain, unknown domains return domainDoesNotExist.
+func (e *Enrichment) InstituteName(domain string) (instituteName string, domainDoesNotExist bool) {
+	if _, exists := e.InstitutesData.DomainDuplicates[domain]; exists {
+		// email domain is a duplicate, without an ip address the institute can not be determined
+		return domain, false
+	}
+	institute, exists := e.InstitutesData.Institutes[domain]
+	if !exists {
+		log.Debug(fmt.Sprint("Domain ", domain, " does not exist in institute data."), e.Concern, log.Service)
+		return "", true
+	}
+	instituteName = institute.InstituteNameDe
+	if len(instituteName) == 0 {
+		// Inside the json file from rena.mpdl.mpg.de there was no institute name given for the domain.
+		// Fall back to just the domain
+		instituteName = domain
+	}
+	return instituteName, false
+}
+
+// IsInstituteDomain is true for the email domains of the institute data
+func (e *Enrichment) IsInstituteDomain(domain string) bool {
+	_, exists := e.InstitutesData.Institutes[domain]
+	return exists
+}
+
+// Location returns the world map location of the domain, the zero location if there is none
+func (e *Enrichment) Location(domain string) geo.Location {
+	return e.geoInformation[domain]
+}
+
+func (e *Enrichment) UpdateInstitutesData() {
+	// no need to use mutex lock/unlock since the usage of the data is not sensible
+	var institutesData, instituteErr = e.InstitutesController.Load()
+	if instituteErr != nil {
+		logMessage := "Error while loading institute data."
+		log.Error(logMessage, instituteErr, e.Concern, log.Service)
+		mail.SendErrorMail(logMessage, instituteErr)
+	} else {
+		e.InstitutesData = institutesData
+	}
+}
+
+func (e *Enrichment) UpdateGeoInformation() {
+	// no need to use mutex lock/unlock since the usage of the data is not sensible
+	var geoInformation, geoInformationErr = e.GeoController.Load("mpg-institutes")
+	if geoInformationErr != nil {
+		logMessage := "Error while loading geo information data."
+		log.Error(logMessage, geoInformationErr, e.Concern, log.Service)
+		mail.SendErrorMail(logMessage, geoInformationErr)
+	} else {
+		e.geoInformation = geoInformation
+	}
+}
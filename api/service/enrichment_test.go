@@ -0,0 +1,36 @@
+package service
+
+import (
+	"api/institutes"
+	"testing"
+)
+
+func TestEnrichmentInstituteName(t *testing.T) {
+	e := Enrichment{InstitutesData: institutes.InstituteData{
+		Institutes: map[string]*institutes.Institute{
+			"mpdl.mpg.de":  {InstituteNameDe: "MPDL"},
+			"nameless.de":  {},
+			"duplicate.de": {InstituteNameDe: "One of two"},
+		},
+		DomainDuplicates: map[string]struct{}{"duplicate.de": {}},
+	}}
+
+	tests := []struct {
+		domain                     string
+		expectedInstituteName      string
+		expectedDomainDoesNotExist bool
+	}{
+		{"mpdl.mpg.de", "MPDL", false},
+		{"nameless.de", "nameless.de", false},
+		{"duplicate.de", "duplicate.de", false},
+		{"unknown.de", "", true},
+	}
+
+	for _, test := range tests {
+		instituteName, domainDoesNotExist := e.InstituteName(test.domain)
+		if instituteName != test.expectedInstituteName || domainDoesNotExist != test.expectedDomainDoesNotExist {
+			t.Errorf("Institute name of %v. Expected: %v, %v, Got: %v, %v", test.domain, test.expectedInstituteName,
+				test.expectedDomainDoesNotExist, instituteName, domainDoesNotExist)
+		}
+	}
+}
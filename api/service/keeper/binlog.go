@@ -0,0 +1,478 @@
+package keeper
+
+import (
+	"api/database"
+	"api/database/binlog"
+	"api/service"
+	"api/utils/log"
+	"api/utils/mail"
+	"context"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	activityTable  = "seahub-db.Activity"
+	emailUserTable = "ccnet-db.EmailUser"
+	// inserted rows of a table waiting for their window, the oldest are dropped if the windows are not loaded
+	maxBufferedRows     = 10000
+	binlogRetryInterval = 5 * time.Second
+)
+
+var fileSizePattern = regexp.MustCompile(`"size": (\d+)`)
+
+// binlogRow is an inserted row waiting for the window it falls into
+type binlogRow struct {
+	Id            string
+	Timestamp     int64 // seconds
+	Email         string
+	OperationType string
+	ObjectType    string
+	OperationSize int64
+	taken         bool // returned with a window, rows that were not are late
+}
+
+// BinlogDatabase reads the inserts on the Activity and EmailUser tables from the binlog of the keeper database instead
+// of polling the tables. The rows are kept until the poller loads the window they fall into and every insert makes the
+// poller load right away. While the binlog stream is down the windows are polled like with Database. Shares and
+// downloads are not in the streamed tables, they are always polled.
+type BinlogDatabase struct {
+	Database
+	events           service.KeeperConfig // only the rows of turned on event types are kept
+	lock             sync.Mutex
+	fileOperations   []binlogRow
+	libraryCreations []binlogRow
+	activatedUsers   []binlogRow
+	fileDeletions    []binlogRow
+	renames          []binlogRow
+	columns          map[string][]string // column names of the tables in the order of the binlog
+	serverPublicKey  *rsa.PublicKey
+	tlsConfig        *tls.Config
+	notifications    chan struct{}
+	listening        atomic.Bool
+	stopTail         context.CancelFunc
+	tailDone         chan struct{}
+}
+
+func NewBinlogDatabase(config database.Config, events service.KeeperConfig) *BinlogDatabase {
+	// one pending notification is enough, the window covers every row inserted meanwhile
+	return &BinlogDatabase{Database: Database{Config: config, FileSizes: events.FileSizes}, events: events, notifications: make(chan struct{}, 1)}
+}
+
+func (dbc *BinlogDatabase) Init() error {
+	if err := dbc.Database.Init(); err != nil {
+		return err
+	}
+
+	ctx, cancel := dbc.Config.QueryContext(context.Background(), "binlogPosition")
+	defer cancel()
+	var err error
+	if file := dbc.Config.Binlog.ServerPublicKeyFile; len(file) > 0 && dbc.serverPublicKey == nil {
+		dbc.serverPublicKey, err = binlog.LoadPublicKey(file)
+	}
+	if binlogConfig := dbc.Config.Binlog; binlogConfig.TLS && err == nil {
+		dbc.tlsConfig, err = binlog.TLSConfig(dbc.Config.Host, binlogConfig.CaFile)
+	}
+	var columns map[string][]string
+	if err == nil {
+		columns, err = dbc.loadColumns(ctx)
+	}
+	var position binlog.Position
+	if err == nil {
+		position, err = binlog.CurrentPosition(ctx, dbc.db)
+	}
+	if err != nil {
+		log.Error("Can not start reading the Keeper DB binlog", err, log.Keeper, log.Database)
+		dbc.Database.CloseConnection()
+		return err
+	}
+
+	dbc.columns = columns
+	tailCtx, stopTail := context.WithCancel(context.Background())
+	dbc.stopTail = stopTail
+	dbc.tailDone = make(chan struct{})
+	go dbc.tail(tailCtx, position, dbc.tailDone)
+	return nil
+}
+
+func (dbc *BinlogDatabase) CloseConnection() error {
+	if dbc.stopTail != nil {
+		dbc.stopTail()
+		<-dbc.tailDone
+		dbc.stopTail = nil
+	}
+	dbc.lock.Lock()
+	dbc.fileOperations, dbc.libraryCreations, dbc.activatedUsers, dbc.fileDeletions, dbc.renames = nil, nil, nil, nil, nil
+	dbc.lock.Unlock()
+
+	return dbc.Database.CloseConnection()
+}
+
+func (dbc *BinlogDatabase) Notifications() <-chan struct{} {
+	return dbc.notifications
+}
+
+// IsListening is true while the binlog is streamed, otherwise the windows are polled
+func (dbc *BinlogDatabase) IsListening() bool {
+	return dbc.listening.Load()
+}
+
+// loadColumns loads the column names, the binlog only has the column types
+func (dbc *BinlogDatabase) loadColumns(ctx context.Context) (map[string][]string, error) {
+	columns := make(map[string][]string)
+	for _, table := range []string{activityTable, emailUserTable} {
+		schema, name, _ := strings.Cut(table, ".")
+		var names []string
+		err := dbc.db.SelectContext(ctx, &names, "SELECT COLUMN_NAME FROM information_schema.COLUMNS "+
+			"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", schema, name)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, errors.New(fmt.Sprint("table ", table, " does not exist"))
+		}
+		columns[table] = names
+	}
+	return columns, nil
+}
+
+// tail streams the binlog until the tail is stopped. A lost stream is resumed from its last position.
+func (dbc *BinlogDatabase) tail(ctx context.Context, position binlog.Position, done chan struct{}) {
+	defer close(done)
+	replica := binlog.Replica{
+		Address:                 net.JoinHostPort(dbc.Config.Host, strconv.Itoa(dbc.Config.Port)),
+		User:                    dbc.Config.User,
+		Password:                dbc.Config.Password,
+		ServerId:                dbc.Config.Binlog.ServerId,
+		Tables:                  []string{activityTable, emailUserTable},
+		ServerPublicKey:         dbc.serverPublicKey,
+		AllowPublicKeyRetrieval: dbc.Config.Binlog.AllowPublicKeyRetrieval,
+		TLS:                     dbc.tlsConfig,
+	}
+	for {
+		var err error
+		position, err = dbc.stream(ctx, replica, position)
+		dbc.listening.Store(false)
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, binlog.ErrUnsupportedEvent) {
+			// resuming would fail at the same event again
+			logMessage := "Can not read the Keeper DB binlog, e.g. binlog_transaction_compression is on. Polling from now on."
+			log.Error(logMessage, err, log.Keeper, log.Database)
+			mail.SendErrorMail(logMessage, err)
+			return
+		}
+		log.Error("Lost the Keeper DB binlog stream. Polling until it is resumed.", err, log.Keeper, log.Database)
+
+		var serverError *binlog.ServerError
+		if errors.As(err, &serverError) {
+			// e.g. the binlog file of the position was purged meanwhile, the polls cover the gap
+			if current, positionErr := binlog.CurrentPosition(ctx, dbc.db); positionErr == nil {
+				position = current
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(binlogRetryInterval):
+		}
+	}
+}
+
+// stream buffers the inserted rows until the stream fails or the tail is stopped and returns the position to resume from
+func (dbc *BinlogDatabase) stream(ctx context.Context, replica binlog.Replica, position binlog.Position) (binlog.Position, error) {
+	dumpCtx, cancel := dbc.Config.QueryContext(ctx, "binlogDump")
+	stream, err := replica.Dump(dumpCtx, position)
+	cancel()
+	if err != nil {
+		return position, err
+	}
+	stopped := make(chan struct{})
+	defer close(stopped)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-stopped:
+		}
+	}()
+	defer stream.Close()
+
+	log.Info(fmt.Sprint("Reading the Keeper DB binlog from ", position.File, ":", position.Offset, "."), log.Keeper, log.Database)
+	// the windows since the last stream were polled, rows left in the buffers are not late
+	dbc.lock.Lock()
+	dbc.fileOperations, dbc.libraryCreations, dbc.activatedUsers, dbc.fileDeletions, dbc.renames = nil, nil, nil, nil, nil
+	dbc.lock.Unlock()
+	dbc.listening.Store(true)
+	for {
+		row, err := stream.Next()
+		if err != nil {
+			return stream.Position(), err
+		}
+		dbc.buffer(ctx, row)
+	}
+}
+
+// buffer keeps the rows the polling queries would select
+func (dbc *BinlogDatabase) buffer(ctx context.Context, row binlog.Row) {
+	table := row.Schema + "." + row.Table
+	if len(dbc.columns[table]) != len(row.Values) {
+		// the table was altered since the column names were loaded
+		columns, err := dbc.loadColumns(ctx)
+		if err != nil || len(columns[table]) != len(row.Values) {
+			log.Warn(fmt.Sprint("Columns of ", table, " do not match the binlog. Skipping row."), log.Keeper, log.Database)
+			return
+		}
+		dbc.columns = columns
+	}
+	values := make(map[string]interface{})
+	for i, column := range dbc.columns[table] {
+		values[column] = row.Values[i]
+	}
+
+	switch table {
+	case activityTable:
+		timestamp, err := time.ParseInLocation(time.DateTime, asString(values["timestamp"]), dbc.Location())
+		if err != nil {
+			log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Database)
+			return
+		}
+		activity := binlogRow{Id: fmt.Sprint(values["id"]), Timestamp: timestamp.Unix(), Email: asString(values["op_user"]),
+			OperationType: asString(values["op_type"]), ObjectType: asString(values["obj_type"])}
+		detail := asString(values["detail"])
+		if size := fileSizePattern.FindStringSubmatch(detail); size != nil {
+			activity.OperationSize, _ = strconv.ParseInt(size[1], 10, 64)
+		}
+		switch activity.OperationType {
+		case "create", "edit":
+			if activity.ObjectType == "file" && !strings.Contains(detail, `"size": 0,`) {
+				dbc.append(&dbc.fileOperations, activity)
+			}
+			if activity.OperationType == "create" && asString(values["path"]) == "/" {
+				dbc.append(&dbc.libraryCreations, activity)
+			}
+		case "delete":
+			if dbc.events.FileDeletions && (activity.ObjectType == "file" || activity.ObjectType == "dir" || activity.ObjectType == "repo") {
+				dbc.append(&dbc.fileDeletions, activity)
+			}
+		case "rename", "move":
+			if dbc.events.Renames && (activity.ObjectType == "file" || activity.ObjectType == "dir") {
+				dbc.append(&dbc.renames, activity)
+			}
+		}
+	case emailUserTable:
+		if isActive, _ := values["is_active"].(int64); isActive != 1 {
+			return
+		}
+		ctime, _ := values["ctime"].(int64)
+		// ctime is in microseconds
+		dbc.append(&dbc.activatedUsers, binlogRow{Id: fmt.Sprint(values["id"]), Timestamp: ctime / 1000000, Email: asString(values["email"])})
+	default:
+		return
+	}
+
+	select {
+	case dbc.notifications <- struct{}{}:
+	default:
+	}
+}
+
+func (dbc *BinlogDatabase) append(buffer *[]binlogRow, row binlogRow) {
+	dbc.lock.Lock()
+	defer dbc.lock.Unlock()
+	if len(*buffer) >= maxBufferedRows {
+		log.Warn("Too many Keeper binlog rows waiting for their window. Dropping the oldest.", log.Keeper, log.Database)
+		*buffer = (*buffer)[1:]
+	}
+	*buffer = append(*buffer, row)
+}
+
+// take returns the rows of the window in the order of the polling queries. Rows before the window that no window
+// returned yet were committed late, they are returned with this window. The windows of the poller only move forward, so
+// the other rows before the window are dropped.
+func (dbc *BinlogDatabase) take(buffer *[]binlogRow, from int64, to int64) (rows []binlogRow) {
+	dbc.lock.Lock()
+	defer dbc.lock.Unlock()
+	var kept []binlogRow
+	for _, row := range *buffer {
+		if row.Timestamp <= to && (row.Timestamp >= from || !row.taken) {
+			rows = append(rows, row)
+			row.taken = true
+		}
+		if row.Timestamp >= from {
+			kept = append(kept, row)
+		}
+	}
+	*buffer = kept
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Timestamp < rows[j].Timestamp })
+	return
+}
+
+func (dbc *BinlogDatabase) LoadFileCreationsAndEditings(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error) {
+	if !dbc.IsListening() {
+		return dbc.Database.LoadFileCreationsAndEditings(ctx, fromTimepoint, toTimepoint)
+	}
+	from, to, queryError := dbc.parseWindow(fromTimepoint, toTimepoint)
+	if queryError != nil {
+		return
+	}
+
+	invitedFromDomains := make(map[string]string)
+	for _, row := range dbc.take(&dbc.fileOperations, from, to) {
+		invitedFromDomain, err := dbc.invitedFromDomain(ctx, row.Email, invitedFromDomains)
+		if err != nil {
+			return validData, err
+		}
+		validData = append(validData, ValidFileCreationAndEditing{Id: row.Id, OperationSize: row.OperationSize, OperationType: row.OperationType,
+			Timestamp: row.Timestamp, InvitedFromDomain: invitedFromDomain, UserDomain: emailDomain(row.Email)})
+	}
+	return
+}
+
+func (dbc *BinlogDatabase) LoadLibraryCreations(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error) {
+	if !dbc.IsListening() {
+		return dbc.Database.LoadLibraryCreations(ctx, fromTimepoint, toTimepoint)
+	}
+	from, to, queryError := dbc.parseWindow(fromTimepoint, toTimepoint)
+	if queryError != nil {
+		return
+	}
+
+	invitedFromDomains := make(map[string]string)
+	for _, row := range dbc.take(&dbc.libraryCreations, from, to) {
+		invitedFromDomain, err := dbc.invitedFromDomain(ctx, row.Email, invitedFromDomains)
+		if err != nil {
+			return validData, err
+		}
+		validData = append(validData, ValidLibraryCreation{Id: row.Id, Timestamp: row.Timestamp,
+			InvitedFromDomain: invitedFromDomain, UserDomain: emailDomain(row.Email)})
+	}
+	return
+}
+
+func (dbc *BinlogDatabase) LoadActivatedUsers(ctx context.Context, fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error) {
+	if !dbc.IsListening() {
+		return dbc.Database.LoadActivatedUsers(ctx, fromTimepointSeconds, toTimepointSeconds)
+	}
+
+	invitedFromDomains := make(map[string]string)
+	for _, row := range dbc.take(&dbc.activatedUsers, fromTimepointSeconds, toTimepointSeconds) {
+		invitedFromDomain, err := dbc.invitedFromDomain(ctx, row.Email, invitedFromDomains)
+		if err != nil {
+			return validData, err
+		}
+		validData = append(validData, ValidActivatedUser{Id: row.Id, Timestamp: row.Timestamp,
+			InvitedFromDomain: invitedFromDomain, UserDomain: emailDomain(row.Email)})
+	}
+	return
+}
+
+func (dbc *BinlogDatabase) LoadFileDeletions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDeletion, queryError error) {
+	if !dbc.IsListening() {
+		return dbc.Database.LoadFileDeletions(ctx, fromTimepoint, toTimepoint)
+	}
+	from, to, queryError := dbc.parseWindow(fromTimepoint, toTimepoint)
+	if queryError != nil {
+		return
+	}
+
+	invitedFromDomains := make(map[string]string)
+	for _, row := range dbc.take(&dbc.fileDeletions, from, to) {
+		invitedFromDomain, err := dbc.invitedFromDomain(ctx, row.Email, invitedFromDomains)
+		if err != nil {
+			return validData, err
+		}
+		validData = append(validData, ValidFileDeletion{Id: row.Id, ObjectType: row.ObjectType, OperationSize: row.OperationSize,
+			Timestamp: row.Timestamp, InvitedFromDomain: invitedFromDomain, UserDomain: emailDomain(row.Email)})
+	}
+	return
+}
+
+func (dbc *BinlogDatabase) LoadRenames(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidRename, queryError error) {
+	if !dbc.IsListening() {
+		return dbc.Database.LoadRenames(ctx, fromTimepoint, toTimepoint)
+	}
+	from, to, queryError := dbc.parseWindow(fromTimepoint, toTimepoint)
+	if queryError != nil {
+		return
+	}
+
+	invitedFromDomains := make(map[string]string)
+	for _, row := range dbc.take(&dbc.renames, from, to) {
+		invitedFromDomain, err := dbc.invitedFromDomain(ctx, row.Email, invitedFromDomains)
+		if err != nil {
+			return validData, err
+		}
+		validData = append(validData, ValidRename{Id: row.Id, ObjectType: row.ObjectType, OperationType: row.OperationType,
+			OperationSize: row.OperationSize, Timestamp: row.Timestamp, InvitedFromDomain: invitedFromDomain, UserDomain: emailDomain(row.Email)})
+	}
+	return
+}
+
+func (dbc *BinlogDatabase) parseWindow(fromTimepoint string, toTimepoint string) (from int64, to int64, err error) {
+	fromTime, err := time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		return
+	}
+	toTime, err := time.ParseInLocation(time.DateTime, toTimepoint, dbc.Location())
+	return fromTime.Unix(), toTime.Unix(), err
+}
+
+// invitedFromDomain is the domain of the last inviter of the user, like invited_from_domain of the polling queries
+func (dbc *BinlogDatabase) invitedFromDomain(ctx context.Context, email string, invitedFromDomains map[string]string) (string, error) {
+	if invitedFromDomain, exists := invitedFromDomains[email]; exists {
+		return invitedFromDomain, nil
+	}
+	if dbc.db == nil {
+		log.Warn("Keeper DB not initialised.", log.Keeper, log.Database)
+		return "", nil
+	}
+
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "inviters")
+	defer cancel()
+	var inviters []string
+	queryError := dbc.db.SelectContext(queryCtx, &inviters, "SELECT inviter FROM `seahub-db`.invitations_invitation "+
+		"WHERE accepter = ? ORDER BY accept_time DESC LIMIT 1", email)
+	if queryError != nil {
+		log.Error("Error while loading the inviter of a keeper user.", queryError, log.Keeper, log.Database)
+		return "", queryError
+	}
+	invitedFromDomain := ""
+	if len(inviters) > 0 {
+		// like REGEXP_REPLACE(inviter, '.+(?=@).', '')
+		invitedFromDomain = inviters[0][strings.LastIndex(inviters[0], "@")+1:]
+	}
+	invitedFromDomains[email] = invitedFromDomain
+	return invitedFromDomain, nil
+}
+
+// emailDomain is the part after the @, like SUBSTRING(email, POSITION('@' IN email) + 1)
+func emailDomain(email string) string {
+	_, domain, found := strings.Cut(email, "@")
+	if !found {
+		return email
+	}
+	return domain
+}
+
+func asString(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return typed
+	case []byte:
+		return string(typed)
+	default:
+		return ""
+	}
+}
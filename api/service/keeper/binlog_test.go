@@ -0,0 +1,140 @@
+package keeper
+
+import (
+	"api/database"
+	"api/database/binlog"
+	"api/service"
+	"api/utils/log"
+	"context"
+	"testing"
+)
+
+func newTestBinlogDatabase() *BinlogDatabase {
+	dbc := NewBinlogDatabase(database.Config{Timezone: "Europe/Berlin"}, service.KeeperConfig{FileDeletions: true, Renames: true})
+	dbc.columns = map[string][]string{
+		activityTable:  {"id", "op_type", "op_user", "obj_type", "timestamp", "repo_id", "commit_id", "path", "detail"},
+		emailUserTable: {"id", "email", "passwd", "is_staff", "is_active", "ctime", "reference_id"},
+	}
+	dbc.listening.Store(true)
+	return dbc
+}
+
+func activity(id int64, opType string, objType string, timestamp string, path string, detail string) binlog.Row {
+	return binlog.Row{Schema: "seahub-db", Table: "Activity",
+		Values: []interface{}{id, opType, "user@mpdl.mpg.de", objType, timestamp, "repo", nil, path, detail}}
+}
+
+func TestBinlogDatabaseBuffersRowsOfPollingQueries(t *testing.T) {
+	dbc := newTestBinlogDatabase()
+	dbc.clock = database.NewClock(dbc.Config, database.MysqlClock, log.Keeper)
+	ctx := context.Background()
+
+	dbc.buffer(ctx, activity(1, "create", "file", "2024-05-06 10:00:01", "/a.txt", `{"size": 12, "name": "a.txt"}`))
+	dbc.buffer(ctx, activity(2, "edit", "file", "2024-05-06 10:00:02", "/a.txt", `{"size": 0, "name": "a.txt"}`))
+	dbc.buffer(ctx, activity(3, "create", "repo", "2024-05-06 10:00:03", "/", `{}`))
+	dbc.buffer(ctx, activity(4, "delete", "file", "2024-05-06 10:00:04", "/a.txt", `{"size": 12}`))
+	dbc.buffer(ctx, activity(5, "create", "file", "2024-05-06 11:00:00", "/b.txt", `{"size": 7}`))
+	dbc.buffer(ctx, binlog.Row{Schema: "ccnet-db", Table: "EmailUser", Values: []interface{}{int64(6), "new@mpdl.mpg.de", "", int64(0), int64(1), int64(1714982403000000), nil}})
+	dbc.buffer(ctx, binlog.Row{Schema: "ccnet-db", Table: "EmailUser", Values: []interface{}{int64(7), "inactive@mpdl.mpg.de", "", int64(0), int64(0), int64(1714982403000000), nil}})
+
+	select {
+	case <-dbc.Notifications():
+	default:
+		t.Errorf("Inserted rows did not notify.")
+	}
+
+	fileOperations, err := dbc.LoadFileCreationsAndEditings(ctx, "2024-05-06 10:00:00", "2024-05-06 10:59:59")
+	if err != nil || len(fileOperations) != 1 {
+		t.Fatalf("File creations and editings of the window. Expected: 1, Got: %v, %v", fileOperations, err)
+	}
+	// the timestamps are in the timezone of the database
+	if operation := fileOperations[0]; operation.Id != "1" || operation.OperationSize != 12 || operation.Timestamp != 1714982401 || operation.UserDomain != "mpdl.mpg.de" {
+		t.Errorf("File creation. Expected: 1, 12, 1714982401, mpdl.mpg.de, Got: %v, %v, %v, %v", operation.Id, operation.OperationSize, operation.Timestamp, operation.UserDomain)
+	}
+
+	libraryCreations, _ := dbc.LoadLibraryCreations(ctx, "2024-05-06 10:00:00", "2024-05-06 10:59:59")
+	if len(libraryCreations) != 1 || libraryCreations[0].Id != "3" {
+		t.Errorf("Library creations of the window. Expected: 3, Got: %v", libraryCreations)
+	}
+
+	activatedUsers, _ := dbc.LoadActivatedUsers(ctx, 1714982400, 1714985999)
+	if len(activatedUsers) != 1 || activatedUsers[0].Id != "6" || activatedUsers[0].Timestamp != 1714982403 {
+		t.Errorf("Activated users of the window. Expected: 6 at 1714982403, Got: %v", activatedUsers)
+	}
+
+	// rows before the next window are dropped, rows after it are kept
+	fileOperations, _ = dbc.LoadFileCreationsAndEditings(ctx, "2024-05-06 10:30:00", "2024-05-06 11:00:00")
+	if len(fileOperations) != 1 || fileOperations[0].Id != "5" || len(dbc.fileOperations) != 1 {
+		t.Errorf("File creations of the next window. Expected: 5 and 1 buffered, Got: %v and %v buffered", fileOperations, len(dbc.fileOperations))
+	}
+}
+
+func TestBinlogDatabaseReturnsLateRows(t *testing.T) {
+	dbc := newTestBinlogDatabase()
+	dbc.clock = database.NewClock(dbc.Config, database.MysqlClock, log.Keeper)
+	ctx := context.Background()
+
+	dbc.buffer(ctx, activity(1, "create", "file", "2024-05-06 10:00:01", "/a.txt", `{"size": 12}`))
+	if fileOperations, _ := dbc.LoadFileCreationsAndEditings(ctx, "2024-05-06 10:00:00", "2024-05-06 10:00:10"); len(fileOperations) != 1 {
+		t.Fatalf("File creations of the first window. Expected: 1, Got: %v", fileOperations)
+	}
+
+	// committed after its window was loaded, with a timestamp before the next window
+	dbc.buffer(ctx, activity(2, "create", "file", "2024-05-06 10:00:05", "/b.txt", `{"size": 7}`))
+	dbc.buffer(ctx, activity(3, "create", "file", "2024-05-06 10:00:15", "/c.txt", `{"size": 7}`))
+	fileOperations, _ := dbc.LoadFileCreationsAndEditings(ctx, "2024-05-06 10:00:10", "2024-05-06 10:00:20")
+	if len(fileOperations) != 2 || fileOperations[0].Id != "2" || fileOperations[1].Id != "3" {
+		t.Errorf("File creations of the next window. Expected: the late 2 and 3, Got: %v", fileOperations)
+	}
+	if fileOperations, _ = dbc.LoadFileCreationsAndEditings(ctx, "2024-05-06 10:00:20", "2024-05-06 10:00:30"); len(fileOperations) != 0 {
+		t.Errorf("File creations of the window after. Expected: none, Got: %v", fileOperations)
+	}
+}
+
+func TestEmailDomain(t *testing.T) {
+	tests := []struct {
+		email    string
+		expected string
+	}{
+		{"user@mpdl.mpg.de", "mpdl.mpg.de"},
+		{"user@host@mpg.de", "host@mpg.de"},
+		{"user", "user"},
+	}
+
+	for _, test := range tests {
+		if domain := emailDomain(test.email); domain != test.expected {
+			t.Errorf("Domain of %v. Expected: %v, Got: %v", test.email, test.expected, domain)
+		}
+	}
+}
+
+func TestBinlogDatabaseBuffersTurnedOnEventTypes(t *testing.T) {
+	dbc := newTestBinlogDatabase()
+	dbc.clock = database.NewClock(dbc.Config, database.MysqlClock, log.Keeper)
+	ctx := context.Background()
+
+	dbc.buffer(ctx, activity(1, "delete", "file", "2024-05-06 10:00:01", "/a.txt", `{"size": 12}`))
+	dbc.buffer(ctx, activity(2, "delete", "repo", "2024-05-06 10:00:02", "/", `{}`))
+	dbc.buffer(ctx, activity(3, "rename", "dir", "2024-05-06 10:00:03", "/b", `{"old_path": "/a"}`))
+	dbc.buffer(ctx, activity(4, "move", "file", "2024-05-06 10:00:04", "/b/a.txt", `{"size": 7, "old_path": "/a.txt"}`))
+	dbc.buffer(ctx, activity(5, "recover", "file", "2024-05-06 10:00:05", "/a.txt", `{"size": 12}`))
+
+	fileDeletions, _ := dbc.LoadFileDeletions(ctx, "2024-05-06 10:00:00", "2024-05-06 10:59:59")
+	if len(fileDeletions) != 2 || fileDeletions[0].OperationSize != 12 || fileDeletions[1].ObjectType != "repo" {
+		t.Errorf("File deletions of the window. Expected: file of 12 bytes and repo, Got: %v", fileDeletions)
+	}
+	renames, _ := dbc.LoadRenames(ctx, "2024-05-06 10:00:00", "2024-05-06 10:59:59")
+	if len(renames) != 2 || renames[0].OperationType != "rename" || renames[1].OperationType != "move" || renames[1].OperationSize != 7 {
+		t.Errorf("Renames of the window. Expected: rename and move of 7 bytes, Got: %v", renames)
+	}
+
+	// turned off event types are not kept, nobody would take them from the buffer
+	dbc.events = service.KeeperConfig{}
+	bufferedFileDeletions, bufferedRenames := len(dbc.fileDeletions), len(dbc.renames)
+	dbc.buffer(ctx, activity(6, "delete", "file", "2024-05-06 10:00:06", "/a.txt", `{"size": 12}`))
+	dbc.buffer(ctx, activity(7, "rename", "file", "2024-05-06 10:00:07", "/c.txt", `{"size": 12}`))
+	if len(dbc.fileDeletions) != bufferedFileDeletions || len(dbc.renames) != bufferedRenames {
+		t.Errorf("Buffered rows of turned off event types. Expected: %v and %v, Got: %v and %v", bufferedFileDeletions, bufferedRenames,
+			len(dbc.fileDeletions), len(dbc.renames))
+	}
+}
@@ -2,7 +2,9 @@ package keeper
 
 import (
 	"api/database"
+	"api/service"
 	"api/utils/log"
+	"context"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"time"
@@ -13,19 +15,23 @@ import (
 type Database struct {
 	db           *sqlx.DB
 	Config       database.Config
+	FileSizes    bool // looks up the sizes of shared and downloaded files, see service.KeeperConfig
 	isConnecting bool
+	clock        *database.Clock
 }
 
 type DatabaseInterface interface {
-	Init() error
-	IsInitialised() bool
-	IsConnecting() bool
-	SetIsConnecting(bool)
-	Ping() error
-	CloseConnection() error
-	LoadFileCreationsAndEditings(fromTimepoints string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error)
-	LoadLibraryCreations(fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error)
-	LoadActivatedUsers(fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error)
+	service.Database
+	// Location is the time zone of the DATETIME columns, the timepoint strings are formatted in it
+	Location() *time.Location
+	LoadFileCreationsAndEditings(ctx context.Context, fromTimepoints string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error)
+	LoadLibraryCreations(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error)
+	LoadActivatedUsers(ctx context.Context, fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error)
+	// the following event types are only loaded if they are turned on in the keeper config of the service
+	LoadFileDeletions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDeletion, queryError error)
+	LoadRenames(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidRename, queryError error)
+	LoadShares(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidShare, queryError error)
+	LoadFileDownloads(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDownload, queryError error)
 }
 
 func (dbc *Database) Init() error {
@@ -44,12 +50,29 @@ func (dbc *Database) Init() error {
 		return err
 	}
 
+	if dbc.clock == nil {
+		dbc.clock = database.NewClock(dbc.Config, database.MysqlClock, log.Keeper)
+	}
+	dbc.clock.Connect(db)
 	dbc.isConnecting = false
 	dbc.db = db
 
 	return err
 }
 
+func (dbc *Database) Location() *time.Location {
+	if dbc.clock == nil {
+		return time.UTC
+	}
+	return dbc.clock.Location()
+}
+
+func (dbc *Database) RefreshLocation(ctx context.Context) {
+	if dbc.clock != nil {
+		dbc.clock.Refresh(ctx)
+	}
+}
+
 func (dbc *Database) IsInitialised() bool {
 	if dbc.db == nil {
 		return false
@@ -66,8 +89,8 @@ func (dbc *Database) SetIsConnecting(isConnecting bool) {
 	dbc.isConnecting = isConnecting
 }
 
-func (dbc *Database) Ping() error {
-	return dbc.db.Ping()
+func (dbc *Database) Ping(ctx context.Context) error {
+	return dbc.db.PingContext(ctx)
 }
 
 func (dbc *Database) CloseConnection() error {
@@ -81,170 +104,204 @@ func (dbc *Database) CloseConnection() error {
 	return err
 }
 
-func (dbc *Database) LoadFileCreationsAndEditings(fromTimepoint string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error) {
+// eventQuery selects the columns of an event type together with the id, the email domain of the user and the domain of
+// the last inviter of the user. The table is aliased as t.
+func eventQuery(columns string, table string, userColumn string, where string, orderBy string) string {
+	return "SELECT " + columns + "," +
+		"REGEXP_REPLACE((SELECT inviter FROM `seahub-db`.invitations_invitation WHERE accepter = t." + userColumn + " " +
+		"ORDER BY accept_time DESC LIMIT 1), '.+(?=@).', '') as invited_from_domain," +
+		"SUBSTRING(t." + userColumn + ", POSITION('@' IN t." + userColumn + ") + 1) as domain " +
+		"FROM " + table + " t " +
+		"WHERE " + where + " " +
+		"ORDER BY " + orderBy
+}
+
+// sizeOfDetail selects the size in the json detail of Activity rows
+const sizeOfDetail = "IFNULL(CAST(SUBSTRING(REGEXP_SUBSTR(detail, '\"size\": \\\\d+'), 9) AS UNSIGNED), 0)"
+
+// fileSize selects the size of the latest Activity row of the file that has one. Seafile keeps the sizes of files in its
+// fs objects and not in sql, files without such a row, e.g. because the activities were cleaned, have the size 0. The
+// lookup runs for every row and scans the activities of the library, so it is only done if the file sizes are turned on.
+func (dbc *Database) fileSize(repoIdColumn string, pathColumn string) string {
+	if !dbc.FileSizes {
+		return "0"
+	}
+	return "IFNULL((SELECT " + sizeOfDetail + " FROM `seahub-db`.Activity a " +
+		"WHERE a.repo_id = t." + repoIdColumn + " AND a.path = t." + pathColumn + " AND a.obj_type = 'file' " +
+		"AND a.detail LIKE '%\"size\": %' ORDER BY a.timestamp DESC, a.id DESC LIMIT 1), 0)"
+}
+
+// load runs the query of an event type, name is the name of the query timeout and description the event type in the
+// log messages
+func load[Row any](ctx context.Context, dbc *Database, name string, description string, query string) (rows []Row, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Keeper DB not initialised.", log.Keeper, log.Database)
 		return
 	}
 
-	keeperFileOperations := []DBFileCreationAndEditing{}
-
-	fileOperationsQuery := fmt.Sprintf("%s%s%s%s%s%s",
-		"SELECT timestamp,"+
-			"REGEXP_REPLACE((SELECT inviter FROM `seahub-db`.invitations_invitation WHERE accepter = a.op_user "+
-			"ORDER BY accept_time DESC LIMIT 1), '.+(?=@).', '') as invited_from_domain,"+
-			"SUBSTRING(op_user, POSITION('@' IN op_user) + 1) as domain,"+
-			"op_type,"+
-			"CAST(SUBSTRING(REGEXP_SUBSTR(detail, '\"size\": \\\\d+'), 9) AS UNSIGNED) as size "+
-			"FROM `seahub-db`.Activity a "+
-			"WHERE op_type in ('create', 'edit') "+
-			"AND obj_type = 'file' "+
-			"AND detail not like '%\"size\": 0,%' "+
-			"AND timestamp BETWEEN '", fromTimepoint, "' AND '", toTimepoint, "' ",
-		"ORDER BY timestamp ASC")
-
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, name)
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&keeperFileOperations, fileOperationsQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &rows, query)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
-		logMessage := fmt.Sprint("Query for loading keeper file creations and editings took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
+		logMessage := fmt.Sprint("Query for loading keeper ", description, " took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
 		log.Warn(logMessage, log.Keeper, log.Database)
 	}
 	if queryError != nil {
-		logMessage := "Error while loading keeper file creations and editings."
+		logMessage := fmt.Sprint("Error while loading keeper ", description, ".")
 		log.Error(logMessage, queryError, log.Keeper, log.Database)
-		return validData, queryError
+		return nil, queryError
 	}
+	return
+}
 
-	// validate db data
-	for _, file_operation := range keeperFileOperations {
-		InvitedFromDomain := ""
-		if file_operation.InvitedFromDomain.Valid {
-			InvitedFromDomain = file_operation.InvitedFromDomain.String
-		}
+// timestamp converts a DATETIME of the database to unix seconds
+func (dbc *Database) timestamp(dbTimestamp string) int64 {
+	dbDateTime, err := time.ParseInLocation(time.DateTime, dbTimestamp, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Database)
+	}
+	return dbDateTime.Unix()
+}
 
-		dbDateTime, err := time.Parse(time.DateTime, file_operation.Timestamp)
-		if err != nil {
-			log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Database)
-		}
-		TimestampSec := dbDateTime.Unix()
+func operationSize(size int64) int64 {
+	if size < 0 {
+		log.Warn("OperationSize was smaller than 0. Setting it to 0.", log.Keeper, log.Database)
+		return 0
+	}
+	return size
+}
 
-		OperationSize := file_operation.OperationSize
-		if OperationSize < 0 {
-			OperationSize = 0
-			log.Warn("OperationSize was smaller than 0. Setting it to 0.", log.Keeper, log.Database)
-		}
+func (dbc *Database) LoadFileCreationsAndEditings(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error) {
+	fileOperations, queryError := load[DBFileCreationAndEditing](ctx, dbc, "fileCreationsAndEditings", "file creations and editings",
+		eventQuery("t.id, t.timestamp, t.op_type, CAST(SUBSTRING(REGEXP_SUBSTR(t.detail, '\"size\": \\\\d+'), 9) AS UNSIGNED) as size",
+			"`seahub-db`.Activity", "op_user",
+			"t.op_type in ('create', 'edit') AND t.obj_type = 'file' AND t.detail not like '%\"size\": 0,%' "+
+				"AND t.timestamp BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.timestamp ASC, t.id ASC"))
 
-		validFileOperation := ValidFileCreationAndEditing{InvitedFromDomain: InvitedFromDomain, OperationSize: OperationSize,
-			Timestamp: TimestampSec, UserDomain: file_operation.UserDomain, OperationType: file_operation.OperationType}
-		validData = append(validData, validFileOperation)
+	// validate db data
+	for _, fileOperation := range fileOperations {
+		validData = append(validData, ValidFileCreationAndEditing{Id: fileOperation.Id, InvitedFromDomain: fileOperation.invitedFromDomain(),
+			OperationSize: operationSize(fileOperation.OperationSize), Timestamp: dbc.timestamp(fileOperation.Timestamp),
+			UserDomain: fileOperation.UserDomain, OperationType: fileOperation.OperationType})
 	}
-
 	return
 }
 
-func (dbc *Database) LoadLibraryCreations(fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error) {
-	if dbc.db == nil {
-		log.Warn("Keeper DB not initialised.", log.Keeper, log.Database)
-		return
-	}
-
-	keeperLibraryCreations := []DBLibraryCreation{}
+func (dbc *Database) LoadLibraryCreations(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error) {
+	libraryCreations, queryError := load[DBLibraryCreation](ctx, dbc, "libraryCreations", "library creations",
+		eventQuery("t.id, t.timestamp", "`seahub-db`.Activity", "op_user",
+			"t.op_type = 'create' AND t.path = '/' AND t.timestamp BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.timestamp ASC, t.id ASC"))
 
-	libraryCreationsQuery := fmt.Sprintf("%s%s%s%s%s%s",
-		"SELECT timestamp as timestamp,"+
-			"REGEXP_REPLACE((SELECT inviter	FROM `seahub-db`.invitations_invitation	WHERE accepter = a.op_user "+
-			"ORDER BY accept_time DESC LIMIT 1), '.+(?=@).', '') as invited_from_domain,"+
-			"SUBSTRING(op_user, POSITION('@' IN op_user) + 1) as domain "+
-			"FROM `seahub-db`.Activity a "+
-			"WHERE op_type = 'create' AND path = '/' AND timestamp BETWEEN '", fromTimepoint, "' AND '", toTimepoint, "' ",
-		"ORDER BY timestamp ASC")
-
-	queryStart := time.Now()
-	// do the query
-	queryError = dbc.db.Select(&keeperLibraryCreations, libraryCreationsQuery)
-	queryElapsed := time.Since(queryStart)
-	if queryElapsed.Milliseconds() > 1000 {
-		logMessage := fmt.Sprint("Query for loading library creations took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
-		log.Warn(logMessage, log.Keeper, log.Database)
-	}
-	if queryError != nil {
-		logMessage := "Error while loading library creations."
-		log.Error(logMessage, queryError, log.Keeper, log.Database)
-		return validData, queryError
+	// validate db data
+	for _, libraryCreation := range libraryCreations {
+		validData = append(validData, ValidLibraryCreation{Id: libraryCreation.Id, InvitedFromDomain: libraryCreation.invitedFromDomain(),
+			Timestamp: dbc.timestamp(libraryCreation.Timestamp), UserDomain: libraryCreation.UserDomain})
 	}
+	return
+}
 
-	// validate db data
-	for _, library_creation := range keeperLibraryCreations {
-		InvitedFromDomain := ""
-		if library_creation.InvitedFromDomain.Valid {
-			InvitedFromDomain = library_creation.InvitedFromDomain.String
-		}
+func (dbc *Database) LoadActivatedUsers(ctx context.Context, fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error) {
+	activatedUsers, queryError := load[DBActivatedUser](ctx, dbc, "activatedUsers", "activated users",
+		eventQuery("t.id, floor(t.ctime/1000000) as timestamp", "`ccnet-db`.EmailUser", "email",
+			fmt.Sprint("t.is_active = 1 AND floor(t.ctime/1000000) BETWEEN '", fromTimepointSeconds, "' AND '", toTimepointSeconds, "'"),
+			"t.ctime ASC, t.id ASC"))
 
-		dbDateTime, err := time.Parse(time.DateTime, library_creation.Timestamp)
-		if err != nil {
-			log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Database)
+	// validate db data
+	for _, activatedUser := range activatedUsers {
+		Timestamp := activatedUser.Timestamp
+		if Timestamp < 0 {
+			Timestamp = 0
+			log.Warn("Timestamp was smaller than 0. Setting it to 0.", log.Keeper, log.Database)
 		}
-		TimestampSec := dbDateTime.Unix()
 
-		validLibraryCreation := ValidLibraryCreation{InvitedFromDomain: InvitedFromDomain,
-			Timestamp: TimestampSec, UserDomain: library_creation.UserDomain}
-		validData = append(validData, validLibraryCreation)
+		validData = append(validData, ValidActivatedUser{Id: activatedUser.Id, InvitedFromDomain: activatedUser.invitedFromDomain(),
+			Timestamp: Timestamp, UserDomain: activatedUser.UserDomain})
 	}
-
 	return
 }
 
-func (dbc *Database) LoadActivatedUsers(fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error) {
-	if dbc.db == nil {
-		log.Warn("Keeper DB not initialised.", log.Keeper, log.Database)
-		return
-	}
+func (dbc *Database) LoadFileDeletions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDeletion, queryError error) {
+	fileDeletions, queryError := load[DBFileDeletion](ctx, dbc, "fileDeletions", "file deletions",
+		eventQuery("t.id, t.timestamp, t.obj_type, "+sizeOfDetail+" as size", "`seahub-db`.Activity", "op_user",
+			"t.op_type = 'delete' AND t.obj_type in ('file', 'dir', 'repo') "+
+				"AND t.timestamp BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.timestamp ASC, t.id ASC"))
 
-	keeperActivatedUsers := []DBActivatedUser{}
+	// validate db data
+	for _, fileDeletion := range fileDeletions {
+		validData = append(validData, ValidFileDeletion{Id: fileDeletion.Id, ObjectType: fileDeletion.ObjectType,
+			OperationSize: operationSize(fileDeletion.OperationSize), Timestamp: dbc.timestamp(fileDeletion.Timestamp),
+			InvitedFromDomain: fileDeletion.invitedFromDomain(), UserDomain: fileDeletion.UserDomain})
+	}
+	return
+}
 
-	activatedUsersQuery := fmt.Sprintf("%s%d%s%s%s%s",
-		"SELECT floor(ctime/1000000) as timestamp,"+
-			"REGEXP_REPLACE((SELECT inviter "+
-			"FROM `seahub-db`.invitations_invitation WHERE accepter = t.email ORDER BY accept_time DESC "+
-			"LIMIT 1), '.+(?=@).', '') as invited_from_domain,"+
-			"SUBSTRING(email, POSITION('@' IN email) + 1) as domain "+
-			"FROM `ccnet-db`.EmailUser t "+
-			"WHERE is_active = 1 AND floor(ctime/1000000) BETWEEN '", fromTimepointSeconds, "' AND '", toTimepointSeconds, "' ",
-		"ORDER BY ctime ASC")
+func (dbc *Database) LoadRenames(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidRename, queryError error) {
+	renames, queryError := load[DBRename](ctx, dbc, "renames", "renames",
+		eventQuery("t.id, t.timestamp, t.obj_type, t.op_type, "+sizeOfDetail+" as size", "`seahub-db`.Activity", "op_user",
+			"t.op_type in ('rename', 'move') AND t.obj_type in ('file', 'dir') "+
+				"AND t.timestamp BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.timestamp ASC, t.id ASC"))
 
-	queryStart := time.Now()
-	// do the query
-	queryError = dbc.db.Select(&keeperActivatedUsers, activatedUsersQuery)
-	queryElapsed := time.Since(queryStart)
-	if queryElapsed.Milliseconds() > 1000 {
-		logMessage := fmt.Sprint("Query for loading activated users took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
-		log.Warn(logMessage, log.Keeper, log.Database)
-	}
-	if queryError != nil {
-		logMessage := "Error while loading activated users."
-		log.Error(logMessage, queryError, log.Keeper, log.Database)
-		return validData, queryError
+	// validate db data
+	for _, rename := range renames {
+		validData = append(validData, ValidRename{Id: rename.Id, ObjectType: rename.ObjectType, OperationType: rename.OperationType,
+			OperationSize: operationSize(rename.OperationSize), Timestamp: dbc.timestamp(rename.Timestamp),
+			InvitedFromDomain: rename.invitedFromDomain(), UserDomain: rename.UserDomain})
 	}
+	return
+}
+
+// LoadShares loads the created share links. The Activity table has no share events, seahub stores the links in
+// share_fileshare. Shared files have the size of their latest activity if the file sizes are turned on and shared
+// libraries the size of seafile. The sizes of other directories are not in sql, they are 0.
+func (dbc *Database) LoadShares(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidShare, queryError error) {
+	shares, queryError := load[DBShare](ctx, dbc, "shares", "shares",
+		eventQuery("t.id, t.ctime as timestamp, t.s_type, "+
+			"CASE WHEN t.s_type = 'f' THEN "+dbc.fileSize("repo_id", "path")+" "+
+			"WHEN t.path = '/' THEN IFNULL((SELECT r.size FROM `seafile-db`.RepoSize r WHERE r.repo_id = t.repo_id), 0) "+
+			"ELSE 0 END as size",
+			"`seahub-db`.share_fileshare", "username",
+			"t.ctime BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.ctime ASC, t.id ASC"))
 
 	// validate db data
-	for _, activated_user := range keeperActivatedUsers {
-		InvitedFromDomain := ""
-		if activated_user.InvitedFromDomain.Valid {
-			InvitedFromDomain = activated_user.InvitedFromDomain.String
-		}
+	for _, share := range shares {
+		validData = append(validData, ValidShare{Id: share.Id, ShareType: shareType(share.ShareType), OperationSize: operationSize(share.OperationSize),
+			Timestamp: dbc.timestamp(share.Timestamp), InvitedFromDomain: share.invitedFromDomain(), UserDomain: share.UserDomain})
+	}
+	return
+}
 
-		Timestamp := activated_user.Timestamp
-		if Timestamp < 0 {
-			Timestamp = 0
-			log.Warn("Timestamp was smaller than 0. Setting it to 0.", log.Keeper, log.Database)
-		}
+// LoadFileDownloads loads the downloads of the file audit log of seafevents, with the size of the latest activity of the
+// file if the file sizes are turned on. Downloads of share links without login have the user 'anonymous', they are attributed like guests.
+func (dbc *Database) LoadFileDownloads(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDownload, queryError error) {
+	fileDownloads, queryError := load[DBFileDownload](ctx, dbc, "fileDownloads", "file downloads",
+		eventQuery("t.eid as id, t.timestamp, t.etype, "+dbc.fileSize("repo_id", "file_path")+" as size", "`seahub-db`.FileAudit", "user",
+			"t.timestamp BETWEEN '"+fromTimepoint+"' AND '"+toTimepoint+"'",
+			"t.timestamp ASC, t.eid ASC"))
 
-		validActivatedUser := ValidActivatedUser{InvitedFromDomain: InvitedFromDomain,
-			Timestamp: Timestamp, UserDomain: activated_user.UserDomain}
-		validData = append(validData, validActivatedUser)
+	// validate db data
+	for _, fileDownload := range fileDownloads {
+		validData = append(validData, ValidFileDownload{Id: fileDownload.Id, DownloadType: fileDownload.DownloadType,
+			OperationSize: operationSize(fileDownload.OperationSize), Timestamp: dbc.timestamp(fileDownload.Timestamp),
+			InvitedFromDomain: fileDownload.invitedFromDomain(), UserDomain: fileDownload.UserDomain})
 	}
-
 	return
 }
+
+// shareType names the s_type of share_fileshare like the obj_type of the Activity table
+func shareType(sType string) string {
+	switch sType {
+	case "f":
+		return "file"
+	case "d":
+		return "dir"
+	}
+	return sType
+}
@@ -3,6 +3,7 @@ package keeper
 import (
 	"api/service"
 	"api/utils/log"
+	"context"
 	"github.com/jmoiron/sqlx"
 	"math/rand"
 	"time"
@@ -26,15 +27,16 @@ func (dbc *DatabaseMock) IsConnecting() bool {
 func (dbc *DatabaseMock) SetIsConnecting(isConnecting bool) {
 	return
 }
-func (dbc *DatabaseMock) Ping() error {
+func (dbc *DatabaseMock) Ping(ctx context.Context) error {
 	return nil
 }
 func (dbc *DatabaseMock) CloseConnection() error { return nil }
-func (dbc *DatabaseMock) LoadFileCreationsAndEditings(fromTimepoint string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error) {
+func (dbc *DatabaseMock) Location() *time.Location {
+	return time.UTC
+}
+func (dbc *DatabaseMock) LoadFileCreationsAndEditings(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileCreationAndEditing, queryError error) {
 	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
-	var fromTimePointTime, err = time.Parse(time.DateTime, fromTimepoint)
-	negativeServerTimeDifference := time.Duration(-2) * time.Hour
-	fromTimePointTime = fromTimePointTime.Add(negativeServerTimeDifference)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
 	if err != nil {
 		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Mock, log.Database)
 	}
@@ -130,7 +132,7 @@ func (dbc *DatabaseMock) LoadFileCreationsAndEditings(fromTimepoint string, toTi
 	return
 }
 
-func (dbc *DatabaseMock) LoadLibraryCreations(fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error) {
+func (dbc *DatabaseMock) LoadLibraryCreations(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidLibraryCreation, queryError error) {
 	//var minusTime = rand.Int63n(dbc.Config.QueryInterval)
 	//var fromTimePointTime, err = time.Parse(time.DateTime, fromTimepoint)
 	//if err != nil {
@@ -151,7 +153,7 @@ func (dbc *DatabaseMock) LoadLibraryCreations(fromTimepoint string, toTimepoint
 	return
 }
 
-func (dbc *DatabaseMock) LoadActivatedUsers(fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error) {
+func (dbc *DatabaseMock) LoadActivatedUsers(ctx context.Context, fromTimepointSeconds int64, toTimepointSeconds int64) (validData []ValidActivatedUser, queryError error) {
 	//var minusTime = rand.Int63n(dbc.Config.QueryInterval)
 	//validData = append(validData,
 	//	keeper.ValidActivatedUser{
@@ -174,3 +176,91 @@ func (dbc *DatabaseMock) LoadActivatedUsers(fromTimepointSeconds int64, toTimepo
 
 	return
 }
+
+func (dbc *DatabaseMock) LoadFileDeletions(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDeletion, queryError error) {
+	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Mock, log.Database)
+	}
+
+	validData = append(validData,
+		ValidFileDeletion{
+			InvitedFromDomain: "",
+			ObjectType:        "file",
+			OperationSize:     1392,
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "bbb.de"},
+		ValidFileDeletion{
+			InvitedFromDomain: "aaa.de",
+			ObjectType:        "dir",
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "gmail.com"},
+	)
+
+	return
+}
+
+func (dbc *DatabaseMock) LoadRenames(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidRename, queryError error) {
+	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Mock, log.Database)
+	}
+
+	validData = append(validData,
+		ValidRename{
+			InvitedFromDomain: "",
+			ObjectType:        "file",
+			OperationType:     "rename",
+			OperationSize:     40568,
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "aaa.de"},
+	)
+
+	return
+}
+
+func (dbc *DatabaseMock) LoadShares(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidShare, queryError error) {
+	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Mock, log.Database)
+	}
+
+	validData = append(validData,
+		ValidShare{
+			InvitedFromDomain: "",
+			ShareType:         "file",
+			OperationSize:     20784,
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "aaa.de"},
+	)
+
+	return
+}
+
+func (dbc *DatabaseMock) LoadFileDownloads(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidFileDownload, queryError error) {
+	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Keeper, log.Mock, log.Database)
+	}
+
+	validData = append(validData,
+		ValidFileDownload{
+			InvitedFromDomain: "",
+			DownloadType:      "web-file-download",
+			OperationSize:     4821,
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "bbb.de"},
+		ValidFileDownload{
+			InvitedFromDomain: "",
+			DownloadType:      "share-link-download",
+			OperationSize:     130554,
+			Timestamp:         fromTimePointTime.Unix() + plusTime,
+			UserDomain:        "anonymous"},
+	)
+
+	return
+}
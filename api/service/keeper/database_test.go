@@ -6,6 +6,7 @@ package keeper
 
 import (
 	"api/database"
+	"context"
 	"testing"
 	"time"
 )
@@ -18,7 +19,7 @@ func SetupKeeperDbTest() (db *Database, err error) {
 		Port:            0,
 		DBName:          "",
 		ReconnectTimout: 20,
-	}}
+	}, FileSizes: true}
 
 	err = db.Init()
 	return
@@ -30,7 +31,7 @@ func TestLoadFileCreationsAndEditings(t *testing.T) {
 		t.Errorf("Keeper db could not be initiated. Error: %v", err)
 	}
 
-	fce, _ := dbc.LoadFileCreationsAndEditings("2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	fce, _ := dbc.LoadFileCreationsAndEditings(context.Background(), "2023-07-02 09:04:05", "2023-07-02 10:04:05")
 	if "mpdl.mpg.de" != fce[0].UserDomain {
 		t.Errorf("First entry should have a user domain. Expected: %v, Got: %v", "mpdl.mpg.de", fce[0].UserDomain)
 	}
@@ -47,7 +48,7 @@ func TestLoadLibraryCreations(t *testing.T) {
 		t.Errorf("Keeper db could not be initiated. Error: %v", err)
 	}
 
-	libraryCreations, _ := dbc.LoadLibraryCreations("2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	libraryCreations, _ := dbc.LoadLibraryCreations(context.Background(), "2023-07-02 09:04:05", "2023-07-02 10:04:05")
 	if "mpdl.mpg.de" != libraryCreations[0].UserDomain {
 		t.Errorf("First entry should have a user domain. Expected: %v, Got: %v", "mpdl.mpg.de", libraryCreations[0].UserDomain)
 	}
@@ -66,7 +67,7 @@ func TestLoadActivatedUsers(t *testing.T) {
 
 	var fromTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 09:04:05")
 	var toTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 10:04:05")
-	activatedUsers, _ := dbc.LoadActivatedUsers(fromTimepoint.Unix(), toTimepoint.Unix())
+	activatedUsers, _ := dbc.LoadActivatedUsers(context.Background(), fromTimepoint.Unix(), toTimepoint.Unix())
 	if "in.tum.de" != activatedUsers[0].UserDomain {
 		t.Errorf("First entry should have a user domain. Expected: %v, Got: %v", "mpdl.mpg.de", activatedUsers[0].UserDomain)
 	}
@@ -76,3 +77,30 @@ func TestLoadActivatedUsers(t *testing.T) {
 		t.Errorf("Could not close db connection.")
 	}
 }
+
+func TestLoadOptionalEventTypes(t *testing.T) {
+	dbc, err := SetupKeeperDbTest()
+	if err != nil {
+		t.Errorf("Keeper db could not be initiated. Error: %v", err)
+	}
+
+	ctx := context.Background()
+	fileDeletions, err := dbc.LoadFileDeletions(ctx, "2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	if err != nil || len(fileDeletions) == 0 {
+		t.Errorf("File deletions should be loaded. Got: %v, %v", fileDeletions, err)
+	}
+	renames, err := dbc.LoadRenames(ctx, "2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	if err != nil || len(renames) == 0 {
+		t.Errorf("Renames should be loaded. Got: %v, %v", renames, err)
+	}
+	shares, err := dbc.LoadShares(ctx, "2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	if err != nil || len(shares) == 0 {
+		t.Errorf("Shares should be loaded. Got: %v, %v", shares, err)
+	}
+	fileDownloads, err := dbc.LoadFileDownloads(ctx, "2023-07-02 09:04:05", "2023-07-02 10:04:05")
+	if err != nil || len(fileDownloads) == 0 {
+		t.Errorf("File downloads should be loaded. Got: %v, %v", fileDownloads, err)
+	}
+
+	dbc.CloseConnection()
+}
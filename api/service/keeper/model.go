@@ -2,15 +2,29 @@ package keeper
 
 import "database/sql"
 
-type DBFileCreationAndEditing struct {
-	OperationSize     int64          `db:"size"`
-	OperationType     string         `db:"op_type"`
-	Timestamp         string         `db:"timestamp"`
+// DBEvent has the columns every query of eventQuery selects
+type DBEvent struct {
+	Id                string         `db:"id"`
 	InvitedFromDomain sql.NullString `db:"invited_from_domain"` // invited_from_domain column in subquery is nullable
 	UserDomain        string         `db:"domain"`
 }
 
+func (e DBEvent) invitedFromDomain() string {
+	if e.InvitedFromDomain.Valid {
+		return e.InvitedFromDomain.String
+	}
+	return ""
+}
+
+type DBFileCreationAndEditing struct {
+	DBEvent
+	OperationSize int64  `db:"size"`
+	OperationType string `db:"op_type"`
+	Timestamp     string `db:"timestamp"`
+}
+
 type ValidFileCreationAndEditing struct {
+	Id                string
 	OperationSize     int64
 	OperationType     string
 	Timestamp         int64
@@ -19,24 +33,90 @@ type ValidFileCreationAndEditing struct {
 }
 
 type DBLibraryCreation struct {
-	Timestamp         string         `db:"timestamp"`
-	InvitedFromDomain sql.NullString `db:"invited_from_domain"` // invited_from_domain column in subquery is nullable
-	UserDomain        string         `db:"domain"`
+	DBEvent
+	Timestamp string `db:"timestamp"`
 }
 
 type ValidLibraryCreation struct {
+	Id                string
 	Timestamp         int64
 	InvitedFromDomain string
 	UserDomain        string
 }
 
 type DBActivatedUser struct {
-	Timestamp         int64          `db:"timestamp"`
-	InvitedFromDomain sql.NullString `db:"invited_from_domain"` // invited_from_domain column in subquery is nullable
-	UserDomain        string         `db:"domain"`
+	DBEvent
+	Timestamp int64 `db:"timestamp"`
 }
 
 type ValidActivatedUser struct {
+	Id                string
+	Timestamp         int64
+	InvitedFromDomain string
+	UserDomain        string
+}
+
+type DBFileDeletion struct {
+	DBEvent
+	ObjectType    string `db:"obj_type"`
+	OperationSize int64  `db:"size"`
+	Timestamp     string `db:"timestamp"`
+}
+
+type ValidFileDeletion struct {
+	Id                string
+	ObjectType        string // file, dir or repo
+	OperationSize     int64
+	Timestamp         int64
+	InvitedFromDomain string
+	UserDomain        string
+}
+
+type DBRename struct {
+	DBEvent
+	ObjectType    string `db:"obj_type"`
+	OperationType string `db:"op_type"`
+	OperationSize int64  `db:"size"`
+	Timestamp     string `db:"timestamp"`
+}
+
+type ValidRename struct {
+	Id                string
+	ObjectType        string // file or dir
+	OperationType     string // rename or move
+	OperationSize     int64
+	Timestamp         int64
+	InvitedFromDomain string
+	UserDomain        string
+}
+
+type DBShare struct {
+	DBEvent
+	ShareType     string `db:"s_type"`
+	OperationSize int64  `db:"size"`
+	Timestamp     string `db:"timestamp"`
+}
+
+type ValidShare struct {
+	Id                string
+	ShareType         string // file or dir
+	OperationSize     int64  // of the shared file or library, 0 for other directories
+	Timestamp         int64
+	InvitedFromDomain string
+	UserDomain        string
+}
+
+type DBFileDownload struct {
+	DBEvent
+	DownloadType  string `db:"etype"`
+	OperationSize int64  `db:"size"`
+	Timestamp     string `db:"timestamp"`
+}
+
+type ValidFileDownload struct {
+	Id                string
+	DownloadType      string // e.g. web-file-download or share-link-download
+	OperationSize     int64
 	Timestamp         int64
 	InvitedFromDomain string
 	UserDomain        string
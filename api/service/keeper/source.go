@@ -0,0 +1,276 @@
+package keeper
+
+import (
+	"api/service"
+	"api/utils/log"
+	"api/websocket"
+	"context"
+	"time"
+)
+
+func init() {
+	service.RegisterSource("keeper", service.SourceRegistration{
+		NewSource: func(config service.ServiceConfig, mockDatabase bool) service.Source {
+			source := &Source{MaxParallelQueries: config.Database.MaxParallelQueries, Events: config.Keeper,
+				Enrichment: service.Enrichment{Concern: log.Keeper}}
+			if mockDatabase {
+				source.DatabaseController = &DatabaseMock{Config: config}
+			} else if config.Database.Binlog.IsEnabled() {
+				source.DatabaseController = NewBinlogDatabase(config.Database, config.Keeper)
+			} else {
+				source.DatabaseController = &Database{Config: config.Database, FileSizes: config.Keeper.FileSizes}
+			}
+			return source
+		},
+		IntervalUnit: time.Second,
+		MinInterval:  1,
+		LogConcern:   log.Keeper,
+	})
+}
+
+type Source struct {
+	DatabaseController DatabaseInterface
+	MaxParallelQueries int                  // queries of a window that run at the same time
+	Events             service.KeeperConfig // event types that are loaded besides the default ones
+	service.Enrichment
+}
+
+type rows struct {
+	fileCreationsAndEditings []ValidFileCreationAndEditing
+	libraryCreations         []ValidLibraryCreation
+	activatedUsers           []ValidActivatedUser
+	fileDeletions            []ValidFileDeletion
+	renames                  []ValidRename
+	shares                   []ValidShare
+	fileDownloads            []ValidFileDownload
+}
+
+func (s *Source) Database() service.Database {
+	return s.DatabaseController
+}
+
+func (s *Source) Load(ctx context.Context, window service.Window) (interface{}, error) {
+	// the DATETIME columns are compared in the time zone of the database
+	location := s.DatabaseController.Location()
+	var fromTimePointStr = window.From.In(location).Format(time.DateTime)
+	var toTimepointStr = window.To.In(location).Format(time.DateTime)
+
+	var loaded rows
+	queries := []service.Query{
+		func(ctx context.Context) (queryError error) {
+			loaded.fileCreationsAndEditings, queryError = s.DatabaseController.LoadFileCreationsAndEditings(ctx, fromTimePointStr, toTimepointStr)
+			return
+		},
+		func(ctx context.Context) (queryError error) {
+			loaded.libraryCreations, queryError = s.DatabaseController.LoadLibraryCreations(ctx, fromTimePointStr, toTimepointStr)
+			return
+		},
+		func(ctx context.Context) (queryError error) {
+			loaded.activatedUsers, queryError = s.DatabaseController.LoadActivatedUsers(ctx, window.From.Unix(), window.To.Unix())
+			return
+		},
+	}
+	if s.Events.FileDeletions {
+		queries = append(queries, func(ctx context.Context) (queryError error) {
+			loaded.fileDeletions, queryError = s.DatabaseController.LoadFileDeletions(ctx, fromTimePointStr, toTimepointStr)
+			return
+		})
+	}
+	if s.Events.Renames {
+		queries = append(queries, func(ctx context.Context) (queryError error) {
+			loaded.renames, queryError = s.DatabaseController.LoadRenames(ctx, fromTimePointStr, toTimepointStr)
+			return
+		})
+	}
+	if s.Events.Shares {
+		queries = append(queries, func(ctx context.Context) (queryError error) {
+			loaded.shares, queryError = s.DatabaseController.LoadShares(ctx, fromTimePointStr, toTimepointStr)
+			return
+		})
+	}
+	if s.Events.FileDownloads {
+		queries = append(queries, func(ctx context.Context) (queryError error) {
+			loaded.fileDownloads, queryError = s.DatabaseController.LoadFileDownloads(ctx, fromTimePointStr, toTimepointStr)
+			return
+		})
+	}
+	err := service.RunQueries(ctx, s.MaxParallelQueries, queries...)
+	return loaded, err
+}
+
+// Filter drops the rows of the lookback overlap that were already sent
+func (s *Source) Filter(loadedRows interface{}, fresh func(key service.RowKey) bool) interface{} {
+	loaded := loadedRows.(rows)
+	var freshRows rows
+	// keeper timestamps are seconds
+	for _, fileCreationAndEditing := range loaded.fileCreationsAndEditings {
+		if fresh(service.RowKey{Stream: "file", Timestamp: fileCreationAndEditing.Timestamp * 1000, Id: fileCreationAndEditing.Id}) {
+			freshRows.fileCreationsAndEditings = append(freshRows.fileCreationsAndEditings, fileCreationAndEditing)
+		}
+	}
+	for _, libraryCreation := range loaded.libraryCreations {
+		if fresh(service.RowKey{Stream: "library", Timestamp: libraryCreation.Timestamp * 1000, Id: libraryCreation.Id}) {
+			freshRows.libraryCreations = append(freshRows.libraryCreations, libraryCreation)
+		}
+	}
+	for _, activatedUser := range loaded.activatedUsers {
+		if fresh(service.RowKey{Stream: "user", Timestamp: activatedUser.Timestamp * 1000, Id: activatedUser.Id}) {
+			freshRows.activatedUsers = append(freshRows.activatedUsers, activatedUser)
+		}
+	}
+	for _, fileDeletion := range loaded.fileDeletions {
+		if fresh(service.RowKey{Stream: "deletion", Timestamp: fileDeletion.Timestamp * 1000, Id: fileDeletion.Id}) {
+			freshRows.fileDeletions = append(freshRows.fileDeletions, fileDeletion)
+		}
+	}
+	for _, rename := range loaded.renames {
+		if fresh(service.RowKey{Stream: "rename", Timestamp: rename.Timestamp * 1000, Id: rename.Id}) {
+			freshRows.renames = append(freshRows.renames, rename)
+		}
+	}
+	for _, share := range loaded.shares {
+		if fresh(service.RowKey{Stream: "share", Timestamp: share.Timestamp * 1000, Id: share.Id}) {
+			freshRows.shares = append(freshRows.shares, share)
+		}
+	}
+	for _, fileDownload := range loaded.fileDownloads {
+		if fresh(service.RowKey{Stream: "download", Timestamp: fileDownload.Timestamp * 1000, Id: fileDownload.Id}) {
+			freshRows.fileDownloads = append(freshRows.fileDownloads, fileDownload)
+		}
+	}
+	return freshRows
+}
+
+// Map finds the institute names for keeper data and builds the websocket data
+func (s *Source) Map(loadedRows interface{}) interface{} {
+	loaded := loadedRows.(rows)
+	var websocketEventData websocket.KeeperData
+
+	// create websocket data for file creations and editings
+	for _, fileCreationAndEditing := range loaded.fileCreationsAndEditings {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(fileCreationAndEditing.UserDomain, fileCreationAndEditing.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.FileCreationsAndEditings = append(websocketEventData.FileCreationsAndEditings, websocket.KeeperFileCreationAndEditing{
+			OperationSize: fileCreationAndEditing.OperationSize,
+			OperationType: fileCreationAndEditing.OperationType,
+			// Keeper db stores dates only with seconds precision but front end operates with milliseconds.
+			// Therefore, multiply seconds by 1000. That way the front end works homogeneously.
+			Timestamp:     fileCreationAndEditing.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	// create websocket data for library creations
+	for _, libraryCreation := range loaded.libraryCreations {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(libraryCreation.UserDomain, libraryCreation.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.LibraryCreations = append(websocketEventData.LibraryCreations, websocket.KeeperLibraryCreation{
+			// Keeper db stores dates only with seconds precision but front end operates with milliseconds.
+			// Therefore, multiply seconds by 1000. That way the front end works homogeneously.
+			Timestamp:     libraryCreation.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	// create websocket data for activated users
+	for _, activatedUser := range loaded.activatedUsers {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(activatedUser.UserDomain, activatedUser.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.ActivatedUsers = append(websocketEventData.ActivatedUsers, websocket.KeeperActivatedUser{
+			// Keeper db stores dates only with seconds precision but front end operates with milliseconds.
+			// Therefore, multiply seconds by 1000. That way the front end works homogeneously.
+			Timestamp:     activatedUser.Timestamp * 1000,
+			InstituteName: instituteName,
+		})
+	}
+
+	// create websocket data for file deletions
+	for _, fileDeletion := range loaded.fileDeletions {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(fileDeletion.UserDomain, fileDeletion.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.FileDeletions = append(websocketEventData.FileDeletions, websocket.KeeperFileDeletion{
+			ObjectType:    fileDeletion.ObjectType,
+			OperationSize: fileDeletion.OperationSize,
+			Timestamp:     fileDeletion.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	// create websocket data for renames and moves
+	for _, rename := range loaded.renames {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(rename.UserDomain, rename.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.Renames = append(websocketEventData.Renames, websocket.KeeperRename{
+			ObjectType:    rename.ObjectType,
+			OperationType: rename.OperationType,
+			OperationSize: rename.OperationSize,
+			Timestamp:     rename.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	// create websocket data for shares
+	for _, share := range loaded.shares {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(share.UserDomain, share.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.Shares = append(websocketEventData.Shares, websocket.KeeperShare{
+			ShareType:     share.ShareType,
+			OperationSize: share.OperationSize,
+			Timestamp:     share.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	// create websocket data for file downloads
+	for _, fileDownload := range loaded.fileDownloads {
+		emailDomain := s.determineDomainForInstituteNameEvaluation(fileDownload.UserDomain, fileDownload.InvitedFromDomain)
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(emailDomain)
+
+		websocketEventData.FileDownloads = append(websocketEventData.FileDownloads, websocket.KeeperFileDownload{
+			DownloadType:  fileDownload.DownloadType,
+			OperationSize: fileDownload.OperationSize,
+			Timestamp:     fileDownload.Timestamp * 1000,
+			InstituteName: instituteName,
+			Location:      s.Location(emailDomain),
+		})
+	}
+
+	return websocketEventData
+}
+
+func (s *Source) determineDomainForInstituteNameEvaluation(userDomain string, invitedFromDomain string) (emailDomain string) {
+	// determine if user is a guest/external or not
+	if s.IsInstituteDomain(userDomain) {
+		// user is not a guest
+		emailDomain = userDomain
+	} else {
+		if s.IsInstituteDomain(invitedFromDomain) {
+			// user is a guest invited by some at MPG
+			emailDomain = invitedFromDomain
+		} else {
+			// user is a guest invited by system administrator. In this case 'InvitedFromDomain' is null. At the time
+			// of writing this there is no possibility for guests to invite guests.
+			emailDomain = "mpdl.mpg.de"
+		}
+	}
+
+	return
+}
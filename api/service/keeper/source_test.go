@@ -0,0 +1,88 @@
+package keeper
+
+import (
+	"api/service"
+	"api/websocket"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingDatabase records which queries the source runs
+type recordingDatabase struct {
+	DatabaseMock
+	lock    sync.Mutex
+	queries map[string]bool
+}
+
+func (dbc *recordingDatabase) record(query string) {
+	dbc.lock.Lock()
+	defer dbc.lock.Unlock()
+	dbc.queries[query] = true
+}
+
+func (dbc *recordingDatabase) LoadFileDeletions(ctx context.Context, fromTimepoint string, toTimepoint string) ([]ValidFileDeletion, error) {
+	dbc.record("fileDeletions")
+	return dbc.DatabaseMock.LoadFileDeletions(ctx, fromTimepoint, toTimepoint)
+}
+
+func (dbc *recordingDatabase) LoadRenames(ctx context.Context, fromTimepoint string, toTimepoint string) ([]ValidRename, error) {
+	dbc.record("renames")
+	return dbc.DatabaseMock.LoadRenames(ctx, fromTimepoint, toTimepoint)
+}
+
+func (dbc *recordingDatabase) LoadShares(ctx context.Context, fromTimepoint string, toTimepoint string) ([]ValidShare, error) {
+	dbc.record("shares")
+	return dbc.DatabaseMock.LoadShares(ctx, fromTimepoint, toTimepoint)
+}
+
+func (dbc *recordingDatabase) LoadFileDownloads(ctx context.Context, fromTimepoint string, toTimepoint string) ([]ValidFileDownload, error) {
+	dbc.record("fileDownloads")
+	return dbc.DatabaseMock.LoadFileDownloads(ctx, fromTimepoint, toTimepoint)
+}
+
+func TestSourceLoadsTurnedOnEventTypes(t *testing.T) {
+	tests := []struct {
+		events   service.KeeperConfig
+		expected map[string]bool
+	}{
+		{service.KeeperConfig{}, map[string]bool{}},
+		{service.KeeperConfig{FileDeletions: true, FileDownloads: true}, map[string]bool{"fileDeletions": true, "fileDownloads": true}},
+		{service.KeeperConfig{FileDeletions: true, Renames: true, Shares: true, FileDownloads: true},
+			map[string]bool{"fileDeletions": true, "renames": true, "shares": true, "fileDownloads": true}},
+	}
+
+	window := service.Window{From: time.Date(2024, 5, 6, 10, 0, 0, 0, time.UTC), To: time.Date(2024, 5, 6, 10, 0, 10, 0, time.UTC)}
+	for _, test := range tests {
+		dbc := &recordingDatabase{DatabaseMock: DatabaseMock{Config: service.ServiceConfig{QueryInterval: 10}}, queries: make(map[string]bool)}
+		s := &Source{DatabaseController: dbc, MaxParallelQueries: 3, Events: test.events}
+		loaded, err := s.Load(context.Background(), window)
+		if err != nil {
+			t.Fatalf("Load with %+v. Unexpected error: %v", test.events, err)
+		}
+		if len(dbc.queries) != len(test.expected) {
+			t.Errorf("Queries with %+v. Expected: %v, Got: %v", test.events, test.expected, dbc.queries)
+		}
+		for query := range test.expected {
+			if !dbc.queries[query] {
+				t.Errorf("Queries with %+v. Expected: %v, Got: %v", test.events, test.expected, dbc.queries)
+			}
+		}
+
+		data := s.Map(loaded)
+		keeperData := data.(websocket.KeeperData)
+		if test.events.Renames != (len(keeperData.Renames) > 0) || test.events.FileDownloads != (len(keeperData.FileDownloads) > 0) {
+			t.Errorf("Websocket data with %+v. Got: %v renames and %v downloads", test.events, len(keeperData.Renames), len(keeperData.FileDownloads))
+		}
+		// shares and downloads carry the size of the file
+		for _, share := range keeperData.Shares {
+			if share.OperationSize != 20784 {
+				t.Errorf("Size of a share. Expected: %v, Got: %v", 20784, share.OperationSize)
+			}
+		}
+		if test.events.FileDownloads && keeperData.FileDownloads[0].OperationSize != 4821 {
+			t.Errorf("Size of a download. Expected: %v, Got: %v", 4821, keeperData.FileDownloads[0].OperationSize)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package minerva
 
 import (
 	"api/database"
+	"api/service"
 	"api/utils/log"
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -12,20 +14,16 @@ import (
 )
 
 type Database struct {
-	db           *sqlx.DB
-	Config       database.Config
-	isConnecting bool
+	database.Push // notifications of the push mode
+	db            *sqlx.DB
+	Config        database.Config
+	isConnecting  bool
 }
 
 type DatabaseInterface interface {
-	Init() error
-	IsInitialised() bool
-	IsConnecting() bool
-	SetIsConnecting(bool)
-	Ping() error
-	CloseConnection() error
-	LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error)
-	LoadIpAddressesFromUserFromTimepointUntilNow(userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error)
+	service.Database
+	LoadMessagesFromTimepointUntilNow(ctx context.Context, fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error)
+	LoadIpAddressesFromUserFromTimepointUntilNow(ctx context.Context, userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error)
 }
 
 func (dbc *Database) Init() error {
@@ -45,10 +43,14 @@ func (dbc *Database) Init() error {
 
 	dbc.isConnecting = false
 	dbc.db = db
+	dbc.StartPush(db, dataSourceName, dbc.Config.Push, pushTables, log.Minerva)
 
 	return err
 }
 
+// tables with notify triggers in push mode
+var pushTables = []string{"posts"}
+
 func (dbc *Database) IsInitialised() bool {
 	if dbc.db == nil {
 		return false
@@ -65,8 +67,8 @@ func (dbc *Database) SetIsConnecting(isConnecting bool) {
 	dbc.isConnecting = isConnecting
 }
 
-func (dbc *Database) Ping() error {
-	return dbc.db.Ping()
+func (dbc *Database) Ping(ctx context.Context) error {
+	return dbc.db.PingContext(ctx)
 }
 
 func (dbc *Database) CloseConnection() error {
@@ -76,13 +78,14 @@ func (dbc *Database) CloseConnection() error {
 		log.Error("Can not close Minerva DB connection", err, log.Minerva, log.Database)
 	}
 	dbc.db = nil
+	dbc.StopPush()
 
 	return err
 }
 
 // createat column in posts table has type BigInt which is int64
 // throws items with NULL away
-func (dbc *Database) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error) {
+func (dbc *Database) LoadMessagesFromTimepointUntilNow(ctx context.Context, fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Minerva DB not initialised.", log.Minerva, log.Database)
 		return
@@ -91,15 +94,17 @@ func (dbc *Database) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, to
 	mmMessage := []DBMessage{}
 
 	msgQuery := fmt.Sprintf("%s%d%s%d%s%s",
-		"SELECT c.id, LENGTH(a.message) AS msglen, a.createat, b.type, c.email "+
+		"SELECT a.id AS postid, c.id, LENGTH(a.message) AS msglen, a.createat, b.type, c.email "+
 			"FROM posts a, channels b, users c "+
 			"WHERE a.userid = c.id AND a.channelid = b.id "+
 			"AND a.createat BETWEEN ", fromTimepointMs, " AND ", toTimepointMs, " ",
-		"ORDER BY a.createat ASC")
+		"ORDER BY a.createat ASC, a.id ASC")
 
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "messages")
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&mmMessage, msgQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &mmMessage, msgQuery)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
 		logMessage := fmt.Sprint("Query for loading messages took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
@@ -138,7 +143,7 @@ func (dbc *Database) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, to
 				}
 
 				// append valid data to return array
-				validMessage := ValidMessage{UserId: msg.UserId, Length: messageLength, CreatedAt: createdAt, Type: msg.Type.String, EmailDomain: emailDomain}
+				validMessage := ValidMessage{PostId: msg.PostId, UserId: msg.UserId, Length: messageLength, CreatedAt: createdAt, Type: msg.Type.String, EmailDomain: emailDomain}
 				validData = append(validData, validMessage)
 			} else {
 				log.Warn(fmt.Sprint("There was an email '", msg.Email.String, "' which unexpectedly consists of more than one '@'."), log.Minerva, log.Database)
@@ -149,7 +154,7 @@ func (dbc *Database) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, to
 	return
 }
 
-func (dbc *Database) LoadIpAddressesFromUserFromTimepointUntilNow(userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error) {
+func (dbc *Database) LoadIpAddressesFromUserFromTimepointUntilNow(ctx context.Context, userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error) {
 	if dbc.db == nil {
 		log.Warn("Minerva DB not initialised.", log.Minerva, log.Database)
 		return
@@ -163,9 +168,11 @@ func (dbc *Database) LoadIpAddressesFromUserFromTimepointUntilNow(userid string,
 			"WHERE sessionid IN "+
 			"(SELECT id FROM sessions WHERE userid = ", userid, " AND lastactivityat BETWEEN ", fromTimepointMs, " AND ", toTimepointMs, " ORDER BY lastactivityat DESC);")
 
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "ipAddresses")
+	defer cancel()
 	queryStart := time.Now()
 	// do the query
-	queryError = dbc.db.Select(&userIpAddresses, ipAddressesQuery)
+	queryError = dbc.db.SelectContext(queryCtx, &userIpAddresses, ipAddressesQuery)
 	queryElapsed := time.Since(queryStart)
 	if queryElapsed.Milliseconds() > 1000 {
 		logMessage := fmt.Sprint("Query for loading user ip addresses took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
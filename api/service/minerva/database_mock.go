@@ -2,6 +2,7 @@ package minerva
 
 import (
 	"api/service"
+	"context"
 	"github.com/jmoiron/sqlx"
 	"math/rand"
 )
@@ -21,11 +22,11 @@ func (dbc *DatabaseMock) IsConnecting() bool {
 func (dbc *DatabaseMock) SetIsConnecting(isConnecting bool) {
 	return
 }
-func (dbc *DatabaseMock) Ping() error {
+func (dbc *DatabaseMock) Ping(ctx context.Context) error {
 	return nil
 }
 func (dbc *DatabaseMock) CloseConnection() error { return nil }
-func (dbc *DatabaseMock) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error) {
+func (dbc *DatabaseMock) LoadMessagesFromTimepointUntilNow(ctx context.Context, fromTimepointMs int64, toTimepointMs int64) (validData []ValidMessage, queryError error) {
 	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
 	// this array should be ordered as the front end expects
 	validData = append(validData,
@@ -64,7 +65,7 @@ func (dbc *DatabaseMock) LoadMessagesFromTimepointUntilNow(fromTimepointMs int64
 	return
 }
 
-func (dbc *DatabaseMock) LoadIpAddressesFromUserFromTimepointUntilNow(userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error) {
+func (dbc *DatabaseMock) LoadIpAddressesFromUserFromTimepointUntilNow(ctx context.Context, userid string, fromTimepointMs int64, toTimepointMs int64) (validUserIpAddresses []ValidUserIpAddress, queryError error) {
 	validUserIpAddresses = append(validUserIpAddresses,
 		ValidUserIpAddress{
 			IpAdress: "777.77.77.777",
@@ -6,6 +6,7 @@ package minerva
 
 import (
 	"api/database"
+	"context"
 	"testing"
 	"time"
 )
@@ -33,7 +34,7 @@ func TestLoadMessagesFromTimepointUntilNow(t *testing.T) {
 	var fromTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 09:04:05")
 	var toTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 10:04:05")
 
-	messages, _ := dbc.LoadMessagesFromTimepointUntilNow(fromTimepoint.UnixMilli(), toTimepoint.UnixMilli())
+	messages, _ := dbc.LoadMessagesFromTimepointUntilNow(context.Background(), fromTimepoint.UnixMilli(), toTimepoint.UnixMilli())
 	if "mpdl.mpg.de" != messages[0].EmailDomain {
 		t.Errorf("First entry should have a user domain. Expected: %v, Got: %v", "mpdl.mpg.de", messages[0].EmailDomain)
 	}
@@ -53,7 +54,7 @@ func TestLoadIpAddressesFromUserFromTimepointUntilNow(t *testing.T) {
 	var fromTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 09:04:05")
 	var toTimepoint, _ = time.Parse(time.DateTime, "2023-07-02 10:04:05")
 
-	ipAddresses, _ := dbc.LoadIpAddressesFromUserFromTimepointUntilNow("userid", fromTimepoint.UnixMilli(), toTimepoint.UnixMilli())
+	ipAddresses, _ := dbc.LoadIpAddressesFromUserFromTimepointUntilNow(context.Background(), "userid", fromTimepoint.UnixMilli(), toTimepoint.UnixMilli())
 	if "127.0.0.1" != ipAddresses[0].IpAdress {
 		t.Errorf("First entry should have a user domain. Expected: %v, Got: %v", "127.0.0.1", ipAddresses[0].IpAdress)
 	}
@@ -3,6 +3,7 @@ package minerva
 import "database/sql"
 
 type DBMessage struct {
+	PostId    string         `db:"postid"`   // id column in posts table is not nullable
 	UserId    string         `db:"id"`       // id column in users table is not nullable
 	Length    sql.NullInt64  `db:"msglen"`   // message column in posts table is nullable, in SQL LEN(NULL) returns NULL
 	CreatedAt sql.NullInt64  `db:"createat"` // createat column in posts table is nullable
@@ -11,6 +12,7 @@ type DBMessage struct {
 }
 
 type ValidMessage struct {
+	PostId      string
 	UserId      string
 	Length      int64
 	CreatedAt   int64
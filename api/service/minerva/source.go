@@ -0,0 +1,207 @@
+package minerva
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/service"
+	"api/utils/log"
+	"api/utils/mail"
+	"api/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+func init() {
+	service.RegisterSource("minerva", service.SourceRegistration{
+		NewSource: func(config service.ServiceConfig, mockDatabase bool) service.Source {
+			if mockDatabase {
+				return &Source{DatabaseController: &DatabaseMock{Config: config}, MaxParallelQueries: config.Database.MaxParallelQueries}
+			}
+			return &Source{DatabaseController: &Database{Config: config.Database}, MaxParallelQueries: config.Database.MaxParallelQueries}
+		},
+		IntervalUnit: time.Millisecond,
+		MinInterval:  1000,
+		LogConcern:   log.Minerva,
+	})
+}
+
+type Source struct {
+	DatabaseController   DatabaseInterface
+	MaxParallelQueries   int // queries of a window that run at the same time
+	InstitutesController institutes.Controller
+	InstitutesData       institutes.InstituteData
+	GeoController        geo.Controller
+	geoInformation       map[string]geo.Location
+}
+
+type rows struct {
+	messages    []ValidMessage
+	ipAddresses map[string][]ValidUserIpAddress // by user id, only for users whose email domain is a duplicate
+}
+
+func (s *Source) Init(institutesController institutes.Controller, geoController geo.Controller) {
+	// world map controller
+	s.GeoController = geoController
+	s.loadGeoInformation()
+	s.InstitutesController = institutesController
+	s.UpdateInstitutesData()
+}
+
+func (s *Source) Database() service.Database {
+	return s.DatabaseController
+}
+
+func (s *Source) Load(ctx context.Context, window service.Window) (interface{}, error) {
+	fromTimepoint := window.From.UnixMilli()
+	toTimepoint := window.To.UnixMilli()
+
+	// Load last messages
+	loaded := rows{ipAddresses: make(map[string][]ValidUserIpAddress)}
+	var msgQueryError error
+	loaded.messages, msgQueryError = s.DatabaseController.LoadMessagesFromTimepointUntilNow(ctx, fromTimepoint, toTimepoint)
+
+	// the institute of users with a duplicate email domain is determined by their ip address
+	var ipQueries []service.Query
+	var ipAddressesLock sync.Mutex
+	for _, message := range loaded.messages {
+		if _, exists := s.InstitutesData.DomainDuplicates[message.EmailDomain]; !exists {
+			continue
+		}
+		if _, cached := loaded.ipAddresses[message.UserId]; cached {
+			continue
+		}
+		userId := message.UserId
+		loaded.ipAddresses[userId] = nil
+		ipQueries = append(ipQueries, func(ctx context.Context) error {
+			ipAddresses, ipQueryError := s.DatabaseController.LoadIpAddressesFromUserFromTimepointUntilNow(ctx, userId, fromTimepoint, toTimepoint)
+			ipAddressesLock.Lock()
+			loaded.ipAddresses[userId] = ipAddresses
+			ipAddressesLock.Unlock()
+			return ipQueryError
+		})
+	}
+	ipQueryErrors := service.RunQueries(ctx, s.MaxParallelQueries, ipQueries...)
+
+	return loaded, errors.Join(msgQueryError, ipQueryErrors)
+}
+
+// Filter drops the messages of the lookback overlap that were already sent
+func (s *Source) Filter(loadedRows interface{}, fresh func(key service.RowKey) bool) interface{} {
+	loaded := loadedRows.(rows)
+	freshRows := rows{ipAddresses: loaded.ipAddresses}
+	for _, message := range loaded.messages {
+		if fresh(service.RowKey{Stream: "message", Timestamp: message.CreatedAt, Id: message.PostId}) {
+			freshRows.messages = append(freshRows.messages, message)
+		}
+	}
+	return freshRows
+}
+
+// Map finds the institute names for the messages
+func (s *Source) Map(loadedRows interface{}) interface{} {
+	loaded := loadedRows.(rows)
+	var websocketEventData websocket.MinervaData
+	for _, message := range loaded.messages {
+		if _, exists := s.InstitutesData.DomainDuplicates[message.EmailDomain]; exists {
+			// email domain is a duplicate, determine institute name by checking ip address
+			instituteName := s.detemineInstituteName(message.EmailDomain, loaded.ipAddresses[message.UserId])
+
+			websocketEventData.Messages = append(websocketEventData.Messages, websocket.MinervaMessage{
+				InstituteName: instituteName,
+				CreatedAt:     message.CreatedAt,
+				MessageLength: message.Length,
+				ChannelType:   message.Type,
+				Location:      s.geoInformation[message.EmailDomain],
+			})
+		} else {
+			if institute, exists := s.InstitutesData.Institutes[message.EmailDomain]; exists {
+				// email domain is not a duplicate and exists in institute data
+				instituteName := institute.InstituteNameDe
+				if len(instituteName) == 0 {
+					// Inside the json file from rena.mpdl.mpg.de there was no institute name given for the domain.
+					// Fall back to just the domain
+					instituteName = message.EmailDomain
+				}
+
+				websocketEventData.Messages = append(websocketEventData.Messages, websocket.MinervaMessage{
+					InstituteName: instituteName,
+					CreatedAt:     message.CreatedAt,
+					MessageLength: message.Length,
+					ChannelType:   message.Type,
+					Location:      s.geoInformation[message.EmailDomain],
+				})
+			} else {
+				log.Debug(fmt.Sprint("minerva messenger: Domain ", message.EmailDomain, " does not exist in institute data."), log.Minerva, log.Service)
+			}
+		}
+	}
+
+	return websocketEventData
+}
+
+func (s *Source) detemineInstituteName(emailDomain string, ipAddresses []ValidUserIpAddress) (instituteName string) {
+	instituteName = emailDomain
+
+	for _, ipAddress := range ipAddresses {
+		for _, ipRangesData := range s.InstitutesData.Institutes[emailDomain].DomainIpRanges {
+			if s.ipWithinIpRanges(ipRangesData.IpRanges, ipAddress.IpAdress) {
+				instituteName = ipRangesData.InstituteNameDe
+				return
+			}
+		}
+	}
+
+	// message came from a user that has a email domain that can be mapped to multiple institutes AND the message
+	// has a ip address that is not within any ip ranges that can be mapped to the email domain
+	return
+}
+
+func (s *Source) ipWithinIpRanges(ipRanges map[string]struct{}, ipToCheck string) bool {
+
+	for ipRange := range ipRanges {
+		_, subnet, err := net.ParseCIDR(ipRange)
+		if err != nil {
+			log.Error("Could not detemine if ip is in ip range.", err, log.Minerva, log.Service)
+			return false
+		}
+
+		ip := net.ParseIP(ipToCheck)
+		if subnet.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s *Source) UpdateInstitutesData() {
+	// no need to use mutex lock/unlock since the usage of the data is not sensible
+	var institutesData, instituteErr = s.InstitutesController.Load()
+	if instituteErr != nil {
+		logMessage := "Error while loading institute data."
+		log.Error(logMessage, instituteErr, log.Minerva, log.Service)
+		mail.SendErrorMail(logMessage, instituteErr)
+	} else {
+		s.InstitutesData = institutesData
+	}
+}
+
+func (s *Source) UpdateGeoInformation() {
+	s.loadGeoInformation()
+}
+
+func (s *Source) loadGeoInformation() {
+	// no need to use mutex lock/unlock since the usage of the data is not sensible
+	var geoInformation, geoInformationErr = s.GeoController.Load("mpg-institutes")
+	if geoInformationErr != nil {
+		logMessage := "Error while loading geo information data."
+		log.Error(logMessage, geoInformationErr, log.Minerva, log.Service)
+		mail.SendErrorMail(logMessage, geoInformationErr)
+	} else {
+		s.geoInformation = geoInformation
+	}
+}
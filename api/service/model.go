@@ -7,7 +7,76 @@ import (
 
 type ServiceConfig struct {
 	Name          string           `yaml:"name"`
+	Type          string           `yaml:"type"` // registered source of the service, the name if empty, e.g. "sql"
 	QueryInterval int64            `yaml:"queryInterval"`
 	Database      database.Config  `yaml:"database"`
 	Websocket     websocket.Config `yaml:"websocket"`
+	Upstream      UpstreamConfig   `yaml:"upstream"`
+	Watermark     WatermarkConfig  `yaml:"watermark"`
+	Sql           SqlConfig        `yaml:"sql"`
+	Webhook       WebhookConfig    `yaml:"webhook"`
+	Keeper        KeeperConfig     `yaml:"keeper"`
+}
+
+// SourceName is the name the source of the service is registered under
+func (c ServiceConfig) SourceName() string {
+	if len(c.Type) > 0 {
+		return c.Type
+	}
+	return c.Name
+}
+
+// UpstreamConfig is used by the services of the relay environment, which take their frames from another hatnote api
+// instead of a database
+type UpstreamConfig struct {
+	URL               string `yaml:"url"`               // websocket endpoint of the service, e.g. "wss://hatnote.mpdl.mpg.de/keeper"
+	AccessToken       string `yaml:"accessToken"`       // optional, for upstream endpoints that require tokens
+	ReconnectInterval int    `yaml:"reconnectInterval"` // milliseconds
+	IdleTimeout       int    `yaml:"idleTimeout"`       // milliseconds without frames or pings before the upstream connection is considered dead
+}
+
+// WatermarkConfig is used by the database services, which query every window after the rows they already sent
+type WatermarkConfig struct {
+	File       string `yaml:"file"`       // optional, keeps the watermark across restarts, e.g. "/var/lib/hatnote/keeper.json"
+	Lookback   int64  `yaml:"lookback"`   // milliseconds every window reaches back for rows committed late with an older timestamp
+	MaxCatchUp int64  `yaml:"maxCatchUp"` // milliseconds, longer gaps, e.g. after a long downtime, are skipped instead of sent in one frame, 60 query intervals by default
+}
+
+// SqlConfig is used by services of type sql, which run a query from the environment yaml instead of a source package
+type SqlConfig struct {
+	Driver  string     `yaml:"driver"`  // "postgres" or "mysql"
+	Query   string     `yaml:"query"`   // {from} and {to} are replaced by the window, e.g. "... WHERE created BETWEEN {from} AND {to}"
+	Columns SqlColumns `yaml:"columns"` // columns of the query result
+	Kind    string     `yaml:"kind"`    // event kind of rows without kind column, "Events" if empty
+}
+
+// SqlColumns maps the columns of the query result to the fields of the events
+type SqlColumns struct {
+	Id        string `yaml:"id"`        // primary key to not send rows of the lookback twice, required with a watermark lookback
+	Timestamp string `yaml:"timestamp"` // timestamp, datetime string or unix seconds
+	Magnitude string `yaml:"magnitude"` // optional, number the front end scales the event with, e.g. a file size
+	Domain    string `yaml:"domain"`    // email domain or email address, used to find the institute
+	Kind      string `yaml:"kind"`      // optional, event kind of the row
+}
+
+// WebhookConfig is used by services of type webhook, which receive their events by http POST instead of a database
+type WebhookConfig struct {
+	Path        string   `yaml:"path"`        // POST endpoint, served on the listen address of the websocket endpoint
+	Tokens      []string `yaml:"tokens"`      // bearer tokens the senders authenticate with, several to rotate them
+	Kind        string   `yaml:"kind"`        // event kind of events without kind, "Events" if empty
+	MaxBodySize int64    `yaml:"maxBodySize"` // bytes of one request
+	MaxEvents   int      `yaml:"maxEvents"`   // events buffered for the next frame, batches beyond are rejected
+}
+
+// KeeperConfig turns on the event types of the keeper service that are not sent by default, e.g. for a display that
+// shows the downloads. File creations and editings, library creations and activated users are always sent.
+type KeeperConfig struct {
+	FileDeletions bool `yaml:"fileDeletions"` // deletions of files, directories and libraries
+	Renames       bool `yaml:"renames"`       // renames and moves of files and directories
+	Shares        bool `yaml:"shares"`        // created share links
+	FileDownloads bool `yaml:"fileDownloads"` // downloads of the file audit log, which seafevents only writes if enabled
+	// sizes of shared and downloaded files, otherwise they are 0. Seafile has no file sizes in sql, they are looked up in
+	// the latest Activity row of every shared or downloaded file. Activity has no index on the path, so every lookup
+	// scans the activities of the library of the file. Shared libraries always have their size.
+	FileSizes bool `yaml:"fileSizes"`
 }
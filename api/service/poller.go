@@ -0,0 +1,267 @@
+package service
+
+import (
+	"api/database"
+	"api/geo"
+	"api/globals"
+	"api/institutes"
+	"api/utils/log"
+	"api/websocket"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Poller is a service that queries its source every query interval and broadcasts the result as one frame
+type Poller struct {
+	Source              Source
+	WebsocketController websocket.WebsocketInterface
+	Config              ServiceConfig
+	registration        SourceRegistration
+	ticker              *time.Ticker
+	done                chan bool
+	wsErrorCheckerDone  chan bool
+	dbReconnector       database.Reconnector
+	watermark           *watermarkTracker
+	cancelQueries       context.CancelFunc
+}
+
+func (p *Poller) Init(institutesController institutes.Controller, geoController geo.Controller) {
+	log.Info(fmt.Sprint("Init ", p.Config.Name, " service."), p.registration.LogConcern, log.Service)
+	p.Source.Init(institutesController, geoController)
+	p.watermark = newWatermarkTracker(p.Config.Watermark, p.registration.LogConcern)
+
+	// db reconnector
+	db := p.Source.Database()
+	p.dbReconnector = database.Reconnector{
+		NextDbReconnect:       time.Time{},
+		NumberOfDbReconnects:  0,
+		InitDatabase:          db.Init,
+		IsDatabaseInitialised: db.IsInitialised,
+		ReconnectTimout:       p.Config.Database.ReconnectTimout,
+		ServiceName:           p.Config.Name,
+	}
+	// because of the async execution this has to be set. This could be solved in a better way
+	db.SetIsConnecting(true)
+	p.wsErrorCheckerDone = make(chan bool)
+	wsErrorChannel := p.WebsocketController.GetErrorChannel()
+	go func() {
+		for {
+			select {
+			case <-p.wsErrorCheckerDone:
+				return
+			case err := <-*wsErrorChannel:
+				log.Error(fmt.Sprint("While trying to serve a websocket connection for ", p.Config.Name, " there was an error."), err, p.registration.LogConcern, log.Service)
+				p.StopService()
+				return
+			}
+		}
+	}()
+	p.WebsocketController.InitAndStartOnce(p.Config.Websocket)
+}
+
+func (p *Poller) GetName() string {
+	return p.Config.Name
+}
+
+func (p *Poller) GetDatabaseController() interface{} {
+	return p.Source.Database()
+}
+
+func (p *Poller) UpdateInstitutesData() {
+	p.Source.UpdateInstitutesData()
+}
+
+func (p *Poller) UpdateGeoInformation() {
+	p.Source.UpdateGeoInformation()
+}
+
+func (p *Poller) StartService() *chan bool {
+	log.Info(fmt.Sprint("Starting ", p.Config.Name, " service."), p.registration.LogConcern, log.Service)
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+	p.done = make(chan bool)
+	if p.Config.Websocket.Broker.IsEdge() {
+		// the frames come from the relay publisher, edges do not poll the database
+		log.Info(fmt.Sprint(p.Config.Name, " service runs as relay edge. Not polling the database."), p.registration.LogConcern, log.Service)
+		return &p.done
+	}
+	p.ticker = time.NewTicker(p.queryInterval())
+	// cancelled by StopService, so a hung query does not block the stop
+	ctx, cancelQueries := context.WithCancel(context.Background())
+	p.cancelQueries = cancelQueries
+
+	notifier, pushes := p.Source.Database().(Notifier)
+	// StopService resets the field after closing the channel
+	done := p.done
+	go func() {
+		var debounce <-chan time.Time
+		var lastPoll time.Time
+		for {
+			// nil without push mode, a nil channel never receives
+			var notifications <-chan struct{}
+			if pushes {
+				notifications = notifier.Notifications()
+			}
+
+			select {
+			case <-done:
+				return
+			case <-notifications:
+				// collect the notifications of a burst of commits into one load
+				if debounce == nil {
+					debounce = time.After(time.Duration(p.Config.Database.Push.Debounce) * time.Millisecond)
+				}
+			case <-debounce:
+				debounce = nil
+				p.processEvent(ctx)
+				lastPoll = time.Now()
+			case <-p.ticker.C:
+				if pushes && notifier.IsListening() && time.Since(lastPoll) < p.pushPollInterval() {
+					continue
+				}
+				p.processEvent(ctx)
+				lastPoll = time.Now()
+			}
+		}
+	}()
+
+	return &p.done
+}
+
+func (p *Poller) StopService() {
+	log.Info(fmt.Sprint("Stop ", p.Config.Name, " service controller ticker."), p.registration.LogConcern, log.Service)
+	if p.ticker != nil {
+		p.ticker.Stop()
+	}
+	if p.cancelQueries != nil {
+		p.cancelQueries()
+	}
+
+	p.WebsocketController.StopWebsocket()
+
+	if p.wsErrorCheckerDone != nil {
+		select {
+		case p.wsErrorCheckerDone <- true:
+		default:
+		}
+		close(p.wsErrorCheckerDone)
+		p.wsErrorCheckerDone = nil
+	}
+
+	// closed instead of sent to, edges never start the goroutine that would receive
+	if p.done != nil {
+		close(p.done)
+		p.done = nil
+	}
+}
+
+func (p *Poller) queryInterval() time.Duration {
+	return time.Duration(p.Config.QueryInterval) * p.registration.IntervalUnit
+}
+
+func (p *Poller) pushPollInterval() time.Duration {
+	return time.Duration(p.Config.Database.Push.PollInterval) * time.Millisecond
+}
+
+func (p *Poller) tickTimeout() time.Duration {
+	if p.Config.Database.TickTimeout > 0 {
+		return time.Duration(p.Config.Database.TickTimeout) * time.Millisecond
+	}
+	return p.queryInterval()
+}
+
+func (p *Poller) processEvent(ctx context.Context) {
+	concern := p.registration.LogConcern
+	log.Info(fmt.Sprint("Process ", p.Config.Name, " service controller event."), concern, log.Service)
+	db := p.Source.Database()
+
+	// Check if a websocket connection exists
+	if p.WebsocketController.GetActiveConnections() == 0 {
+		log.Info("There are no active websocket connections. Skipping db queries.", concern, log.Service)
+		if db.IsInitialised() {
+			log.Info(fmt.Sprint(p.Config.Name, " db initialised. Closing connection."), concern, log.Service)
+			db.CloseConnection()
+		} else {
+			log.Info(fmt.Sprint(p.Config.Name, " db not initialised. Stopping db reconnector if active."), concern, log.Service)
+			p.dbReconnector.Stop()
+		}
+		db.SetIsConnecting(true)
+		// nobody missed anything, the next window starts from now
+		p.watermark.reset()
+		return
+	}
+
+	// Check if already initialised
+	if !db.IsInitialised() {
+		log.Info(fmt.Sprint(p.Config.Name, " db not initialised. Starting reconnector."), concern, log.Service)
+		go p.dbReconnector.StartRepeatingDbReconnectOnce()
+	}
+
+	// The window continues after the last complete one
+	window, since := p.watermark.window(time.Now(), p.queryInterval())
+
+	log.Debug(fmt.Sprint("Load ", p.Config.Name, " data."), concern, log.Service)
+	// the queries of the tick share one deadline, so a slow query does not delay the frame of the others for long
+	tickCtx, cancelTick := context.WithTimeout(ctx, p.tickTimeout())
+	if refresher, ok := db.(LocationRefresher); ok {
+		refresher.RefreshLocation(tickCtx)
+	}
+	rows, queryError := p.Source.Load(tickCtx, window)
+	cancelTick()
+	if ctx.Err() != nil {
+		log.Info(fmt.Sprint("Service stopped while loading ", p.Config.Name, " data."), concern, log.Service)
+		return
+	}
+	rows = p.Source.Filter(rows, p.watermark.filter())
+	if queryError != nil {
+		// timed out queries are handled like any other failed query
+		log.Error(fmt.Sprint("Could not load all ", p.Config.Name, " data."), queryError, concern, log.Service)
+		p.checkConnection(ctx, db)
+	} else {
+		p.watermark.complete(window)
+	}
+	p.watermark.save()
+
+	log.Debug(fmt.Sprint("Create websocket data for ", p.Config.Name, "."), concern, log.Service)
+	serviceDataJSON, err := json.Marshal(p.Source.Map(rows))
+	if err != nil {
+		log.Error(fmt.Sprint("Could not convert ", p.Config.Name, " data to json string."), err, concern, log.Service)
+		return
+	}
+
+	log.Info("Send websocket data in bulk", concern, log.Service)
+	p.WebsocketController.SendDataInBulk(p.eventData(since, string(serviceDataJSON)))
+}
+
+// checkConnection starts the reconnector if a failed query was caused by a lost connection
+func (p *Poller) checkConnection(ctx context.Context, db Database) {
+	pingCtx, cancel := p.Config.Database.QueryContext(ctx, "ping")
+	defer cancel()
+	pingError := db.Ping(pingCtx)
+	if pingError != nil {
+		log.Error(fmt.Sprint("Can not ping ", p.Config.Name, " DB"), pingError, p.registration.LogConcern, log.Service)
+		db.CloseConnection()
+		log.Info("Starting reconnector.", p.registration.LogConcern, log.Service)
+		go p.dbReconnector.StartRepeatingDbReconnectOnce()
+	}
+}
+
+// eventData reports the end of the last complete window as FromTimepoint. The front end delays the events by their
+// distance to it, so the lookback does not delay every event and late rows are shown right away.
+func (p *Poller) eventData(since time.Time, serviceDataJSON string) (eventData websocket.EventData) {
+	db := p.Source.Database()
+	eventData.EventInfo.ActiveConnections = p.WebsocketController.GetActiveConnections()
+	eventData.EventInfo.FromTimepoint = since.UnixMilli()
+	eventData.EventInfo.Service = p.Config.Name
+	eventData.EventInfo.Version = globals.VERSION
+	eventData.EventInfo.ExpectedFrontendVersion = globals.EXPECTED_FRONTEND_VERSION
+	eventData.EventInfo.DatabaseInfo.IsConnectionEstablished = db.IsInitialised()
+	eventData.EventInfo.DatabaseInfo.IsConnecting = db.IsConnecting()
+	eventData.EventInfo.DatabaseInfo.NextReconnect = p.dbReconnector.NextDbReconnect.UnixMilli()
+	eventData.EventInfo.DatabaseInfo.NumberOfDbReconnects = p.dbReconnector.NumberOfDbReconnects
+	eventData.Data = serviceDataJSON
+	return
+}
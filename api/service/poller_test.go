@@ -0,0 +1,291 @@
+package service
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/utils/log"
+	"api/websocket"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// within this directory: go test
+
+type recordingWebsocket struct {
+	lock        sync.Mutex
+	frames      []websocket.EventData
+	connections int
+}
+
+func (rw *recordingWebsocket) SendDataInBulk(data websocket.EventData) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	rw.frames = append(rw.frames, data)
+}
+func (rw *recordingWebsocket) InitAndStartOnce(config websocket.Config) {}
+func (rw *recordingWebsocket) GetErrorChannel() *chan error {
+	errorChannel := make(chan error)
+	return &errorChannel
+}
+func (rw *recordingWebsocket) StopWebsocket()            {}
+func (rw *recordingWebsocket) GetActiveConnections() int { return rw.connections }
+
+type fakeDatabase struct {
+	initialised bool
+	pings       int
+	refreshes   int
+}
+
+func (fd *fakeDatabase) Init() error                     { fd.initialised = true; return nil }
+func (fd *fakeDatabase) IsInitialised() bool             { return fd.initialised }
+func (fd *fakeDatabase) IsConnecting() bool              { return false }
+func (fd *fakeDatabase) SetIsConnecting(bool)            {}
+func (fd *fakeDatabase) Ping(context.Context) error      { fd.pings++; return nil }
+func (fd *fakeDatabase) CloseConnection() error          { fd.initialised = false; return nil }
+func (fd *fakeDatabase) RefreshLocation(context.Context) { fd.refreshes++ }
+
+type fakeSource struct {
+	database  *fakeDatabase
+	windows   []Window
+	rows      []RowKey
+	loadError error
+	loading   chan struct{} // if set, Load signals on it and blocks until the context is done
+}
+
+func (fs *fakeSource) UpdateInstitutesData()                      {}
+func (fs *fakeSource) UpdateGeoInformation()                      {}
+func (fs *fakeSource) Init(institutes.Controller, geo.Controller) {}
+func (fs *fakeSource) Database() Database                         { return fs.database }
+func (fs *fakeSource) Load(ctx context.Context, window Window) (interface{}, error) {
+	fs.windows = append(fs.windows, window)
+	if fs.loading != nil {
+		fs.loading <- struct{}{}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return fs.rows, fs.loadError
+}
+func (fs *fakeSource) Filter(rows interface{}, fresh func(key RowKey) bool) interface{} {
+	var freshRows []RowKey
+	for _, key := range rows.([]RowKey) {
+		if fresh(key) {
+			freshRows = append(freshRows, key)
+		}
+	}
+	return freshRows
+}
+func (fs *fakeSource) Map(rows interface{}) interface{} {
+	ids := []string{}
+	for _, key := range rows.([]RowKey) {
+		ids = append(ids, key.Id)
+	}
+	return ids
+}
+
+func newTestPoller(source *fakeSource, recorder *recordingWebsocket) *Poller {
+	return &Poller{Source: source, WebsocketController: recorder, Config: ServiceConfig{Name: "fake", QueryInterval: 5},
+		registration: SourceRegistration{IntervalUnit: time.Second, LogConcern: log.Service},
+		watermark:    newWatermarkTracker(WatermarkConfig{Lookback: 2000, MaxCatchUp: 60000}, log.Service)}
+}
+
+func TestPollerSendsFrameOfWindow(t *testing.T) {
+	// rows are sent once while they are within the lookback of the next window
+	timestamp := time.Now().UnixMilli()
+	source := &fakeSource{database: &fakeDatabase{initialised: true}, rows: []RowKey{{Stream: "row", Timestamp: timestamp, Id: "1"}}}
+	recorder := &recordingWebsocket{connections: 1}
+	poller := newTestPoller(source, recorder)
+
+	before := time.Now()
+	poller.processEvent(context.Background())
+
+	if len(source.windows) != 1 || len(recorder.frames) != 1 || source.database.refreshes != 1 {
+		t.Fatalf("Loads, frames and time zone refreshes. Expected: 1, 1 and 1, Got: %v, %v and %v", len(source.windows), len(recorder.frames),
+			source.database.refreshes)
+	}
+	// the first window covers the query interval and the lookback
+	window := source.windows[0]
+	if window.To.Sub(window.From) != 7*time.Second {
+		t.Errorf("Window length. Expected: %v, Got: %v", 7*time.Second, window.To.Sub(window.From))
+	}
+	if window.To.Before(before) || window.To.After(time.Now()) {
+		t.Errorf("Window does not end now. Got: %v", window.To)
+	}
+	since := window.From.Add(2 * time.Second).UnixMilli()
+	frame := recorder.frames[0]
+	if frame.EventInfo.Service != "fake" || frame.EventInfo.FromTimepoint != since || frame.Data != `["1"]` {
+		t.Errorf("Frame. Expected: fake, %v, [\"1\"], Got: %v, %v, %v", since, frame.EventInfo.Service, frame.EventInfo.FromTimepoint, frame.Data)
+	}
+
+	// the next window continues after the first one and the row of the overlap is not sent again
+	source.rows = append(source.rows, RowKey{Stream: "row", Timestamp: timestamp, Id: "2"})
+	poller.processEvent(context.Background())
+	if next := source.windows[1]; !next.From.Equal(window.To.Add(-2 * time.Second)) {
+		t.Errorf("Start of the next window. Expected: %v, Got: %v", window.To.Add(-2*time.Second), next.From)
+	}
+	if frame = recorder.frames[1]; frame.Data != `["2"]` {
+		t.Errorf("Frame of the next window. Expected: %v, Got: %v", `["2"]`, frame.Data)
+	}
+}
+
+func TestPollerSendsPartialRowsAndChecksConnectionOnError(t *testing.T) {
+	source := &fakeSource{database: &fakeDatabase{initialised: true}, rows: []RowKey{{Stream: "row", Timestamp: time.Now().UnixMilli(), Id: "1"}},
+		loadError: errors.New("query failed")}
+	recorder := &recordingWebsocket{connections: 1}
+	poller := newTestPoller(source, recorder)
+
+	poller.processEvent(context.Background())
+
+	if source.database.pings != 1 {
+		t.Errorf("Pings after failed query. Expected: %v, Got: %v", 1, source.database.pings)
+	}
+	if len(recorder.frames) != 1 || recorder.frames[0].Data != `["1"]` {
+		t.Errorf("Frame with the rows of the other queries. Expected: %v, Got: %v", `["1"]`, recorder.frames)
+	}
+
+	// the failed window is covered again, without the rows that were sent
+	poller.processEvent(context.Background())
+	if !source.windows[1].From.Equal(source.windows[0].From) {
+		t.Errorf("Start of the window after a failed query. Expected: %v, Got: %v", source.windows[0].From, source.windows[1].From)
+	}
+	if recorder.frames[1].Data != `[]` {
+		t.Errorf("Frame after a failed query. Expected: %v, Got: %v", `[]`, recorder.frames[1].Data)
+	}
+}
+
+func TestStopServiceCancelsHungQuery(t *testing.T) {
+	source := &fakeSource{database: &fakeDatabase{initialised: true}, loading: make(chan struct{})}
+	recorder := &recordingWebsocket{connections: 1}
+	poller := newTestPoller(source, recorder)
+	poller.registration.IntervalUnit = time.Millisecond
+	poller.Config.QueryInterval = 10
+
+	poller.StartService()
+	select {
+	case <-source.loading:
+	case <-time.After(time.Second):
+		t.Fatalf("Poller did not query.")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		poller.StopService()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("StopService is blocked by the hung query.")
+	}
+	if len(recorder.frames) != 0 {
+		t.Errorf("Frames of the cancelled query. Expected: 0, Got: %v", len(recorder.frames))
+	}
+}
+
+func TestStartAndStopEdgeService(t *testing.T) {
+	source := &fakeSource{database: &fakeDatabase{initialised: true}}
+	recorder := &recordingWebsocket{connections: 1}
+	poller := newTestPoller(source, recorder)
+	poller.Config.Websocket.Broker = websocket.BrokerConfig{Type: websocket.BrokerRelayEdge}
+
+	poller.StartService()
+	stopped := make(chan struct{})
+	go func() {
+		poller.StopService()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("StopService of an edge is blocked.")
+	}
+	if len(source.windows) != 0 {
+		t.Errorf("Loads of an edge. Expected: 0, Got: %v", len(source.windows))
+	}
+}
+
+func TestPollerSkipsQueriesWithoutConnections(t *testing.T) {
+	source := &fakeSource{database: &fakeDatabase{initialised: true}}
+	recorder := &recordingWebsocket{}
+	poller := newTestPoller(source, recorder)
+
+	poller.processEvent(context.Background())
+
+	if len(source.windows) != 0 || len(recorder.frames) != 0 {
+		t.Errorf("Loads and frames without connections. Expected: 0 and 0, Got: %v and %v", len(source.windows), len(recorder.frames))
+	}
+	if source.database.IsInitialised() {
+		t.Errorf("Database connection was not closed without connections.")
+	}
+}
+
+func TestNewPollerRejectsUnknownService(t *testing.T) {
+	RegisterSource("registered", SourceRegistration{NewSource: func(config ServiceConfig, mockDatabase bool) Source {
+		return &fakeSource{database: &fakeDatabase{}}
+	}, MinInterval: 7})
+
+	if _, err := NewPoller(ServiceConfig{Name: "unknown"}, &recordingWebsocket{}, false); err == nil {
+		t.Errorf("Unknown service was accepted.")
+	}
+	if poller, err := NewPoller(ServiceConfig{Name: "registered"}, &recordingWebsocket{}, true); err != nil || poller.GetName() != "registered" {
+		t.Errorf("Registered service. Expected: registered, Got: %v, %v", poller, err)
+	}
+	if MinQueryInterval("registered") != 7 || MinQueryInterval("unknown") != 0 {
+		t.Errorf("Min query intervals. Expected: 7 and 0, Got: %v and %v", MinQueryInterval("registered"), MinQueryInterval("unknown"))
+	}
+}
+
+type fakeNotifyingDatabase struct {
+	fakeDatabase
+	notifications chan struct{}
+	listening     bool
+}
+
+func (fd *fakeNotifyingDatabase) Notifications() <-chan struct{} { return fd.notifications }
+func (fd *fakeNotifyingDatabase) IsListening() bool              { return fd.listening }
+
+type fakeNotifyingSource struct {
+	fakeSource
+	database *fakeNotifyingDatabase
+	loads    chan Window
+}
+
+func (fs *fakeNotifyingSource) Database() Database { return fs.database }
+func (fs *fakeNotifyingSource) Load(ctx context.Context, window Window) (interface{}, error) {
+	fs.loads <- window
+	return []RowKey{}, nil
+}
+
+func TestPollerLoadsOnNotification(t *testing.T) {
+	database := &fakeNotifyingDatabase{fakeDatabase: fakeDatabase{initialised: true}, notifications: make(chan struct{}, 1), listening: true}
+	source := &fakeNotifyingSource{database: database, loads: make(chan Window, 4)}
+	poller := &Poller{Source: source, WebsocketController: &recordingWebsocket{connections: 1}, Config: ServiceConfig{Name: "fake", QueryInterval: 10},
+		registration: SourceRegistration{IntervalUnit: time.Millisecond, LogConcern: log.Service},
+		watermark:    newWatermarkTracker(WatermarkConfig{MaxCatchUp: 60000}, log.Service)}
+	poller.Config.Database.Push.PollInterval = 60000
+	poller.Config.Database.Push.Debounce = 1
+
+	poller.StartService()
+	defer poller.StopService()
+
+	// the first tick polls, afterwards the ticks are skipped while listening
+	select {
+	case <-source.loads:
+	case <-time.After(time.Second):
+		t.Fatalf("Poller did not poll on the first tick.")
+	}
+	select {
+	case <-source.loads:
+		t.Fatalf("Poller polled while listening.")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	database.notifications <- struct{}{}
+	select {
+	case <-source.loads:
+	case <-time.After(time.Second):
+		t.Fatalf("Poller did not load after a notification.")
+	}
+}
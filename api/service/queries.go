@@ -0,0 +1,40 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Query loads one kind of rows of a window into a variable of the source
+type Query func(ctx context.Context) error
+
+// RunQueries runs the queries of a window concurrently, at most maxParallel at a time, and waits for all of them. A
+// failed query does not stop the others, so their rows are still sent. The errors of all queries are joined.
+func RunQueries(ctx context.Context, maxParallel int, queries ...Query) error {
+	if maxParallel <= 0 || maxParallel > len(queries) {
+		maxParallel = len(queries)
+	}
+	slots := make(chan struct{}, maxParallel)
+	queryErrors := make([]error, len(queries))
+
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func(i int, query Query) {
+			defer wg.Done()
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				// the deadline of the tick passed while waiting for a slot
+				queryErrors[i] = ctx.Err()
+				return
+			}
+			defer func() { <-slots }()
+			queryErrors[i] = query(ctx)
+		}(i, query)
+	}
+	wg.Wait()
+
+	return errors.Join(queryErrors...)
+}
@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRunQueriesBoundsParallelism(t *testing.T) {
+	var lock sync.Mutex
+	running, maxRunning := 0, 0
+	query := func(ctx context.Context) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		lock.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		lock.Lock()
+		running--
+		lock.Unlock()
+		return nil
+	}
+
+	if err := RunQueries(context.Background(), 2, query, query, query, query, query); err != nil {
+		t.Errorf("Error of successful queries. Expected: nil, Got: %v", err)
+	}
+	if maxRunning != 2 {
+		t.Errorf("Queries running at the same time. Expected: %v, Got: %v", 2, maxRunning)
+	}
+}
+
+func TestRunQueriesKeepsResultsOfOthers(t *testing.T) {
+	queryError := errors.New("query failed")
+	var blocks, transactions []string
+
+	err := RunQueries(context.Background(), 3,
+		func(ctx context.Context) error {
+			blocks = []string{"block"}
+			return nil
+		},
+		func(ctx context.Context) error {
+			return queryError
+		},
+		func(ctx context.Context) error {
+			transactions = []string{"transaction"}
+			return nil
+		})
+
+	if !errors.Is(err, queryError) {
+		t.Errorf("Joined error. Expected: %v, Got: %v", queryError, err)
+	}
+	if len(blocks) != 1 || len(transactions) != 1 {
+		t.Errorf("Rows of the other queries. Expected: 1 and 1, Got: %v and %v", len(blocks), len(transactions))
+	}
+}
+
+func TestRunQueriesSharesDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	slow := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	start := time.Now()
+	err := RunQueries(ctx, 1, slow, slow, slow)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Queries waiting for a slot outlasted the deadline. Took: %v", elapsed)
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error after the deadline. Expected: %v, Got: %v", context.DeadlineExceeded, err)
+	}
+}
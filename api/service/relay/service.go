@@ -0,0 +1,203 @@
+package relay
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/service"
+	"api/utils/log"
+	"api/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+)
+
+// Service re-broadcasts the frames of a service of another hatnote api. It needs no database, the DatabaseInfo of the
+// upstream frames is passed on unchanged, so the clients still see the database status of the upstream. The upstream
+// is consumed like any client, through its public websocket endpoint with an access token, and frames missed while
+// reconnecting are resumed from its replay buffer. To scale out the endpoints of one deployment on its internal
+// network, the relayEdge broker of the websocket package is the better fit, its edges need no upstream endpoint.
+type Service struct {
+	WebsocketController websocket.WebsocketInterface
+	Config              service.ServiceConfig
+	upstreamLock        sync.Mutex
+	upstream            *gorilla.Conn
+	lastFromTimepoint   int64
+	done                chan bool
+	wsErrorCheckerDone  chan bool
+}
+
+func (sc *Service) Init(institutesController institutes.Controller, geoController geo.Controller) {
+	log.Info(fmt.Sprint("Init relay service for ", sc.Config.Name, "."), log.Relay, log.Service)
+	sc.wsErrorCheckerDone = make(chan bool)
+	wsErrorChannel := sc.WebsocketController.GetErrorChannel()
+	go func() {
+		for {
+			select {
+			case <-sc.wsErrorCheckerDone:
+				return
+			case err := <-*wsErrorChannel:
+				log.Error(fmt.Sprint("While trying to serve a websocket connection for the ", sc.Config.Name, " relay there was an error."), err, log.Relay, log.Service)
+				sc.StopService()
+				return
+			}
+		}
+	}()
+	sc.WebsocketController.InitAndStartOnce(sc.Config.Websocket)
+}
+
+func (sc *Service) GetName() string {
+	return sc.Config.Name
+}
+
+func (sc *Service) GetDatabaseController() interface{} {
+	return nil
+}
+
+// institutes and geo information are resolved by the upstream
+func (sc *Service) UpdateInstitutesData() {}
+
+func (sc *Service) UpdateGeoInformation() {}
+
+func (sc *Service) StartService() *chan bool {
+	log.Info(fmt.Sprint("Starting relay service for ", sc.Config.Name, " from ", sc.Config.Upstream.URL, "."), log.Relay, log.Service)
+	sc.done = make(chan bool)
+	go sc.consumeUpstream(sc.done)
+	return &sc.done
+}
+
+func (sc *Service) StopService() {
+	log.Info(fmt.Sprint("Stop relay service for ", sc.Config.Name, "."), log.Relay, log.Service)
+	if sc.done != nil {
+		// the upstream reader may be blocked in a read, so the channel is closed instead of sent to
+		close(sc.done)
+		sc.done = nil
+	}
+	sc.closeUpstream()
+
+	sc.WebsocketController.StopWebsocket()
+
+	if sc.wsErrorCheckerDone != nil {
+		select {
+		case sc.wsErrorCheckerDone <- true:
+		default:
+		}
+		close(sc.wsErrorCheckerDone)
+		sc.wsErrorCheckerDone = nil
+	}
+}
+
+func (sc *Service) consumeUpstream(done chan bool) {
+	for {
+		retryAfter := time.Duration(sc.Config.Upstream.ReconnectInterval) * time.Millisecond
+		upstream, err := sc.connect(done)
+		if err != nil {
+			log.Warn(fmt.Sprint("Could not connect to upstream ", sc.Config.Upstream.URL, ". Retrying in ", retryAfter, ". Error: ", err), log.Relay)
+		} else if upstream != nil {
+			log.Info(fmt.Sprint("Connected to upstream ", sc.Config.Upstream.URL, "."), log.Relay)
+			if upstreamRetryAfter := sc.receive(upstream); upstreamRetryAfter > 0 {
+				retryAfter = upstreamRetryAfter
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-time.After(retryAfter):
+		}
+	}
+}
+
+// connect resumes after the last received frame, so nothing within the replay duration of the upstream is lost while
+// reconnecting. It returns no connection if the service was stopped meanwhile.
+func (sc *Service) connect(done chan bool) (*gorilla.Conn, error) {
+	upstreamUrl, err := url.Parse(sc.Config.Upstream.URL)
+	if err != nil {
+		return nil, err
+	}
+	sc.upstreamLock.Lock()
+	lastFromTimepoint := sc.lastFromTimepoint
+	sc.upstreamLock.Unlock()
+	if lastFromTimepoint > 0 {
+		query := upstreamUrl.Query()
+		query.Set("resume", strconv.FormatInt(lastFromTimepoint, 10))
+		upstreamUrl.RawQuery = query.Encode()
+	}
+	header := http.Header{}
+	if len(sc.Config.Upstream.AccessToken) > 0 {
+		header.Set("Authorization", "Bearer "+sc.Config.Upstream.AccessToken)
+	}
+
+	upstream, _, err := gorilla.DefaultDialer.Dial(upstreamUrl.String(), header)
+	if err != nil {
+		return nil, err
+	}
+	sc.upstreamLock.Lock()
+	defer sc.upstreamLock.Unlock()
+	select {
+	case <-done:
+		upstream.Close()
+		return nil, nil
+	default:
+	}
+	sc.upstream = upstream
+	return upstream, nil
+}
+
+// receive re-broadcasts the upstream frames until the connection breaks. It returns the reconnect delay the upstream
+// asked for when it went away, 0 otherwise.
+func (sc *Service) receive(upstream *gorilla.Conn) (retryAfter time.Duration) {
+	defer upstream.Close()
+	idleTimeout := time.Duration(sc.Config.Upstream.IdleTimeout) * time.Millisecond
+	upstream.SetReadDeadline(time.Now().Add(idleTimeout))
+	upstream.SetPingHandler(func(appData string) error {
+		upstream.SetReadDeadline(time.Now().Add(idleTimeout))
+		return upstream.WriteControl(gorilla.PongMessage, []byte(appData), time.Now().Add(time.Second))
+	})
+
+	for {
+		_, message, err := upstream.ReadMessage()
+		if err != nil {
+			log.Warn(fmt.Sprint("Lost connection to upstream ", sc.Config.Upstream.URL, ". Error: ", err), log.Relay)
+			return
+		}
+		upstream.SetReadDeadline(time.Now().Add(idleTimeout))
+
+		var control websocket.ControlMessage
+		if err = json.Unmarshal(message, &control); err == nil && len(control.Control) > 0 {
+			if control.Control == websocket.ControlGoingAway {
+				log.Info(fmt.Sprint("Upstream ", sc.Config.Upstream.URL, " is going away. Reconnecting in ", control.RetryAfter, " ms."), log.Relay)
+				retryAfter = time.Duration(control.RetryAfter) * time.Millisecond
+			}
+			continue
+		}
+		var data websocket.EventData
+		if err = json.Unmarshal(message, &data); err != nil {
+			log.Error(fmt.Sprint("Could not decode frame of upstream ", sc.Config.Upstream.URL, "."), err, log.Relay)
+			continue
+		}
+
+		sc.upstreamLock.Lock()
+		if data.EventInfo.FromTimepoint > sc.lastFromTimepoint {
+			sc.lastFromTimepoint = data.EventInfo.FromTimepoint
+		}
+		sc.upstreamLock.Unlock()
+		// the clients of this instance are counted here, everything else comes from the upstream
+		data.EventInfo.ActiveConnections = sc.WebsocketController.GetActiveConnections()
+		sc.WebsocketController.SendDataInBulk(data)
+	}
+}
+
+func (sc *Service) closeUpstream() {
+	sc.upstreamLock.Lock()
+	defer sc.upstreamLock.Unlock()
+	if sc.upstream != nil {
+		sc.upstream.Close()
+		sc.upstream = nil
+	}
+}
@@ -0,0 +1,90 @@
+package relay
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/service"
+	"api/websocket"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gorilla "github.com/gorilla/websocket"
+)
+
+// within this directory: go test
+
+type recordingWebsocket struct {
+	lock   sync.Mutex
+	frames []websocket.EventData
+}
+
+func (rw *recordingWebsocket) SendDataInBulk(data websocket.EventData) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	rw.frames = append(rw.frames, data)
+}
+func (rw *recordingWebsocket) InitAndStartOnce(config websocket.Config) {}
+func (rw *recordingWebsocket) GetErrorChannel() *chan error {
+	errorChannel := make(chan error)
+	return &errorChannel
+}
+func (rw *recordingWebsocket) StopWebsocket()            {}
+func (rw *recordingWebsocket) GetActiveConnections() int { return 3 }
+
+func (rw *recordingWebsocket) received() []websocket.EventData {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	return append([]websocket.EventData(nil), rw.frames...)
+}
+
+func TestRelayRebroadcastsAndResumes(t *testing.T) {
+	resumes := make(chan string, 2)
+	upgrader := gorilla.Upgrader{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resumes <- r.URL.Query().Get("resume")
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.WriteJSON(websocket.EventData{Data: "{}", EventInfo: websocket.EventInfo{Service: "keeper", FromTimepoint: 1000,
+			ActiveConnections: 100, DatabaseInfo: websocket.DatabaseInfo{IsConnecting: true, NumberOfDbReconnects: 2}}})
+		conn.WriteJSON(websocket.ControlMessage{Control: websocket.ControlGoingAway, RetryAfter: 10})
+	}))
+	t.Cleanup(upstream.Close)
+
+	recorder := &recordingWebsocket{}
+	sc := &Service{WebsocketController: recorder, Config: service.ServiceConfig{Name: "keeper",
+		Upstream: service.UpstreamConfig{URL: "ws" + strings.TrimPrefix(upstream.URL, "http"), ReconnectInterval: 5000, IdleTimeout: 5000}}}
+	sc.Init(institutes.Controller{}, geo.Controller{})
+	sc.StartService()
+	t.Cleanup(sc.StopService)
+
+	// the going away message shortens the reconnect interval, the reconnect resumes after the received frame
+	for i, expected := range []string{"", "1000"} {
+		select {
+		case resume := <-resumes:
+			if resume != expected {
+				t.Errorf("Resume of connection %v. Expected: %q, Got: %q", i, expected, resume)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Relay did not connect %v times.", i+1)
+		}
+	}
+
+	frames := recorder.received()
+	if len(frames) == 0 {
+		t.Fatalf("No frame re-broadcast.")
+	}
+	if frames[0].EventInfo.ActiveConnections != 3 {
+		t.Errorf("Active connections. Expected: %v, Got: %v", 3, frames[0].EventInfo.ActiveConnections)
+	}
+	databaseInfo := frames[0].EventInfo.DatabaseInfo
+	if !databaseInfo.IsConnecting || databaseInfo.NumberOfDbReconnects != 2 {
+		t.Errorf("Upstream database info. Expected: %v, Got: %v", "connecting after 2 reconnects", databaseInfo)
+	}
+}
@@ -0,0 +1,136 @@
+package service
+
+import (
+	"api/geo"
+	"api/institutes"
+	"api/utils/log"
+	"api/utils/observer"
+	"api/websocket"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Database is the connection handling every source database has in common
+type Database interface {
+	Init() error
+	IsInitialised() bool
+	IsConnecting() bool
+	SetIsConnecting(bool)
+	Ping(ctx context.Context) error
+	CloseConnection() error
+}
+
+// Notifier is implemented by databases with a push mode. A notification makes the poller load its window right away.
+// While IsListening, ticks only poll every push poll interval, as a safety net for missed notifications.
+type Notifier interface {
+	Notifications() <-chan struct{}
+	IsListening() bool
+}
+
+// LocationRefresher is implemented by databases that detect the time zone of their clock. The poller refreshes it once
+// per tick before the window is loaded, so the rows are converted without queries and all in the same time zone.
+type LocationRefresher interface {
+	RefreshLocation(ctx context.Context)
+}
+
+// Window is the time span a poll covers. Sources convert it to the time zone of their database.
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// Source is the service specific part of a polling service. The Poller does everything else: ticking, the database
+// reconnects, the websocket and building the EventData frames.
+type Source interface {
+	observer.UpdatableInstitutesData
+	observer.UpdatableGeoInformation
+
+	Init(institutesController institutes.Controller, geoController geo.Controller)
+	Database() Database
+	// Load queries the rows of the window. If a query fails, the rows of the other queries are returned with the error.
+	// The context is cancelled when the service stops.
+	Load(ctx context.Context, window Window) (rows interface{}, err error)
+	// Filter keeps the rows for which fresh returns true. Windows overlap by the lookback, fresh drops the rows that
+	// were already sent.
+	Filter(rows interface{}, fresh func(key RowKey) bool) (freshRows interface{})
+	// Map turns the loaded rows into the service data of the frame, e.g. websocket.KeeperData
+	Map(rows interface{}) (serviceData interface{})
+}
+
+// SourceRegistration describes how to create a source and how its environment yaml is read
+type SourceRegistration struct {
+	NewSource    func(config ServiceConfig, mockDatabase bool) Source
+	Validate     func(config ServiceConfig) error // optional, checks the config before the source is created
+	IntervalUnit time.Duration                    // unit of the query interval in the environment yaml
+	MinInterval  int64                            // smaller query intervals are raised to this
+	LogConcern   log.Concern
+}
+
+var (
+	sources     = make(map[string]SourceRegistration)
+	sourcesLock sync.RWMutex
+)
+
+// RegisterSource is called from the init function of the source packages. Importing a source package makes the
+// service available in the environment yaml under its name.
+func RegisterSource(name string, registration SourceRegistration) {
+	sourcesLock.Lock()
+	defer sourcesLock.Unlock()
+	if _, exists := sources[name]; exists {
+		panic(fmt.Sprint("source ", name, " is registered twice"))
+	}
+	sources[name] = registration
+}
+
+func lookupSource(name string) (SourceRegistration, bool) {
+	sourcesLock.RLock()
+	defer sourcesLock.RUnlock()
+	registration, exists := sources[name]
+	return registration, exists
+}
+
+// RegisteredSources returns the names of all registered sources in alphabetical order
+func RegisteredSources() (names []string) {
+	sourcesLock.RLock()
+	defer sourcesLock.RUnlock()
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return
+}
+
+// MinQueryInterval returns the smallest query interval the source of the service allows
+func MinQueryInterval(name string) int64 {
+	registration, _ := lookupSource(name)
+	return registration.MinInterval
+}
+
+// QueryInterval returns the query interval of the service in the unit of its source, 0 for services without a source
+func QueryInterval(config ServiceConfig) time.Duration {
+	registration, _ := lookupSource(config.SourceName())
+	return time.Duration(config.QueryInterval) * registration.IntervalUnit
+}
+
+// NewPoller creates the polling service for the source registered under the source name of the service config
+func NewPoller(config ServiceConfig, websocketController websocket.WebsocketInterface, mockDatabase bool) (*Poller, error) {
+	registration, exists := lookupSource(config.SourceName())
+	if !exists {
+		return nil, errors.New(fmt.Sprint("unknown service ", config.SourceName(), ", registered services are ", RegisteredSources()))
+	}
+	if registration.Validate != nil {
+		if err := registration.Validate(config); err != nil {
+			return nil, fmt.Errorf("invalid config of service %s: %w", config.Name, err)
+		}
+	}
+	return &Poller{
+		Source:              registration.NewSource(config, mockDatabase),
+		WebsocketController: websocketController,
+		Config:              config,
+		registration:        registration,
+	}, nil
+}
@@ -0,0 +1,286 @@
+package sqlsource
+
+import (
+	"api/database"
+	"api/service"
+	"api/utils/log"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+)
+
+const (
+	fromPlaceholder = "{from}"
+	toPlaceholder   = "{to}"
+	defaultKind     = "Events"
+)
+
+// time zone of the database clock by driver, for the timezone 'auto'
+var clockQueries = map[string]database.ClockQueries{
+	"postgres": database.PostgresClock,
+	"mysql":    database.MysqlClock,
+}
+
+// timestamp strings the drivers return, e.g. for DATETIME columns of mysql
+var timestampLayouts = []string{"2006-01-02 15:04:05.999999999", time.RFC3339Nano}
+
+type Database struct {
+	db           *sqlx.DB
+	Config       database.Config
+	Sql          service.SqlConfig
+	Name         string // of the service, for the logs
+	isConnecting bool
+	clock        *database.Clock
+}
+
+type DatabaseInterface interface {
+	service.Database
+	// Location is the time zone of the timestamp columns, the timepoint strings are formatted in it
+	Location() *time.Location
+	LoadEvents(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidEvent, queryError error)
+}
+
+// ValidateConfig checks the parts of the config the environment yaml has to define for a sql service
+func ValidateConfig(config service.ServiceConfig) error {
+	if _, exists := clockQueries[config.Sql.Driver]; !exists {
+		return errors.New(fmt.Sprint("unknown driver ", config.Sql.Driver, ", known drivers are postgres and mysql"))
+	}
+	if !strings.Contains(config.Sql.Query, fromPlaceholder) || !strings.Contains(config.Sql.Query, toPlaceholder) {
+		return errors.New(fmt.Sprint("query has to contain the placeholders ", fromPlaceholder, " and ", toPlaceholder))
+	}
+	if len(config.Sql.Columns.Timestamp) == 0 || len(config.Sql.Columns.Domain) == 0 {
+		return errors.New("timestamp and domain column have to be set")
+	}
+	// the rows of the lookback are loaded again, without id the late rows can not be told apart from the sent ones
+	if config.Watermark.Lookback > 0 && len(config.Sql.Columns.Id) == 0 {
+		return errors.New("id column has to be set for a watermark lookback")
+	}
+	return nil
+}
+
+func (dbc *Database) dataSourceName() string {
+	if dbc.Sql.Driver == "mysql" {
+		// for parameter description see: https://github.com/go-sql-driver/mysql#dsn-data-source-name
+		return fmt.Sprintf("%s:%s@(%s:%d)/%s",
+			dbc.Config.User, dbc.Config.Password, dbc.Config.Host, dbc.Config.Port, dbc.Config.DBName)
+	}
+	// for parameter description see: https://pkg.go.dev/github.com/lib/pq
+	return fmt.Sprintf("user=%s password=%s dbname=%s host=%s port=%d connect_timeout=10 sslmode=disable",
+		dbc.Config.User, dbc.Config.Password, dbc.Config.DBName, dbc.Config.Host, dbc.Config.Port)
+}
+
+func (dbc *Database) Init() error {
+	log.Info(fmt.Sprint(dbc.Name, " init db."), log.Sql, log.Database)
+	dbc.isConnecting = true
+	db, err := sqlx.Connect(dbc.Sql.Driver, dbc.dataSourceName())
+	if err != nil {
+		dbc.db = nil
+		dbc.isConnecting = false
+		logMessage := fmt.Sprint("Can not connect to ", dbc.Name, " DB")
+		log.Error(logMessage, err, log.Sql, log.Database)
+		return err
+	}
+
+	if dbc.clock == nil {
+		dbc.clock = database.NewClock(dbc.Config, clockQueries[dbc.Sql.Driver], log.Sql)
+	}
+	dbc.clock.Connect(db)
+	dbc.isConnecting = false
+	dbc.db = db
+
+	return err
+}
+
+func (dbc *Database) Location() *time.Location {
+	if dbc.clock == nil {
+		return time.UTC
+	}
+	return dbc.clock.Location()
+}
+
+func (dbc *Database) RefreshLocation(ctx context.Context) {
+	if dbc.clock != nil {
+		dbc.clock.Refresh(ctx)
+	}
+}
+
+func (dbc *Database) IsInitialised() bool {
+	return dbc.db != nil
+}
+
+func (dbc *Database) IsConnecting() bool {
+	return dbc.isConnecting
+}
+
+func (dbc *Database) SetIsConnecting(isConnecting bool) {
+	dbc.isConnecting = isConnecting
+}
+
+func (dbc *Database) Ping(ctx context.Context) error {
+	return dbc.db.PingContext(ctx)
+}
+
+func (dbc *Database) CloseConnection() error {
+	log.Warn(fmt.Sprint("Closing ", dbc.Name, " DB connection."), log.Sql, log.Database)
+	err := dbc.db.Close()
+	if err != nil {
+		log.Error(fmt.Sprint("Can not close ", dbc.Name, " DB connection"), err, log.Sql, log.Database)
+	}
+	dbc.db = nil
+
+	return err
+}
+
+func (dbc *Database) LoadEvents(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidEvent, queryError error) {
+	if dbc.db == nil {
+		log.Warn(fmt.Sprint(dbc.Name, " DB not initialised."), log.Sql, log.Database)
+		return
+	}
+
+	query, args := windowQuery(dbc.Sql.Query, fromTimepoint, toTimepoint)
+	queryCtx, cancel := dbc.Config.QueryContext(ctx, "events")
+	defer cancel()
+	queryStart := time.Now()
+	// do the query
+	rows, queryError := dbc.db.QueryxContext(queryCtx, dbc.db.Rebind(query), args...)
+	if queryError == nil {
+		defer rows.Close()
+		for rows.Next() {
+			row := make(map[string]interface{})
+			if queryError = rows.MapScan(row); queryError != nil {
+				break
+			}
+			validEvent, err := dbc.validate(row)
+			if err != nil {
+				log.Error(fmt.Sprint("Skipping invalid ", dbc.Name, " row."), err, log.Sql, log.Database)
+				continue
+			}
+			validData = append(validData, validEvent)
+		}
+		if queryError == nil {
+			queryError = rows.Err()
+		}
+	}
+	queryElapsed := time.Since(queryStart)
+	if queryElapsed.Milliseconds() > 1000 {
+		logMessage := fmt.Sprint("Query for loading ", dbc.Name, " events took unexpectedly long: ", queryElapsed.Milliseconds(), " ms")
+		log.Warn(logMessage, log.Sql, log.Database)
+	}
+	if queryError != nil {
+		logMessage := fmt.Sprint("Error while loading ", dbc.Name, " events.")
+		log.Error(logMessage, queryError, log.Sql, log.Database)
+		return validData, queryError
+	}
+
+	return
+}
+
+// windowQuery replaces the placeholders of the window by bind parameters, in the order they appear in the query
+func windowQuery(query string, fromTimepoint string, toTimepoint string) (string, []interface{}) {
+	var sb strings.Builder
+	var args []interface{}
+	for {
+		fromIndex, toIndex := strings.Index(query, fromPlaceholder), strings.Index(query, toPlaceholder)
+		if fromIndex < 0 && toIndex < 0 {
+			sb.WriteString(query)
+			return sb.String(), args
+		}
+		if toIndex < 0 || (fromIndex >= 0 && fromIndex < toIndex) {
+			sb.WriteString(query[:fromIndex])
+			args = append(args, fromTimepoint)
+			query = query[fromIndex+len(fromPlaceholder):]
+		} else {
+			sb.WriteString(query[:toIndex])
+			args = append(args, toTimepoint)
+			query = query[toIndex+len(toPlaceholder):]
+		}
+		sb.WriteString("?")
+	}
+}
+
+// validate maps the configured columns of a row to an event
+func (dbc *Database) validate(row map[string]interface{}) (validEvent ValidEvent, err error) {
+	columns := dbc.Sql.Columns
+	timestamp, err := dbc.parseTimestamp(row[columns.Timestamp])
+	if err != nil {
+		return validEvent, fmt.Errorf("column %s: %w", columns.Timestamp, err)
+	}
+	validEvent.Timestamp = timestamp.UnixMilli()
+
+	validEvent.Domain = asString(row[columns.Domain])
+	if _, domain, isEmail := strings.Cut(validEvent.Domain, "@"); isEmail {
+		validEvent.Domain = domain
+	}
+	if len(validEvent.Domain) == 0 {
+		return validEvent, errors.New(fmt.Sprint("column ", columns.Domain, " is empty"))
+	}
+
+	if len(columns.Id) > 0 {
+		validEvent.Id = asString(row[columns.Id])
+	}
+	if len(columns.Kind) > 0 {
+		validEvent.Kind = asString(row[columns.Kind])
+	}
+	if len(validEvent.Kind) == 0 {
+		validEvent.Kind = dbc.Sql.Kind
+	}
+	if len(validEvent.Kind) == 0 {
+		validEvent.Kind = defaultKind
+	}
+	if len(columns.Magnitude) > 0 && row[columns.Magnitude] != nil {
+		if validEvent.Magnitude, err = strconv.ParseFloat(asString(row[columns.Magnitude]), 64); err != nil {
+			return validEvent, fmt.Errorf("column %s: %w", columns.Magnitude, err)
+		}
+		if validEvent.Magnitude < 0 {
+			validEvent.Magnitude = 0
+			log.Warn("Magnitude was smaller than 0. Setting it to 0.", log.Sql, log.Database)
+		}
+	}
+	return
+}
+
+// parseTimestamp reads timestamps as the drivers return them, strings and timestamps without time zone are in the
+// time zone of the database, numbers are unix seconds
+func (dbc *Database) parseTimestamp(value interface{}) (time.Time, error) {
+	switch typed := value.(type) {
+	case time.Time:
+		return database.WallClockIn(typed, dbc.Location()), nil
+	case int64:
+		return time.Unix(typed, 0), nil
+	case float64:
+		return time.UnixMilli(int64(typed * 1000)), nil
+	case nil:
+		return time.Time{}, errors.New("timestamp is null")
+	}
+
+	timestamp := asString(value)
+	if seconds, err := strconv.ParseInt(timestamp, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	for _, layout := range timestampLayouts {
+		if parsed, err := time.ParseInLocation(layout, timestamp, dbc.Location()); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, errors.New(fmt.Sprint("can not parse timestamp ", timestamp))
+}
+
+func asString(value interface{}) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case []byte:
+		return string(typed)
+	default:
+		return fmt.Sprint(typed)
+	}
+}
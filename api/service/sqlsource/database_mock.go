@@ -0,0 +1,63 @@
+package sqlsource
+
+import (
+	"api/service"
+	"api/utils/log"
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+)
+
+type DatabaseMock struct {
+	Config service.ServiceConfig
+}
+
+func (dbc *DatabaseMock) Init() error {
+	return nil
+}
+
+func (dbc *DatabaseMock) IsInitialised() bool {
+	return true
+}
+func (dbc *DatabaseMock) IsConnecting() bool {
+	return false
+}
+func (dbc *DatabaseMock) SetIsConnecting(isConnecting bool) {
+	return
+}
+func (dbc *DatabaseMock) Ping(ctx context.Context) error {
+	return nil
+}
+func (dbc *DatabaseMock) CloseConnection() error { return nil }
+func (dbc *DatabaseMock) Location() *time.Location {
+	return time.UTC
+}
+func (dbc *DatabaseMock) LoadEvents(ctx context.Context, fromTimepoint string, toTimepoint string) (validData []ValidEvent, queryError error) {
+	var plusTime = rand.Int63n(dbc.Config.QueryInterval)
+	var fromTimePointTime, err = time.ParseInLocation(time.DateTime, fromTimepoint, dbc.Location())
+	if err != nil {
+		log.Error("There was a problem converting db string date to Time object", err, log.Sql, log.Mock, log.Database)
+	}
+
+	kind := dbc.Config.Sql.Kind
+	if len(kind) == 0 {
+		kind = defaultKind
+	}
+	timestamp := fromTimePointTime.Unix() + plusTime
+	validData = append(validData,
+		ValidEvent{
+			Id:        strconv.FormatInt(timestamp, 10) + "-1",
+			Timestamp: timestamp * 1000,
+			Magnitude: 199585,
+			Domain:    "aaa.de",
+			Kind:      kind},
+		ValidEvent{
+			Id:        strconv.FormatInt(timestamp, 10) + "-2",
+			Timestamp: timestamp * 1000,
+			Magnitude: 40568,
+			Domain:    "bbb.de",
+			Kind:      kind})
+
+	return
+}
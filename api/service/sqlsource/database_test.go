@@ -0,0 +1,104 @@
+package sqlsource
+
+import (
+	"api/database"
+	"api/service"
+	"api/utils/log"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWindowQuery(t *testing.T) {
+	tests := []struct {
+		query         string
+		expectedQuery string
+		expectedArgs  []interface{}
+	}{
+		{"SELECT * FROM events WHERE created BETWEEN {from} AND {to}", "SELECT * FROM events WHERE created BETWEEN ? AND ?", []interface{}{"from", "to"}},
+		{"SELECT * FROM events WHERE created <= {to} AND created >= {from}", "SELECT * FROM events WHERE created <= ? AND created >= ?", []interface{}{"to", "from"}},
+		{"SELECT * FROM a WHERE t > {from} AND t <= {to} UNION SELECT * FROM b WHERE t > {from} AND t <= {to}",
+			"SELECT * FROM a WHERE t > ? AND t <= ? UNION SELECT * FROM b WHERE t > ? AND t <= ?", []interface{}{"from", "to", "from", "to"}},
+	}
+
+	for _, test := range tests {
+		query, args := windowQuery(test.query, "from", "to")
+		if query != test.expectedQuery || !reflect.DeepEqual(args, test.expectedArgs) {
+			t.Errorf("Window query of %v. Expected: %v %v, Got: %v %v", test.query, test.expectedQuery, test.expectedArgs, query, args)
+		}
+	}
+}
+
+func TestValidateRow(t *testing.T) {
+	dbc := &Database{Sql: service.SqlConfig{Kind: "Uploads", Columns: service.SqlColumns{
+		Id: "id", Timestamp: "created", Magnitude: "size", Domain: "email", Kind: "kind"}},
+		clock: database.NewClock(database.Config{Timezone: "Europe/Berlin"}, database.MysqlClock, log.Sql)}
+
+	tests := []struct {
+		row      map[string]interface{}
+		expected ValidEvent
+		message  string
+	}{
+		{map[string]interface{}{"id": int64(1), "created": []byte("2024-05-06 10:00:01"), "size": []byte("12.5"), "email": []byte("user@mpdl.mpg.de"), "kind": nil},
+			ValidEvent{"1", 1714982401000, 12.5, "mpdl.mpg.de", "Uploads"}, "Datetime string of mysql in the time zone of the database"},
+		{map[string]interface{}{"id": "a", "created": time.Date(2024, 5, 6, 10, 0, 1, 0, time.UTC), "size": int64(3), "email": "mpdl.mpg.de", "kind": "Downloads"},
+			ValidEvent{"a", 1714982401000, 3, "mpdl.mpg.de", "Downloads"}, "Timestamp without time zone of postgres"},
+		{map[string]interface{}{"id": int64(2), "created": int64(1714982401), "size": nil, "email": "user@mpdl.mpg.de", "kind": ""},
+			ValidEvent{"2", 1714982401000, 0, "mpdl.mpg.de", "Uploads"}, "Unix seconds"},
+		{map[string]interface{}{"id": int64(3), "created": "2024-05-06T08:00:01.5Z", "size": int64(-1), "email": "user@mpdl.mpg.de"},
+			ValidEvent{"3", 1714982401500, 0, "mpdl.mpg.de", "Uploads"}, "RFC 3339 string and negative magnitude"},
+	}
+
+	for _, test := range tests {
+		validEvent, err := dbc.validate(test.row)
+		if err != nil || validEvent != test.expected {
+			t.Errorf("%v. Expected: %v, Got: %v, %v", test.message, test.expected, validEvent, err)
+		}
+	}
+
+	invalidRows := []map[string]interface{}{
+		{"created": nil, "email": "user@mpdl.mpg.de"},
+		{"created": "yesterday", "email": "user@mpdl.mpg.de"},
+		{"created": int64(1714982401), "email": nil},
+		{"created": int64(1714982401), "email": "user@mpdl.mpg.de", "size": "big"},
+	}
+	for _, row := range invalidRows {
+		if _, err := dbc.validate(row); err == nil {
+			t.Errorf("Invalid row %v was accepted.", row)
+		}
+	}
+}
+
+func TestValidateConfig(t *testing.T) {
+	valid := service.SqlConfig{Driver: "postgres", Query: "SELECT * FROM events WHERE created > {from} AND created <= {to}",
+		Columns: service.SqlColumns{Timestamp: "created", Domain: "email"}}
+
+	tests := []struct {
+		modify   func(config *service.SqlConfig)
+		expected bool
+		message  string
+	}{
+		{func(config *service.SqlConfig) {}, true, "Postgres config"},
+		{func(config *service.SqlConfig) { config.Driver = "mysql" }, true, "Mysql config"},
+		{func(config *service.SqlConfig) { config.Driver = "sqlite" }, false, "Unknown driver"},
+		{func(config *service.SqlConfig) { config.Query = "SELECT * FROM events WHERE created > {from}" }, false, "Query without {to}"},
+		{func(config *service.SqlConfig) { config.Columns.Domain = "" }, false, "Missing domain column"},
+	}
+
+	for _, test := range tests {
+		config := valid
+		test.modify(&config)
+		if err := ValidateConfig(service.ServiceConfig{Sql: config}); (err == nil) != test.expected {
+			t.Errorf("%v. Expected valid: %v, Got: %v", test.message, test.expected, err)
+		}
+	}
+
+	lookback := service.WatermarkConfig{Lookback: 5000}
+	if err := ValidateConfig(service.ServiceConfig{Sql: valid, Watermark: lookback}); err == nil {
+		t.Errorf("Lookback without id column. Expected valid: false, Got: %v", err)
+	}
+	valid.Columns.Id = "id"
+	if err := ValidateConfig(service.ServiceConfig{Sql: valid, Watermark: lookback}); err != nil {
+		t.Errorf("Lookback with id column. Expected valid: true, Got: %v", err)
+	}
+}
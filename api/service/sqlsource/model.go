@@ -0,0 +1,10 @@
+package sqlsource
+
+// ValidEvent is a row of the query of a sql service
+type ValidEvent struct {
+	Id        string
+	Timestamp int64 // milliseconds
+	Magnitude float64
+	Domain    string
+	Kind      string
+}
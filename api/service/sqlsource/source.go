@@ -0,0 +1,87 @@
+package sqlsource
+
+import (
+	"api/service"
+	"api/utils/log"
+	"api/websocket"
+	"context"
+	"sort"
+	"time"
+)
+
+func init() {
+	service.RegisterSource("sql", service.SourceRegistration{
+		NewSource: func(config service.ServiceConfig, mockDatabase bool) service.Source {
+			if mockDatabase {
+				return &Source{DatabaseController: &DatabaseMock{Config: config}, Enrichment: service.Enrichment{Concern: log.Sql}}
+			}
+			return &Source{DatabaseController: &Database{Config: config.Database, Sql: config.Sql, Name: config.Name},
+				Enrichment: service.Enrichment{Concern: log.Sql}}
+		},
+		Validate:     ValidateConfig,
+		IntervalUnit: time.Second,
+		MinInterval:  1,
+		LogConcern:   log.Sql,
+	})
+}
+
+// Source runs the query of a service of type sql, the rows go through the same institute and geo enrichment as keeper
+type Source struct {
+	DatabaseController DatabaseInterface
+	service.Enrichment
+}
+
+func (s *Source) Database() service.Database {
+	return s.DatabaseController
+}
+
+func (s *Source) Load(ctx context.Context, window service.Window) (interface{}, error) {
+	// timestamp columns without time zone are compared in the time zone of the database
+	location := s.DatabaseController.Location()
+	var fromTimePointStr = window.From.In(location).Format(time.DateTime)
+	var toTimepointStr = window.To.In(location).Format(time.DateTime)
+
+	return s.DatabaseController.LoadEvents(ctx, fromTimePointStr, toTimepointStr)
+}
+
+// Filter drops the rows of the lookback overlap that were already sent. The query of the yaml does not have to order
+// its rows, they are sorted by timestamp and id first, so the frame is in order.
+func (s *Source) Filter(loadedRows interface{}, fresh func(key service.RowKey) bool) interface{} {
+	events := loadedRows.([]ValidEvent)
+	sort.SliceStable(events, func(i, j int) bool {
+		if events[i].Timestamp != events[j].Timestamp {
+			return events[i].Timestamp < events[j].Timestamp
+		}
+		// numeric ids order numerically if they are compared by length first
+		if len(events[i].Id) != len(events[j].Id) {
+			return len(events[i].Id) < len(events[j].Id)
+		}
+		return events[i].Id < events[j].Id
+	})
+
+	var freshRows []ValidEvent
+	for _, event := range events {
+		if fresh(service.RowKey{Stream: event.Kind, Timestamp: event.Timestamp, Id: event.Id}) {
+			freshRows = append(freshRows, event)
+		}
+	}
+	return freshRows
+}
+
+// Map finds the institute names for the events and builds the websocket data
+func (s *Source) Map(loadedRows interface{}) interface{} {
+	websocketEventData := websocket.GenericData{}
+	for _, event := range loadedRows.([]ValidEvent) {
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := s.InstituteName(event.Domain)
+
+		websocketEventData[event.Kind] = append(websocketEventData[event.Kind], websocket.GenericEvent{
+			Timestamp:     event.Timestamp,
+			Magnitude:     event.Magnitude,
+			InstituteName: instituteName,
+			Location:      s.Location(event.Domain),
+		})
+	}
+
+	return websocketEventData
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"api/utils/log"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// The poller queries incrementally: every window starts where the last complete window ended, so ticker jitter, slow
+// queries and dropped ticks leave no gaps. The window reaches back by the lookback to catch rows that were committed
+// late with an older timestamp. The rows of the overlap were mostly sent already, the tracker remembers the key of every
+// row it let through until the row falls out of the lookback, no matter in which order the rows are loaded.
+//
+// The queries only filter on the window, not on the sent rows. Rows within the lookback have to be loaded anyway to find
+// the late commits, so a condition on the sent rows would only move the comparison into the sql of every source.
+
+// seenMargin keeps the sent rows a little longer than the lookback. The timepoint strings of the queries have seconds
+// precision, so a window can start up to a second before its From.
+const seenMargin = time.Second
+
+// RowKey identifies a loaded row
+type RowKey struct {
+	Stream    string `json:"stream"`    // table or kind of the row, the ids are only unique within a stream
+	Timestamp int64  `json:"timestamp"` // unix milliseconds
+	Id        string `json:"id"`        // primary key, rows without one are numbered by their order within the timestamp
+}
+
+// watermarkState is what is persisted in the watermark file
+type watermarkState struct {
+	Until time.Time `json:"until"` // end of the last complete window
+	Seen  []RowKey  `json:"seen"`  // sent rows within the lookback of the next window
+}
+
+// watermarkTracker is only used by the goroutine of the poller
+type watermarkTracker struct {
+	config  WatermarkConfig
+	concern log.Concern
+	until   time.Time
+	seen    map[RowKey]struct{}
+}
+
+func newWatermarkTracker(config WatermarkConfig, concern log.Concern) *watermarkTracker {
+	wt := &watermarkTracker{config: config, concern: concern, seen: make(map[RowKey]struct{})}
+	if len(config.File) == 0 {
+		return wt
+	}
+
+	state, err := loadWatermarkState(config.File)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Info(fmt.Sprint("No watermark file ", config.File, " yet. Starting from now."), concern, log.Service)
+		return wt
+	} else if err != nil {
+		log.Error(fmt.Sprint("Could not load watermark file ", config.File, ". Starting from now."), err, concern, log.Service)
+		return wt
+	}
+	wt.until = state.Until
+	for _, key := range state.Seen {
+		wt.seen[key] = struct{}{}
+	}
+	log.Info(fmt.Sprint("Resuming from watermark ", wt.until.Format(time.DateTime), "."), concern, log.Service)
+	return wt
+}
+
+func loadWatermarkState(file string) (state watermarkState, err error) {
+	encoded, err := os.ReadFile(file)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(encoded, &state)
+	return
+}
+
+func (wt *watermarkTracker) lookback() time.Duration {
+	return time.Duration(wt.config.Lookback) * time.Millisecond
+}
+
+// window starts at the end of the last complete window minus the lookback. The first window, and the first after a gap
+// longer than the max catch up, covers one query interval.
+func (wt *watermarkTracker) window(now time.Time, interval time.Duration) (window Window, since time.Time) {
+	if wt.until.IsZero() {
+		wt.until = now.Add(-interval)
+	} else if gap := now.Sub(wt.until); gap > time.Duration(wt.config.MaxCatchUp)*time.Millisecond {
+		log.Warn(fmt.Sprint("Skipping ", gap.Round(time.Second), " since the last complete window. Only catching up on the last query interval."), wt.concern, log.Service)
+		wt.until = now.Add(-interval)
+	}
+	return Window{From: wt.until.Add(-wt.lookback()), To: now}, wt.until
+}
+
+// filter returns the fresh function for the rows of one window. Rows without id are numbered by their order among the
+// rows of the same stream and timestamp, a window loads all of them or none.
+func (wt *watermarkTracker) filter() func(key RowKey) bool {
+	occurrences := make(map[RowKey]int)
+	return func(key RowKey) bool {
+		if len(key.Id) == 0 {
+			occurrences[key]++
+			key.Id = fmt.Sprint("#", occurrences[key])
+		}
+		return wt.fresh(key)
+	}
+}
+
+// fresh is true for rows that were not sent yet. It marks them as sent.
+func (wt *watermarkTracker) fresh(key RowKey) bool {
+	if _, seen := wt.seen[key]; seen {
+		return false
+	}
+	wt.seen[key] = struct{}{}
+	return true
+}
+
+// complete moves the start of the next window to the end of this one. It is only called if all queries of the window
+// succeeded, otherwise the next window covers it again and fresh filters what was sent.
+func (wt *watermarkTracker) complete(window Window) {
+	wt.until = window.To
+}
+
+// reset forgets the windows, e.g. while no one is connected nothing has to be caught up on
+func (wt *watermarkTracker) reset() {
+	wt.until = time.Time{}
+}
+
+// save forgets the rows before the next window and persists the state, if a watermark file is configured
+func (wt *watermarkTracker) save() {
+	state := watermarkState{Until: wt.until}
+	forgetBefore := wt.until.Add(-wt.lookback() - seenMargin).UnixMilli()
+	for key := range wt.seen {
+		if key.Timestamp < forgetBefore {
+			delete(wt.seen, key)
+			continue
+		}
+		state.Seen = append(state.Seen, key)
+	}
+	if len(wt.config.File) == 0 {
+		return
+	}
+
+	encoded, err := json.Marshal(state)
+	if err != nil {
+		log.Error("Could not encode watermark.", err, wt.concern, log.Service)
+		return
+	}
+	// write and rename, so a crash never leaves a half written file behind
+	tmpFile := wt.config.File + ".tmp"
+	if err = os.WriteFile(tmpFile, encoded, 0600); err == nil {
+		err = os.Rename(tmpFile, wt.config.File)
+	}
+	if err != nil {
+		log.Error(fmt.Sprint("Could not save watermark file ", wt.config.File, "."), err, wt.concern, log.Service)
+	}
+}
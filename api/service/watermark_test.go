@@ -0,0 +1,121 @@
+package service
+
+import (
+	"api/utils/log"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatermarkFresh(t *testing.T) {
+	wt := newWatermarkTracker(WatermarkConfig{Lookback: 1000}, log.Service)
+	fresh := wt.filter()
+	fresh(RowKey{Stream: "file", Timestamp: 5000, Id: "9"})
+
+	tests := []struct {
+		key      RowKey
+		expected bool
+		message  string
+	}{
+		{RowKey{Stream: "file", Timestamp: 5000, Id: "9"}, false, "Row that was sent"},
+		{RowKey{Stream: "file", Timestamp: 5000, Id: "10"}, true, "Row with the same timestamp and another id"},
+		{RowKey{Stream: "file", Timestamp: 3000, Id: "2"}, true, "Row of the window before a sent row"},
+		{RowKey{Stream: "file", Timestamp: 3000, Id: "2"}, false, "Row before a sent row that was sent"},
+		{RowKey{Stream: "user", Timestamp: 5000, Id: "9"}, true, "Row of another stream"},
+		{RowKey{Stream: "file", Timestamp: 1000}, true, "Row without id"},
+		{RowKey{Stream: "file", Timestamp: 1000}, true, "Second row without id of the timestamp"},
+	}
+
+	for _, test := range tests {
+		if fresh := fresh(test.key); fresh != test.expected {
+			t.Errorf("%v. Expected: %v, Got: %v", test.message, test.expected, fresh)
+		}
+	}
+}
+
+func TestWatermarkOverlappingWindows(t *testing.T) {
+	wt := newWatermarkTracker(WatermarkConfig{Lookback: 2000, MaxCatchUp: 60000}, log.Service)
+	window, _ := wt.window(time.UnixMilli(100000), 5*time.Second)
+	// the rows of a window are not ordered
+	fresh := wt.filter()
+	for _, key := range []RowKey{{Stream: "file", Timestamp: 99000, Id: "3"}, {Stream: "file", Timestamp: 97000, Id: "1"},
+		{Stream: "file", Timestamp: 99500}, {Stream: "file", Timestamp: 99500}} {
+		if !fresh(key) {
+			t.Errorf("Row %v of the first window. Expected: fresh, Got: not fresh", key)
+		}
+	}
+	wt.complete(window)
+	wt.save()
+
+	window, _ = wt.window(time.UnixMilli(105000), 5*time.Second)
+	if window.From.UnixMilli() != 98000 {
+		t.Fatalf("Start of the overlapping window. Expected: 98000, Got: %v", window.From.UnixMilli())
+	}
+	fresh = wt.filter()
+	tests := []struct {
+		key      RowKey
+		expected bool
+		message  string
+	}{
+		{RowKey{Stream: "file", Timestamp: 99500}, false, "Row without id of the overlap"},
+		{RowKey{Stream: "file", Timestamp: 99000, Id: "3"}, false, "Row of the overlap"},
+		{RowKey{Stream: "file", Timestamp: 99500}, false, "Second row without id of the overlap"},
+		{RowKey{Stream: "file", Timestamp: 99500}, true, "Row without id committed late"},
+		{RowKey{Stream: "file", Timestamp: 98500, Id: "2"}, true, "Row with id committed late"},
+		{RowKey{Stream: "file", Timestamp: 104000, Id: "4"}, true, "New row"},
+	}
+	for _, test := range tests {
+		if fresh := fresh(test.key); fresh != test.expected {
+			t.Errorf("%v. Expected: %v, Got: %v", test.message, test.expected, fresh)
+		}
+	}
+}
+
+func TestWatermarkWindows(t *testing.T) {
+	wt := newWatermarkTracker(WatermarkConfig{Lookback: 1000, MaxCatchUp: 60000}, log.Service)
+	now := time.UnixMilli(100000)
+
+	window, since := wt.window(now, 5*time.Second)
+	if window.From.UnixMilli() != 94000 || since.UnixMilli() != 95000 || !window.To.Equal(now) {
+		t.Errorf("First window. Expected: 94000 - 100000 since 95000, Got: %v - %v since %v", window.From.UnixMilli(), window.To.UnixMilli(), since.UnixMilli())
+	}
+
+	// a dropped tick does not leave a gap
+	wt.complete(window)
+	window, since = wt.window(now.Add(10*time.Second), 5*time.Second)
+	if window.From.UnixMilli() != 99000 || since.UnixMilli() != 100000 {
+		t.Errorf("Window after a dropped tick. Expected: 99000 since 100000, Got: %v since %v", window.From.UnixMilli(), since.UnixMilli())
+	}
+
+	// longer gaps are skipped
+	wt.complete(window)
+	window, _ = wt.window(now.Add(time.Hour), 5*time.Second)
+	if expected := now.Add(time.Hour - 6*time.Second); !window.From.Equal(expected) {
+		t.Errorf("Window after a long gap. Expected: %v, Got: %v", expected.UnixMilli(), window.From.UnixMilli())
+	}
+}
+
+func TestWatermarkPersists(t *testing.T) {
+	config := WatermarkConfig{File: filepath.Join(t.TempDir(), "keeper.json"), Lookback: 1000, MaxCatchUp: 60000}
+	wt := newWatermarkTracker(config, log.Service)
+	window, _ := wt.window(time.UnixMilli(100000), 5*time.Second)
+	fresh := wt.filter()
+	fresh(RowKey{Stream: "file", Timestamp: 97000, Id: "1"})
+	fresh(RowKey{Stream: "file", Timestamp: 99500, Id: "2"})
+	wt.complete(window)
+	wt.save()
+
+	restarted := newWatermarkTracker(config, log.Service)
+	if !restarted.until.Equal(window.To) {
+		t.Errorf("Restored end of the last window. Expected: %v, Got: %v", window.To, restarted.until)
+	}
+	if restarted.fresh(RowKey{Stream: "file", Timestamp: 99500, Id: "2"}) {
+		t.Errorf("Row that was sent before the restart is sent again.")
+	}
+	if _, exists := restarted.seen[RowKey{Stream: "file", Timestamp: 97000, Id: "1"}]; exists {
+		t.Errorf("Row before the lookback was not forgotten.")
+	}
+	if !restarted.fresh(RowKey{Stream: "file", Timestamp: 99000, Id: "3"}) {
+		t.Errorf("Late row within the lookback is not sent after the restart.")
+	}
+}
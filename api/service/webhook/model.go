@@ -0,0 +1,40 @@
+package webhook
+
+// Batch is the body of a webhook request, sent with the header 'Content-Type: application/json' and one of the
+// configured tokens as 'Authorization: Bearer <token>':
+//
+//	{
+//	  "events": [
+//	    {"id": "42", "timestamp": 1714982401000, "kind": "Uploads", "magnitude": 12.5, "domain": "user@mpdl.mpg.de"},
+//	    {"domain": "mpdl.mpg.de"}
+//	  ]
+//	}
+//
+// Only the domain is required. Unknown fields are rejected, so typos do not go unnoticed. A batch is accepted or
+// rejected as a whole: 202 if its events are queued for the next frame, 400 if an event is invalid, 401 without a
+// valid token, 413 if the body is too large and 503 while the service is stopped or the queue of the frame is full.
+type Batch struct {
+	Events []Event `json:"events"`
+}
+
+type Event struct {
+	Id        string  `json:"id"`        // optional, events with an id that was received before are dropped, so failed requests can be retried
+	Timestamp int64   `json:"timestamp"` // optional, unix milliseconds, the time of receipt if 0
+	Kind      string  `json:"kind"`      // optional, the kind of the service config if empty
+	Magnitude float64 `json:"magnitude"` // optional, number the front end scales the event with, e.g. a file size
+	Domain    string  `json:"domain"`    // email domain or email address, used to find the institute
+}
+
+// Response is the body of an accepted batch
+type Response struct {
+	Accepted   int `json:"accepted"`
+	Duplicates int `json:"duplicates"` // events dropped because their id was received before
+}
+
+type ValidEvent struct {
+	Id        string
+	Timestamp int64 // milliseconds
+	Kind      string
+	Magnitude float64
+	Domain    string
+}
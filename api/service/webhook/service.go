@@ -0,0 +1,332 @@
+package webhook
+
+import (
+	"api/geo"
+	"api/globals"
+	"api/institutes"
+	"api/service"
+	"api/utils/log"
+	"api/websocket"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultKind = "Events"
+	// events may be this far in the future, clocks of the senders are not exact
+	maxClockSkew = time.Minute
+	// older events would be shown all at once
+	maxEventAge = time.Hour
+	// ids are remembered this long to drop retried events. An event is accepted until it is maxEventAge old, so its id
+	// has to be remembered until then, counted from a timestamp up to maxClockSkew in the future.
+	idRetention   = maxEventAge + maxClockSkew
+	maxKindLength = 64
+)
+
+// Service receives events by http POST instead of querying a database. The events of a query interval are buffered
+// and broadcast as one frame, like the frames of the polling services.
+type Service struct {
+	service.Enrichment
+	WebsocketController websocket.WebsocketInterface
+	Config              service.ServiceConfig
+	lock                sync.Mutex
+	accepting           bool
+	events              []ValidEvent         // of the next frame
+	receivedIds         map[string]time.Time // by id, when the event was received
+	lastFrame           time.Time
+	ticker              *time.Ticker
+	done                chan bool
+	wsErrorCheckerDone  chan bool
+}
+
+// NewService checks the webhook config, a webhook without tokens would accept events from everyone
+func NewService(config service.ServiceConfig, websocketController websocket.WebsocketInterface) (*Service, error) {
+	if !strings.HasPrefix(config.Webhook.Path, "/") {
+		return nil, errors.New(fmt.Sprint("invalid webhook path ", config.Webhook.Path, " of service ", config.Name))
+	}
+	if config.Webhook.Path == config.Websocket.EndpointPath || config.Webhook.Path == config.Websocket.SSEPath {
+		return nil, errors.New(fmt.Sprint("webhook path of service ", config.Name, " is already the websocket or sse path"))
+	}
+	if len(config.Webhook.Tokens) == 0 {
+		return nil, errors.New(fmt.Sprint("webhook of service ", config.Name, " has no tokens"))
+	}
+	for _, token := range config.Webhook.Tokens {
+		if len(token) == 0 {
+			return nil, errors.New(fmt.Sprint("webhook of service ", config.Name, " has an empty token"))
+		}
+	}
+	return &Service{WebsocketController: websocketController, Config: config, receivedIds: make(map[string]time.Time),
+		Enrichment: service.Enrichment{Concern: log.Webhook}}, nil
+}
+
+func (sc *Service) Init(institutesController institutes.Controller, geoController geo.Controller) {
+	log.Info(fmt.Sprint("Init webhook service for ", sc.Config.Name, "."), log.Webhook, log.Service)
+	sc.Enrichment.Init(institutesController, geoController)
+
+	if registrar, ok := sc.WebsocketController.(websocket.HandlerRegistrar); ok {
+		registrar.HandleFunc(sc.Config.Webhook.Path, sc.webhookEndpoint)
+	} else {
+		log.Warn(fmt.Sprint("The websocket of ", sc.Config.Name, " can not serve the webhook endpoint."), log.Webhook, log.Service)
+	}
+	sc.wsErrorCheckerDone = make(chan bool)
+	wsErrorChannel := sc.WebsocketController.GetErrorChannel()
+	go func() {
+		for {
+			select {
+			case <-sc.wsErrorCheckerDone:
+				return
+			case err := <-*wsErrorChannel:
+				log.Error(fmt.Sprint("While trying to serve a websocket connection for the ", sc.Config.Name, " webhook there was an error."), err, log.Webhook, log.Service)
+				sc.StopService()
+				return
+			}
+		}
+	}()
+	sc.WebsocketController.InitAndStartOnce(sc.Config.Websocket)
+}
+
+func (sc *Service) GetName() string {
+	return sc.Config.Name
+}
+
+func (sc *Service) GetDatabaseController() interface{} {
+	return nil
+}
+
+func (sc *Service) StartService() *chan bool {
+	log.Info(fmt.Sprint("Starting webhook service for ", sc.Config.Name, " on ", sc.Config.Webhook.Path, "."), log.Webhook, log.Service)
+	if sc.ticker != nil {
+		sc.ticker.Stop()
+	}
+	sc.lock.Lock()
+	sc.accepting = true
+	sc.lastFrame = time.Now()
+	sc.lock.Unlock()
+	sc.done = make(chan bool)
+	sc.ticker = time.NewTicker(sc.frameInterval())
+	go func(done chan bool, ticks <-chan time.Time) {
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticks:
+				sc.sendFrame(time.Now())
+			}
+		}
+	}(sc.done, sc.ticker.C)
+
+	return &sc.done
+}
+
+func (sc *Service) StopService() {
+	log.Info(fmt.Sprint("Stop webhook service for ", sc.Config.Name, "."), log.Webhook, log.Service)
+	// the http handler can not be unregistered, it rejects the requests from now on
+	sc.lock.Lock()
+	sc.accepting = false
+	sc.lock.Unlock()
+	if sc.ticker != nil {
+		sc.ticker.Stop()
+	}
+	if sc.done != nil {
+		close(sc.done)
+		sc.done = nil
+	}
+
+	sc.WebsocketController.StopWebsocket()
+
+	if sc.wsErrorCheckerDone != nil {
+		select {
+		case sc.wsErrorCheckerDone <- true:
+		default:
+		}
+		close(sc.wsErrorCheckerDone)
+		sc.wsErrorCheckerDone = nil
+	}
+}
+
+// frameInterval is the query interval in seconds, there is no registered source that raises it to a minimum
+func (sc *Service) frameInterval() time.Duration {
+	if sc.Config.QueryInterval < 1 {
+		return time.Second
+	}
+	return time.Duration(sc.Config.QueryInterval) * time.Second
+}
+
+func (sc *Service) webhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "Only POST is allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+	if !sc.isAuthorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="hatnote"`)
+		http.Error(w, "Missing or invalid bearer token.", http.StatusUnauthorized)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "Content type has to be application/json.", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var batch Batch
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, sc.Config.Webhook.MaxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&batch); err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			http.Error(w, fmt.Sprint("Body is larger than ", maxBytesError.Limit, " bytes."), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprint("Invalid batch: ", err), http.StatusBadRequest)
+		return
+	}
+	validEvents, err := sc.validate(batch, time.Now())
+	if err != nil {
+		http.Error(w, fmt.Sprint("Invalid batch: ", err), http.StatusBadRequest)
+		return
+	}
+
+	response, err := sc.queue(validEvents, time.Now())
+	if err != nil {
+		w.Header().Set("Retry-After", strconv.FormatInt(int64(sc.frameInterval()/time.Second), 10))
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	log.Debug(fmt.Sprint("Webhook of ", sc.Config.Name, " accepted ", response.Accepted, " events."), log.Webhook, log.Service)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(response)
+}
+
+// isAuthorized compares the bearer token with every configured token in constant time
+func (sc *Service) isAuthorized(r *http.Request) bool {
+	scheme, token, found := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	authorized := false
+	for _, configured := range sc.Config.Webhook.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(configured)) == 1 {
+			authorized = true
+		}
+	}
+	return authorized
+}
+
+// validate checks the events of a batch and fills in the defaults. The first invalid event rejects the whole batch.
+func (sc *Service) validate(batch Batch, now time.Time) (validEvents []ValidEvent, err error) {
+	if len(batch.Events) > sc.Config.Webhook.MaxEvents {
+		return nil, errors.New(fmt.Sprint("more than ", sc.Config.Webhook.MaxEvents, " events"))
+	}
+	for i, event := range batch.Events {
+		validEvent := ValidEvent{Id: event.Id, Timestamp: event.Timestamp, Kind: event.Kind, Magnitude: event.Magnitude, Domain: event.Domain}
+		if _, domain, isEmail := strings.Cut(validEvent.Domain, "@"); isEmail {
+			validEvent.Domain = domain
+		}
+		if len(validEvent.Domain) == 0 {
+			return nil, errors.New(fmt.Sprint("event ", i, ": domain is empty"))
+		}
+		if validEvent.Timestamp == 0 {
+			validEvent.Timestamp = now.UnixMilli()
+		} else if validEvent.Timestamp > now.Add(maxClockSkew).UnixMilli() || validEvent.Timestamp < now.Add(-maxEventAge).UnixMilli() {
+			return nil, errors.New(fmt.Sprint("event ", i, ": timestamp ", validEvent.Timestamp, " is not within the last ", maxEventAge))
+		}
+		if len(validEvent.Kind) == 0 {
+			validEvent.Kind = sc.Config.Webhook.Kind
+		}
+		if len(validEvent.Kind) == 0 {
+			validEvent.Kind = defaultKind
+		}
+		if len(validEvent.Kind) > maxKindLength {
+			return nil, errors.New(fmt.Sprint("event ", i, ": kind is longer than ", maxKindLength, " characters"))
+		}
+		if validEvent.Magnitude < 0 {
+			return nil, errors.New(fmt.Sprint("event ", i, ": magnitude is negative"))
+		}
+		validEvents = append(validEvents, validEvent)
+	}
+	return
+}
+
+// queue adds the events to the next frame, events with an id that was received before are dropped
+func (sc *Service) queue(validEvents []ValidEvent, now time.Time) (response Response, err error) {
+	sc.lock.Lock()
+	defer sc.lock.Unlock()
+	if !sc.accepting {
+		return response, errors.New("service is not running")
+	}
+	if len(sc.events)+len(validEvents) > sc.Config.Webhook.MaxEvents {
+		return response, errors.New("too many events for the next frame")
+	}
+	for _, validEvent := range validEvents {
+		if len(validEvent.Id) > 0 {
+			if _, exists := sc.receivedIds[validEvent.Id]; exists {
+				response.Duplicates++
+				continue
+			}
+			sc.receivedIds[validEvent.Id] = now
+		}
+		sc.events = append(sc.events, validEvent)
+		response.Accepted++
+	}
+	return
+}
+
+// sendFrame broadcasts the events received since the last frame
+func (sc *Service) sendFrame(now time.Time) {
+	sc.lock.Lock()
+	events := sc.events
+	sc.events = nil
+	since := sc.lastFrame
+	sc.lastFrame = now
+	for id, received := range sc.receivedIds {
+		if now.Sub(received) > idRetention {
+			delete(sc.receivedIds, id)
+		}
+	}
+	sc.lock.Unlock()
+
+	serviceDataJSON, err := json.Marshal(sc.Map(events))
+	if err != nil {
+		log.Error(fmt.Sprint("Could not convert ", sc.Config.Name, " data to json string."), err, log.Webhook, log.Service)
+		return
+	}
+
+	var eventData websocket.EventData
+	eventData.EventInfo.ActiveConnections = sc.WebsocketController.GetActiveConnections()
+	// the front end delays the events by their distance to the previous frame, like the events of a polled window
+	eventData.EventInfo.FromTimepoint = since.UnixMilli()
+	eventData.EventInfo.Service = sc.Config.Name
+	eventData.EventInfo.Version = globals.VERSION
+	eventData.EventInfo.ExpectedFrontendVersion = globals.EXPECTED_FRONTEND_VERSION
+	// there is no database, the front end should not show a connection problem
+	eventData.EventInfo.DatabaseInfo.IsConnectionEstablished = true
+	eventData.Data = string(serviceDataJSON)
+	sc.WebsocketController.SendDataInBulk(eventData)
+}
+
+// Map finds the institute names for the events and builds the websocket data
+func (sc *Service) Map(validEvents []ValidEvent) websocket.GenericData {
+	websocketEventData := websocket.GenericData{}
+	for _, event := range validEvents {
+		// ignore the case if institute name is not found and just take the domain to display
+		instituteName, _ := sc.InstituteName(event.Domain)
+
+		websocketEventData[event.Kind] = append(websocketEventData[event.Kind], websocket.GenericEvent{
+			Timestamp:     event.Timestamp,
+			Magnitude:     event.Magnitude,
+			InstituteName: instituteName,
+			Location:      sc.Location(event.Domain),
+		})
+	}
+
+	return websocketEventData
+}
@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"api/institutes"
+	"api/service"
+	"api/websocket"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// within this directory: go test
+
+type recordingWebsocket struct {
+	lock   sync.Mutex
+	frames []websocket.EventData
+}
+
+func (rw *recordingWebsocket) SendDataInBulk(data websocket.EventData) {
+	rw.lock.Lock()
+	defer rw.lock.Unlock()
+	rw.frames = append(rw.frames, data)
+}
+func (rw *recordingWebsocket) InitAndStartOnce(config websocket.Config) {}
+func (rw *recordingWebsocket) GetErrorChannel() *chan error {
+	errorChannel := make(chan error)
+	return &errorChannel
+}
+func (rw *recordingWebsocket) StopWebsocket()            {}
+func (rw *recordingWebsocket) GetActiveConnections() int { return 1 }
+
+func newTestService(t *testing.T) (*Service, *recordingWebsocket) {
+	recorder := &recordingWebsocket{}
+	sc, err := NewService(service.ServiceConfig{Name: "uploads", QueryInterval: 1,
+		Websocket: websocket.Config{EndpointPath: "/uploads"},
+		Webhook:   service.WebhookConfig{Path: "/uploads/webhook", Tokens: []string{"old-token", "new-token"}, Kind: "Uploads", MaxBodySize: 1024, MaxEvents: 3}}, recorder)
+	if err != nil {
+		t.Fatalf("Could not create webhook service. Error: %v", err)
+	}
+	sc.InstitutesData = institutes.InstituteData{Institutes: map[string]*institutes.Institute{"mpdl.mpg.de": {InstituteNameDe: "MPDL"}}}
+	sc.accepting = true
+	return sc, recorder
+}
+
+func post(sc *Service, token string, contentType string, body string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, "/uploads/webhook", strings.NewReader(body))
+	if len(token) > 0 {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	request.Header.Set("Content-Type", contentType)
+	response := httptest.NewRecorder()
+	sc.webhookEndpoint(response, request)
+	return response
+}
+
+func TestWebhookEndpoint(t *testing.T) {
+	sc, _ := newTestService(t)
+	valid := `{"events": [{"id": "1", "domain": "user@mpdl.mpg.de", "magnitude": 12}]}`
+
+	tests := []struct {
+		token       string
+		contentType string
+		body        string
+		expected    int
+		message     string
+	}{
+		{"", "application/json", valid, http.StatusUnauthorized, "Missing token"},
+		{"wrong-token", "application/json", valid, http.StatusUnauthorized, "Wrong token"},
+		{"new-token", "text/plain", valid, http.StatusUnsupportedMediaType, "Wrong content type"},
+		{"new-token", "application/json", `{"events": [{"domain": ""}]}`, http.StatusBadRequest, "Empty domain"},
+		{"new-token", "application/json", `{"events": [{"domain": "mpdl.mpg.de", "size": 1}]}`, http.StatusBadRequest, "Unknown field"},
+		{"new-token", "application/json", `{"events": [{"domain": "mpdl.mpg.de", "timestamp": 1000}]}`, http.StatusBadRequest, "Too old timestamp"},
+		{"new-token", "application/json", `{"events": [{"domain": "mpdl.mpg.de", "magnitude": -1}]}`, http.StatusBadRequest, "Negative magnitude"},
+		{"new-token", "application/json", `{"events": [{"domain": "` + strings.Repeat("a", 1024) + `"}]}`, http.StatusRequestEntityTooLarge, "Too large body"},
+		{"old-token", "application/json; charset=utf-8", valid, http.StatusAccepted, "Valid batch with the old token"},
+		{"new-token", "application/json", `{"events": [{"domain": "a.de"}, {"domain": "b.de"}, {"domain": "c.de"}]}`, http.StatusServiceUnavailable, "Full queue of the frame"},
+	}
+
+	for _, test := range tests {
+		if response := post(sc, test.token, test.contentType, test.body); response.Code != test.expected {
+			t.Errorf("%v. Expected: %v, Got: %v %v", test.message, test.expected, response.Code, response.Body.String())
+		}
+	}
+}
+
+func TestWebhookFrames(t *testing.T) {
+	sc, recorder := newTestService(t)
+	now := time.Now()
+	sc.lastFrame = now.Add(-time.Second)
+
+	response := post(sc, "new-token", "application/json", `{"events": [{"id": "1", "domain": "user@mpdl.mpg.de", "magnitude": 12},
+		{"domain": "unknown.de", "kind": "Downloads", "timestamp": `+strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10)+`}]}`)
+	var accepted Response
+	json.NewDecoder(response.Body).Decode(&accepted)
+	if response.Code != http.StatusAccepted || accepted != (Response{Accepted: 2}) {
+		t.Fatalf("First batch. Expected: 202 {2 0}, Got: %v %v", response.Code, accepted)
+	}
+	// the retry of the first event is dropped
+	response = post(sc, "new-token", "application/json", `{"events": [{"id": "1", "domain": "mpdl.mpg.de"}]}`)
+	accepted = Response{}
+	json.NewDecoder(response.Body).Decode(&accepted)
+	if response.Code != http.StatusAccepted || accepted != (Response{Duplicates: 1}) {
+		t.Errorf("Retried batch. Expected: 202 {0 1}, Got: %v %v", response.Code, accepted)
+	}
+
+	sc.sendFrame(now)
+	if len(recorder.frames) != 1 {
+		t.Fatalf("Frames. Expected: 1, Got: %v", len(recorder.frames))
+	}
+	frame := recorder.frames[0]
+	var data websocket.GenericData
+	json.Unmarshal([]byte(frame.Data), &data)
+	if frame.EventInfo.Service != "uploads" || frame.EventInfo.FromTimepoint != now.Add(-time.Second).UnixMilli() || !frame.EventInfo.DatabaseInfo.IsConnectionEstablished {
+		t.Errorf("Event info. Expected: uploads since the last frame, Got: %v", frame.EventInfo)
+	}
+	if uploads := data["Uploads"]; len(uploads) != 1 || uploads[0].InstituteName != "MPDL" || uploads[0].Magnitude != 12 {
+		t.Errorf("Uploads. Expected: 1 of MPDL with magnitude 12, Got: %v", uploads)
+	}
+	if downloads := data["Downloads"]; len(downloads) != 1 || downloads[0].InstituteName != "" || downloads[0].Timestamp != now.Add(-time.Minute).UnixMilli() {
+		t.Errorf("Downloads. Expected: 1 without institute, Got: %v", downloads)
+	}
+
+	// ids are remembered as long as their events are accepted
+	sc.sendFrame(now.Add(maxEventAge))
+	if _, exists := sc.receivedIds["1"]; !exists {
+		t.Errorf("Id before the retention. Expected: remembered, Got: %v", sc.receivedIds)
+	}
+	// ids are forgotten after the retention
+	sc.sendFrame(now.Add(idRetention + time.Second))
+	if _, exists := sc.receivedIds["1"]; exists || len(sc.events) != 0 {
+		t.Errorf("State after the retention. Expected: no ids and events, Got: %v %v", sc.receivedIds, sc.events)
+	}
+
+	sc.accepting = false
+	if response = post(sc, "new-token", "application/json", `{"events": []}`); response.Code != http.StatusServiceUnavailable {
+		t.Errorf("Batch to a stopped service. Expected: 503, Got: %v", response.Code)
+	}
+}
+
+func TestNewServiceRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		config  service.WebhookConfig
+		message string
+	}{
+		{service.WebhookConfig{Path: "webhook", Tokens: []string{"token"}}, "Relative path"},
+		{service.WebhookConfig{Path: "/uploads", Tokens: []string{"token"}}, "Websocket path"},
+		{service.WebhookConfig{Path: "/webhook"}, "No tokens"},
+		{service.WebhookConfig{Path: "/webhook", Tokens: []string{"token", ""}}, "Empty token"},
+	}
+
+	for _, test := range tests {
+		config := service.ServiceConfig{Name: "uploads", Websocket: websocket.Config{EndpointPath: "/uploads"}, Webhook: test.config}
+		if _, err := NewService(config, &recordingWebsocket{}); err == nil {
+			t.Errorf("%v. Expected an error.", test.message)
+		}
+	}
+}
@@ -117,6 +117,9 @@ const (
 	Mock
 	Mail
 	Geo
+	Relay
+	Sql
+	Webhook
 )
 
 func (s Concern) String() string {
@@ -145,6 +148,12 @@ func (s Concern) String() string {
 		return "mock"
 	case Mail:
 		return "mail"
+	case Relay:
+		return "relay"
+	case Sql:
+		return "sql"
+	case Webhook:
+		return "webhook"
 	}
 	return "unknown"
 }
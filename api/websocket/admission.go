@@ -0,0 +1,160 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rejection is the http answer to an upgrade request that is not admitted. The frontend's reconnecting socket can
+// tell the reasons apart by the status code.
+type rejection struct {
+	status       int
+	reason       string
+	retryAfter   time.Duration
+	authenticate string // WWW-Authenticate challenge of unauthorized requests
+}
+
+func (r *rejection) write(w http.ResponseWriter) {
+	if r.retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(r.retryAfter.Seconds()+0.5)))
+	}
+	if len(r.authenticate) > 0 {
+		w.Header().Set("WWW-Authenticate", r.authenticate)
+	}
+	http.Error(w, r.reason, r.status)
+}
+
+func (wsc *Websocket) isOriginAllowed(r *http.Request) bool {
+	if len(wsc.config.AllowedOrigins) == 0 {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		// not a browser, e.g. a kiosk client or a relay
+		return true
+	}
+	for _, allowedOrigin := range wsc.config.AllowedOrigins {
+		if allowedOrigin == "*" || strings.EqualFold(strings.TrimSuffix(allowedOrigin, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// admit checks the upgrade request and its access token and reserves a connection slot for the client ip. A reserved
+// slot has to be freed with releaseSlot if the upgrade fails, otherwise it is taken over by the registered connection.
+// The access token is nil if the endpoint does not require tokens.
+func (wsc *Websocket) admit(r *http.Request, ip string) (*accessToken, *rejection) {
+	if wsc.serverShuttingDown.Load() {
+		return nil, &rejection{status: http.StatusServiceUnavailable, reason: "Server shutting down.", retryAfter: wsc.reconnectDelay()}
+	}
+	if !wsc.isOriginAllowed(r) {
+		log.Warn(fmt.Sprint("Origin ", r.Header.Get("Origin"), " of ", ip, " is not allowed on ", wsc.config.EndpointPath, "."), log.Websocket)
+		return nil, &rejection{status: http.StatusForbidden, reason: "Origin not allowed."}
+	}
+	// rate limited before checking the token, so tokens can not be guessed quickly
+	if retryAfter, allowed := wsc.upgradeLimiter.allow(ip); !allowed {
+		log.Warn(fmt.Sprint("Too many upgrade attempts from ", ip, " on ", wsc.config.EndpointPath, "."), log.Websocket)
+		return nil, &rejection{status: http.StatusTooManyRequests, reason: "Too many connection attempts.", retryAfter: retryAfter}
+	}
+	access, err := wsc.authenticate(r, time.Now())
+	if err != nil {
+		return nil, wsc.rejectToken(ip, err)
+	}
+
+	wsc.connectionsLock.Lock()
+	defer wsc.connectionsLock.Unlock()
+	if wsc.config.MaxConnectionsPerIp > 0 && wsc.connectionsPerIp[ip] >= wsc.config.MaxConnectionsPerIp {
+		log.Warn(fmt.Sprint("Max websocket connections of ", wsc.config.MaxConnectionsPerIp, " per ip reached for ", ip, " on ", wsc.config.EndpointPath, "."), log.Websocket)
+		return nil, &rejection{status: http.StatusTooManyRequests, reason: "Too many connections from this address."}
+	}
+	if len(wsc.wsConnections)+wsc.pendingUpgrades >= wsc.config.MaxConnections {
+		log.Warn(fmt.Sprint("Max websocket connections of ", wsc.config.MaxConnections, " on ", wsc.config.EndpointPath, " reached. Rejecting new connection."), log.Websocket)
+		return nil, &rejection{status: http.StatusServiceUnavailable, reason: "Too many connections.", retryAfter: 30 * time.Second}
+	}
+	wsc.pendingUpgrades++
+	wsc.connectionsPerIp[ip]++
+	return access, nil
+}
+
+func (wsc *Websocket) releaseSlot(ip string) {
+	wsc.connectionsLock.Lock()
+	defer wsc.connectionsLock.Unlock()
+	wsc.pendingUpgrades--
+	wsc.decrementConnectionsPerIp(ip)
+}
+
+// must be called with the connections lock held
+func (wsc *Websocket) decrementConnectionsPerIp(ip string) {
+	wsc.connectionsPerIp[ip]--
+	if wsc.connectionsPerIp[ip] <= 0 {
+		delete(wsc.connectionsPerIp, ip)
+	}
+}
+
+/******************************************
+ ** upgrade rate limiting **
+ *****************************************/
+
+// rateLimiter is a token bucket per client ip
+type rateLimiter struct {
+	perMinute float64
+	burst     float64
+	lock      sync.Mutex
+	buckets   map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// buckets that were not used for this long are full again and can be forgotten
+const bucketExpiry = 10 * time.Minute
+
+func newRateLimiter(perMinute int, burst int) *rateLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{perMinute: float64(perMinute), burst: float64(burst), buckets: make(map[string]*tokenBucket)}
+}
+
+func (rl *rateLimiter) allow(ip string) (retryAfter time.Duration, allowed bool) {
+	if rl == nil || rl.perMinute <= 0 {
+		return 0, true
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := time.Now()
+	bucket, exists := rl.buckets[ip]
+	if !exists {
+		rl.forgetExpiredBuckets(now)
+		bucket = &tokenBucket{tokens: rl.burst, lastSeen: now}
+		rl.buckets[ip] = bucket
+	}
+	bucket.tokens += now.Sub(bucket.lastSeen).Minutes() * rl.perMinute
+	if bucket.tokens > rl.burst {
+		bucket.tokens = rl.burst
+	}
+	bucket.lastSeen = now
+
+	if bucket.tokens < 1 {
+		missingTokens := 1 - bucket.tokens
+		return time.Duration(missingTokens / rl.perMinute * float64(time.Minute)), false
+	}
+	bucket.tokens--
+	return 0, true
+}
+
+func (rl *rateLimiter) forgetExpiredBuckets(now time.Time) {
+	for ip, bucket := range rl.buckets {
+		if now.Sub(bucket.lastSeen) > bucketExpiry {
+			delete(rl.buckets, ip)
+		}
+	}
+}
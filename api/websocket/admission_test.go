@@ -0,0 +1,68 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func dialStatus(t *testing.T, server *httptest.Server, path string, header http.Header) int {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, response, err := websocket.DefaultDialer.Dial(url, header)
+	if err == nil {
+		t.Cleanup(func() { conn.Close() })
+	}
+	if response == nil {
+		t.Fatalf("No http response from %v. Error: %v", url, err)
+	}
+	return response.StatusCode
+}
+
+func TestUpgradeRejections(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/minerva", MaxConnections: 2, MaxConnectionsPerIp: 1,
+		AllowedOrigins: []string{"https://hatnote.mpdl.mpg.de"}})
+
+	rejected := dialStatus(t, server, "/minerva", http.Header{"Origin": {"https://evil.example"}})
+	if rejected != http.StatusForbidden {
+		t.Errorf("Not allowed origin. Expected: %v, Got: %v", http.StatusForbidden, rejected)
+	}
+	accepted := dialStatus(t, server, "/minerva", http.Header{"Origin": {"https://hatnote.mpdl.mpg.de"}})
+	if accepted != http.StatusSwitchingProtocols {
+		t.Errorf("Allowed origin. Expected: %v, Got: %v", http.StatusSwitchingProtocols, accepted)
+	}
+	waitForConnections(t, wsc, 1)
+
+	perIp := dialStatus(t, server, "/minerva", nil)
+	if perIp != http.StatusTooManyRequests {
+		t.Errorf("Second connection from the same ip. Expected: %v, Got: %v", http.StatusTooManyRequests, perIp)
+	}
+
+	wsc.config.MaxConnectionsPerIp = 0
+	wsc.config.MaxConnections = 1
+	full := dialStatus(t, server, "/minerva", nil)
+	if full != http.StatusServiceUnavailable {
+		t.Errorf("Endpoint full. Expected: %v, Got: %v", http.StatusServiceUnavailable, full)
+	}
+}
+
+func TestUpgradeRateLimit(t *testing.T) {
+	rl := newRateLimiter(60, 2)
+	for i := 0; i < 2; i++ {
+		if _, allowed := rl.allow("10.0.0.1"); !allowed {
+			t.Errorf("Attempt %v should be within the burst.", i+1)
+		}
+	}
+	retryAfter, allowed := rl.allow("10.0.0.1")
+	if allowed || retryAfter <= 0 {
+		t.Errorf("Third attempt should be limited with a retry time. Got allowed: %v, retry after: %v", allowed, retryAfter)
+	}
+	if _, allowed = rl.allow("10.0.0.2"); !allowed {
+		t.Errorf("Other ips should not be limited.")
+	}
+	if _, allowed = newRateLimiter(0, 0).allow("10.0.0.1"); !allowed {
+		t.Errorf("Disabled rate limiting should allow every attempt.")
+	}
+}
@@ -0,0 +1,169 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Access tokens are either JWTs signed with HS256, HS384 or HS512 or the shorter "<claims>.<signature>" form, where
+// claims is the base64url encoded claims json and signature its base64url encoded HMAC-SHA256. Both carry the claims
+//
+//	exp:   expiry as unix timestamp in seconds
+//	scope: space separated services the client may receive, e.g. "keeper minerva"
+//	nbf:   optional, the token is not valid before this unix timestamp in seconds
+//
+// Browsers can not set headers on websockets and event sources, so the token is accepted in the 'access_token'
+// query parameter as well as in an "Authorization: Bearer <token>" header.
+
+type accessToken struct {
+	services  map[string]struct{}
+	expiresAt time.Time
+}
+
+type tokenClaims struct {
+	ExpiresAt float64 `json:"exp"`
+	NotBefore float64 `json:"nbf"`
+	Scope     string  `json:"scope"`
+}
+
+type tokenHeader struct {
+	Algorithm string `json:"alg"`
+	KeyId     string `json:"kid"`
+}
+
+var (
+	errMissingToken = errors.New("access token missing")
+	errInvalidToken = errors.New("access token invalid")
+	errExpiredToken = errors.New("access token expired")
+)
+
+var tokenAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// allowsService is true for every service if the endpoint does not require tokens
+func (at *accessToken) allowsService(service string) bool {
+	if at == nil {
+		return true
+	}
+	_, allowed := at.services[service]
+	return allowed
+}
+
+func (at *accessToken) isExpired(now time.Time) bool {
+	return at != nil && !now.Before(at.expiresAt)
+}
+
+// authenticate returns nil without error if the endpoint does not require tokens
+func (wsc *Websocket) authenticate(r *http.Request, now time.Time) (*accessToken, error) {
+	if !wsc.config.Auth.IsEnabled() {
+		return nil, nil
+	}
+	token := r.URL.Query().Get("access_token")
+	if authorization := r.Header.Get("Authorization"); len(authorization) > 0 {
+		scheme, credentials, found := strings.Cut(authorization, " ")
+		if found && strings.EqualFold(scheme, "Bearer") {
+			token = strings.TrimSpace(credentials)
+		}
+	}
+	if len(token) == 0 {
+		return nil, errMissingToken
+	}
+	return verifyToken(token, wsc.config.Auth.Keys, now)
+}
+
+func verifyToken(token string, keys []AuthKey, now time.Time) (*accessToken, error) {
+	var header tokenHeader
+	var signingInput, encodedClaims, encodedSignature string
+	parts := strings.Split(token, ".")
+	switch len(parts) {
+	case 3:
+		if err := decodeTokenPart(parts[0], &header); err != nil {
+			return nil, errInvalidToken
+		}
+		signingInput, encodedClaims, encodedSignature = parts[0]+"."+parts[1], parts[1], parts[2]
+	case 2:
+		header.Algorithm = "HS256"
+		signingInput, encodedClaims, encodedSignature = parts[0], parts[0], parts[1]
+	default:
+		return nil, errInvalidToken
+	}
+
+	newHash, supported := tokenAlgorithms[header.Algorithm]
+	if !supported {
+		// especially "none" and asymmetric algorithms, whose keys could be confused with the shared secrets
+		return nil, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(encodedSignature)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+	if !isSignedByAnyKey(newHash, signingInput, signature, header.KeyId, keys) {
+		return nil, errInvalidToken
+	}
+
+	var claims tokenClaims
+	if err = decodeTokenPart(encodedClaims, &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	scope := strings.Fields(claims.Scope)
+	if claims.ExpiresAt <= 0 || len(scope) == 0 {
+		return nil, errInvalidToken
+	}
+	if claims.NotBefore > 0 && now.Before(unixSeconds(claims.NotBefore)) {
+		return nil, errInvalidToken
+	}
+	at := &accessToken{services: toSet(scope), expiresAt: unixSeconds(claims.ExpiresAt)}
+	if at.isExpired(now) {
+		return nil, errExpiredToken
+	}
+	return at, nil
+}
+
+// isSignedByAnyKey only tries the key with the given key id, so keys can be rotated without trying every key
+func isSignedByAnyKey(newHash func() hash.Hash, signingInput string, signature []byte, keyId string, keys []AuthKey) bool {
+	for _, key := range keys {
+		if len(keyId) > 0 && key.Id != keyId {
+			continue
+		}
+		mac := hmac.New(newHash, []byte(key.Secret))
+		mac.Write([]byte(signingInput))
+		if hmac.Equal(mac.Sum(nil), signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeTokenPart(part string, v interface{}) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(decoded, v)
+}
+
+func unixSeconds(seconds float64) time.Time {
+	return time.UnixMilli(int64(seconds * 1000))
+}
+
+func (wsc *Websocket) rejectToken(ip string, err error) *rejection {
+	log.Warn(fmt.Sprint("Rejecting client ", ip, " on ", wsc.config.EndpointPath, ": ", err, "."), log.Websocket)
+	authenticate := "Bearer realm=\"hatnote\""
+	if err != errMissingToken {
+		authenticate += ", error=\"invalid_token\""
+	}
+	return &rejection{status: http.StatusUnauthorized, reason: fmt.Sprint("Unauthorized: ", err, "."), authenticate: authenticate}
+}
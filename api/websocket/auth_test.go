@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func signTestJWT(header map[string]string, claims map[string]interface{}, secret string) string {
+	encodedHeader, _ := json.Marshal(header)
+	encodedClaims, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(encodedHeader) + "." + base64.RawURLEncoding.EncodeToString(encodedClaims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func signTestToken(claims map[string]interface{}, secret string) string {
+	encodedClaims, _ := json.Marshal(claims)
+	payload := base64.RawURLEncoding.EncodeToString(encodedClaims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return payload + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyToken(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	keys := []AuthKey{{Id: "old", Secret: "old secret"}, {Id: "current", Secret: "current secret"}}
+	valid := map[string]interface{}{"exp": 1700003600, "scope": "keeper minerva"}
+	hs256 := map[string]string{"alg": "HS256", "typ": "JWT"}
+
+	tests := []struct {
+		name     string
+		token    string
+		expected error
+	}{
+		{"jwt", signTestJWT(hs256, valid, "current secret"), nil},
+		{"jwt with key id", signTestJWT(map[string]string{"alg": "HS256", "kid": "old"}, valid, "old secret"), nil},
+		{"jwt with wrong key id", signTestJWT(map[string]string{"alg": "HS256", "kid": "old"}, valid, "current secret"), errInvalidToken},
+		{"compact token", signTestToken(valid, "old secret"), nil},
+		{"unknown secret", signTestJWT(hs256, valid, "guessed secret"), errInvalidToken},
+		{"alg none", signTestJWT(map[string]string{"alg": "none"}, valid, "current secret"), errInvalidToken},
+		{"expired", signTestJWT(hs256, map[string]interface{}{"exp": 1699999999, "scope": "keeper"}, "current secret"), errExpiredToken},
+		{"not yet valid", signTestJWT(hs256, map[string]interface{}{"exp": 1700003600, "nbf": 1700000060, "scope": "keeper"}, "current secret"), errInvalidToken},
+		{"without expiry", signTestJWT(hs256, map[string]interface{}{"scope": "keeper"}, "current secret"), errInvalidToken},
+		{"without scope", signTestJWT(hs256, map[string]interface{}{"exp": 1700003600}, "current secret"), errInvalidToken},
+		{"garbage", "not a token", errInvalidToken},
+	}
+	for _, test := range tests {
+		_, err := verifyToken(test.token, keys, now)
+		if err != test.expected {
+			t.Errorf("Token %v. Expected: %v, Got: %v", test.name, test.expected, err)
+		}
+	}
+
+	at, _ := verifyToken(signTestJWT(hs256, valid, "current secret"), keys, now)
+	if !at.allowsService("minerva") || at.allowsService("bloxberg") {
+		t.Errorf("Token scope. Expected: %v, Got: %v", "keeper minerva", at.services)
+	}
+	if !at.isExpired(time.Unix(1700003600, 0)) {
+		t.Errorf("Token should expire at its exp claim.")
+	}
+}
+
+func TestTokenAuthenticatedEndpoint(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10,
+		Auth: AuthConfig{Keys: []AuthKey{{Id: "dashboard", Secret: "dashboard secret"}}}})
+
+	if status := dialStatus(t, server, "/keeper", nil); status != http.StatusUnauthorized {
+		t.Errorf("Missing token. Expected: %v, Got: %v", http.StatusUnauthorized, status)
+	}
+	minervaOnly := signTestToken(map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix(), "scope": "minerva"}, "dashboard secret")
+	header := http.Header{"Authorization": {"Bearer " + minervaOnly}}
+	if status := dialStatus(t, server, "/keeper", header); status != http.StatusSwitchingProtocols {
+		t.Errorf("Token in header. Expected: %v, Got: %v", http.StatusSwitchingProtocols, status)
+	}
+	keeperOnly := signTestToken(map[string]interface{}{"exp": time.Now().Add(time.Hour).Unix(), "scope": "keeper"}, "dashboard secret")
+	conn := dialTestEndpoint(t, server, "/keeper?access_token="+url.QueryEscape(keeperOnly))
+	waitForConnections(t, wsc, 2)
+
+	// the minerva only client gets nothing, the keeper client only keeper frames
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva"}})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "keeper"}})
+	var received EventData
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read broadcast. Error: %v", err)
+	}
+	if received.EventInfo.Service != "keeper" {
+		t.Errorf("Broadcast within scope. Expected: %v, Got: %v", "keeper", received.EventInfo.Service)
+	}
+
+	conn.WriteJSON(ControlMessage{Control: ControlSubscribe, Services: []string{"minerva"}})
+	var answer ControlMessage
+	if err := conn.ReadJSON(&answer); err != nil {
+		t.Fatalf("Could not read control message answer. Error: %v", err)
+	}
+	if answer.Control != ControlError || !strings.Contains(answer.Error, "scope") {
+		t.Errorf("Subscription outside the scope. Expected: %v, Got: %v", ControlError, answer)
+	}
+}
+
+func TestExpiredTokenClosesConnection(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10,
+		Auth: AuthConfig{Keys: []AuthKey{{Secret: "dashboard secret"}}}})
+
+	token := signTestToken(map[string]interface{}{"exp": float64(time.Now().Add(time.Second).UnixMilli()) / 1000, "scope": "keeper"}, "dashboard secret")
+	conn := dialTestEndpoint(t, server, "/keeper?access_token="+url.QueryEscape(token))
+	waitForConnections(t, wsc, 1)
+
+	time.Sleep(time.Second)
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "keeper"}})
+	waitForConnections(t, wsc, 0)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Expired token. Expected: %v, Got: %v", "normal closure", err)
+	}
+}
@@ -0,0 +1,81 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Broker carries the frames of the service pollers to the endpoints that fan them out to their clients.
+// SendDataInBulk publishes to the broker of the endpoint and the endpoint broadcasts whatever the broker delivers.
+//
+// local:          publishing and delivering in the same process
+// relayPublisher: delivers locally and streams every frame to the edge instances connected to Address
+// relayEdge:      does not publish, receives the frames of the relay publisher at Address
+type Broker interface {
+	Publish(data EventData) error
+	Subscribe(deliver func(data EventData))
+	Start() error
+	Close() error
+}
+
+const (
+	BrokerLocal          = "local"
+	BrokerRelayPublisher = "relayPublisher"
+	BrokerRelayEdge      = "relayEdge"
+)
+
+var errEdgeCannotPublish = errors.New("edge instances only receive frames from the relay publisher")
+
+// IsEdge is true for instances that must not poll the databases, because their frames come from a relay publisher
+func (c BrokerConfig) IsEdge() bool {
+	return c.Type == BrokerRelayEdge
+}
+
+func NewBroker(config BrokerConfig) (Broker, error) {
+	if (config.Type == BrokerRelayPublisher || config.Type == BrokerRelayEdge) && len(config.Secret) == 0 {
+		return nil, errors.New(fmt.Sprint("broker type ", config.Type, " needs a secret"))
+	}
+	switch config.Type {
+	case "", BrokerLocal:
+		return &localBroker{}, nil
+	case BrokerRelayPublisher:
+		return newRelayPublisher(config), nil
+	case BrokerRelayEdge:
+		return newRelayEdge(config), nil
+	}
+	return nil, errors.New(fmt.Sprint("unknown broker type ", config.Type))
+}
+
+// localBroker delivers synchronously, so a published frame is queued for every client when Publish returns
+type localBroker struct {
+	lock        sync.RWMutex
+	subscribers []func(data EventData)
+}
+
+func (lb *localBroker) Publish(data EventData) error {
+	lb.deliver(data)
+	return nil
+}
+
+func (lb *localBroker) Subscribe(deliver func(data EventData)) {
+	lb.lock.Lock()
+	lb.subscribers = append(lb.subscribers, deliver)
+	lb.lock.Unlock()
+}
+
+func (lb *localBroker) deliver(data EventData) {
+	lb.lock.RLock()
+	defer lb.lock.RUnlock()
+	for _, deliver := range lb.subscribers {
+		deliver(data)
+	}
+}
+
+func (lb *localBroker) Start() error {
+	return nil
+}
+
+func (lb *localBroker) Close() error {
+	return nil
+}
@@ -0,0 +1,184 @@
+package websocket
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+const testRelaySecret = "relay-secret-of-at-least-32-bytes"
+
+func startTestRelay(t *testing.T) (*relayPublisher, *relayEdge) {
+	publisher := newRelayPublisher(BrokerConfig{Address: "127.0.0.1:0", Secret: testRelaySecret})
+	if err := publisher.Start(); err != nil {
+		t.Fatalf("Could not start relay publisher. Error: %v", err)
+	}
+	t.Cleanup(func() { publisher.Close() })
+
+	edge := newRelayEdge(BrokerConfig{Address: publisher.listener.Addr().String(), ReconnectInterval: 50, Secret: testRelaySecret})
+	edge.Start()
+	t.Cleanup(func() { edge.Close() })
+	waitForEdges(t, publisher, 1)
+	return publisher, edge
+}
+
+func waitForEdges(t *testing.T, publisher *relayPublisher, expected int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for publisher.edgeCount() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v relay edges, Got: %v", expected, publisher.edgeCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func receiveFrame(t *testing.T, frames chan EventData) EventData {
+	select {
+	case frame := <-frames:
+		return frame
+	case <-time.After(2 * time.Second):
+		t.Fatalf("No frame delivered.")
+	}
+	return EventData{}
+}
+
+func TestNewBroker(t *testing.T) {
+	tests := []struct {
+		brokerType string
+		secret     string
+		valid      bool
+	}{
+		{"", "", true},
+		{BrokerLocal, "", true},
+		{BrokerRelayPublisher, testRelaySecret, true},
+		{BrokerRelayEdge, testRelaySecret, true},
+		{BrokerRelayPublisher, "", false},
+		{BrokerRelayEdge, "", false},
+		{"redis", "", false},
+	}
+	for _, test := range tests {
+		_, err := NewBroker(BrokerConfig{Type: test.brokerType, Secret: test.secret})
+		if (err == nil) != test.valid {
+			t.Errorf("Broker type %q with secret %q. Expected valid: %v, Got error: %v", test.brokerType, test.secret, test.valid, err)
+		}
+	}
+}
+
+func TestRelayDeliversToPublisherAndEdges(t *testing.T) {
+	publisher, edge := startTestRelay(t)
+	local := make(chan EventData, 1)
+	publisher.Subscribe(func(data EventData) { local <- data })
+	remote := make(chan EventData, 1)
+	edge.Subscribe(func(data EventData) { remote <- data })
+
+	publisher.Publish(EventData{Data: `{"Messages":[]}`, EventInfo: EventInfo{Service: "minerva", FromTimepoint: 1000}})
+	if frame := receiveFrame(t, local); frame.EventInfo.FromTimepoint != 1000 {
+		t.Errorf("Local frame. Expected: %v, Got: %v", 1000, frame.EventInfo.FromTimepoint)
+	}
+	frame := receiveFrame(t, remote)
+	if frame.EventInfo.Service != "minerva" || frame.Data != `{"Messages":[]}` {
+		t.Errorf("Relayed frame. Expected: %v, Got: %v", "minerva frame", frame)
+	}
+
+	if err := edge.Publish(EventData{}); err != errEdgeCannotPublish {
+		t.Errorf("Publishing on an edge. Expected: %v, Got: %v", errEdgeCannotPublish, err)
+	}
+}
+
+func TestRelayEdgeReconnects(t *testing.T) {
+	publisher, edge := startTestRelay(t)
+	remote := make(chan EventData, 1)
+	edge.Subscribe(func(data EventData) { remote <- data })
+
+	// dropping the edge on the publisher side, e.g. because it fell behind
+	publisher.lock.Lock()
+	for edgeConnection := range publisher.edges {
+		publisher.removeEdgeLocked(edgeConnection)
+	}
+	publisher.lock.Unlock()
+	waitForEdges(t, publisher, 1)
+
+	publisher.Publish(EventData{EventInfo: EventInfo{Service: "keeper", FromTimepoint: 2000}})
+	if frame := receiveFrame(t, remote); frame.EventInfo.FromTimepoint != 2000 {
+		t.Errorf("Frame after reconnect. Expected: %v, Got: %v", 2000, frame.EventInfo.FromTimepoint)
+	}
+}
+
+func TestEdgeEndpointReportsOwnConnections(t *testing.T) {
+	publisher := newRelayPublisher(BrokerConfig{Address: "127.0.0.1:0", Secret: testRelaySecret})
+	if err := publisher.Start(); err != nil {
+		t.Fatalf("Could not start relay publisher. Error: %v", err)
+	}
+	t.Cleanup(func() { publisher.Close() })
+
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10,
+		Broker: BrokerConfig{Type: BrokerRelayEdge, Address: publisher.listener.Addr().String(), ReconnectInterval: 50, Secret: testRelaySecret}})
+	wsc.broker.Start()
+	t.Cleanup(func() { wsc.broker.Close() })
+	waitForEdges(t, publisher, 1)
+	conn := dialTestEndpoint(t, server, "/keeper")
+	waitForConnections(t, wsc, 1)
+
+	publisher.Publish(EventData{EventInfo: EventInfo{Service: "keeper", ActiveConnections: 42}})
+	var received EventData
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read relayed frame. Error: %v", err)
+	}
+	if received.EventInfo.ActiveConnections != 1 {
+		t.Errorf("Active connections of the edge. Expected: %v, Got: %v", 1, received.EventInfo.ActiveConnections)
+	}
+}
+
+func TestRelayRejectsWrongSecret(t *testing.T) {
+	publisher := newRelayPublisher(BrokerConfig{Address: "127.0.0.1:0", Secret: testRelaySecret})
+	if err := publisher.Start(); err != nil {
+		t.Fatalf("Could not start relay publisher. Error: %v", err)
+	}
+	t.Cleanup(func() { publisher.Close() })
+
+	edge := newRelayEdge(BrokerConfig{Address: publisher.listener.Addr().String(), ReconnectInterval: 50, Secret: "another-secret"})
+	frames := make(chan EventData, 1)
+	edge.Subscribe(func(data EventData) { frames <- data })
+	edge.Start()
+	t.Cleanup(func() { edge.Close() })
+
+	// a client that only listens never gets past the challenge
+	listener, err := net.Dial("tcp", publisher.listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Could not connect to relay publisher. Error: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	time.Sleep(200 * time.Millisecond)
+	publisher.Publish(EventData{EventInfo: EventInfo{Service: "keeper", FromTimepoint: 1000}})
+	if publisher.edgeCount() != 0 {
+		t.Errorf("Relay edges with a wrong secret. Expected: %v, Got: %v", 0, publisher.edgeCount())
+	}
+	select {
+	case frame := <-frames:
+		t.Errorf("Frame relayed to an edge with a wrong secret. Got: %v", frame)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestRelayProof(t *testing.T) {
+	proof := relayProof(testRelaySecret, "edge", "challenge")
+	tests := []struct {
+		secret    string
+		role      string
+		challenge string
+		valid     bool
+		message   string
+	}{
+		{testRelaySecret, "edge", "challenge", true, "Same secret, role and challenge"},
+		{"another-secret", "edge", "challenge", false, "Other secret"},
+		{testRelaySecret, "publisher", "challenge", false, "Reflected to the other role"},
+		{testRelaySecret, "edge", "other challenge", false, "Replayed for another challenge"},
+	}
+	for _, test := range tests {
+		if isRelayProof(test.secret, test.role, test.challenge, proof) != test.valid {
+			t.Errorf("%v. Expected: %v, Got: %v", test.message, test.valid, !test.valid)
+		}
+	}
+}
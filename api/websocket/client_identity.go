@@ -0,0 +1,132 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// parseTrustedProxies accepts single ips and cidr ranges. Invalid entries are logged and ignored.
+func parseTrustedProxies(trustedProxies []string) (networks []*net.IPNet) {
+	for _, trustedProxy := range trustedProxies {
+		if !strings.Contains(trustedProxy, "/") {
+			ip := net.ParseIP(trustedProxy)
+			if ip == nil {
+				log.Warn(fmt.Sprint("Trusted proxy ", trustedProxy, " is not a valid ip address. Ignoring it."), log.Websocket)
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(trustedProxy)
+		if err != nil {
+			log.Warn(fmt.Sprint("Trusted proxy ", trustedProxy, " is not a valid cidr range. Ignoring it."), log.Websocket)
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return
+}
+
+func (wsc *Websocket) isTrustedProxy(ip string) bool {
+	parsedIp := net.ParseIP(ip)
+	if parsedIp == nil {
+		return false
+	}
+	for _, network := range wsc.trustedProxies {
+		if network.Contains(parsedIp) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIp resolves the real client address. Forwarding headers are only used if the request comes from a trusted
+// proxy, otherwise every client could pretend to be someone else. The forwarding chain is walked from the right, the
+// first address that is not a trusted proxy is the client.
+func (wsc *Websocket) clientIp(r *http.Request) string {
+	ip := remoteIp(r)
+	if !wsc.isTrustedProxy(ip) {
+		return ip
+	}
+
+	chain := forwardedFor(r.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = xForwardedFor(r.Header.Values("X-Forwarded-For"))
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if net.ParseIP(chain[i]) == nil {
+			// obfuscated or unknown identifiers can not be resolved any further
+			break
+		}
+		ip = chain[i]
+		if !wsc.isTrustedProxy(ip) {
+			break
+		}
+	}
+	return ip
+}
+
+func remoteIp(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// xForwardedFor parses headers like "X-Forwarded-For: 203.0.113.7, 10.0.0.2"
+func xForwardedFor(headers []string) (chain []string) {
+	for _, header := range headers {
+		for _, item := range strings.Split(header, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				chain = append(chain, item)
+			}
+		}
+	}
+	return
+}
+
+// forwardedFor parses the for parameters of rfc 7239 headers like
+// "Forwarded: for=203.0.113.7;proto=https, for=\"[2001:db8::1]:4711\""
+func forwardedFor(headers []string) (chain []string) {
+	for _, header := range headers {
+		for _, element := range strings.Split(header, ",") {
+			for _, pair := range strings.Split(element, ";") {
+				key, value, found := strings.Cut(strings.TrimSpace(pair), "=")
+				if !found || !strings.EqualFold(key, "for") {
+					continue
+				}
+				chain = append(chain, forwardedNode(value))
+			}
+		}
+	}
+	return
+}
+
+func forwardedNode(value string) string {
+	value = strings.Trim(value, "\"")
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		return host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+}
+
+// newConnectionId generates the key of a connection in the registry. Remote address strings are not unique behind
+// a proxy and can be reused by the operating system.
+func newConnectionId() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		log.Error("Could not generate a random connection id.", err, log.Websocket)
+	}
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClientIp(t *testing.T) {
+	wsc := &Websocket{trustedProxies: parseTrustedProxies([]string{"127.0.0.1", "10.0.0.0/8", "invalid"})}
+
+	requests := []struct {
+		remoteAddr string
+		header     http.Header
+		clientIp   string
+	}{
+		// direct connection, no headers
+		{"203.0.113.7:4711", nil, "203.0.113.7"},
+		// untrusted peers can not spoof their address
+		{"203.0.113.7:4711", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "203.0.113.7"},
+		// nginx on localhost
+		{"127.0.0.1:51000", http.Header{"X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.1"},
+		// chain of trusted proxies, spoofed left most entry is ignored
+		{"127.0.0.1:51000", http.Header{"X-Forwarded-For": {"1.2.3.4, 198.51.100.1, 10.1.2.3"}}, "198.51.100.1"},
+		// rfc 7239 header is preferred
+		{"127.0.0.1:51000", http.Header{"Forwarded": {"for=198.51.100.2;proto=https"}, "X-Forwarded-For": {"198.51.100.1"}}, "198.51.100.2"},
+		{"127.0.0.1:51000", http.Header{"Forwarded": {"for=\"[2001:db8::1]:4711\""}}, "2001:db8::1"},
+		// obfuscated identifiers stop the resolution
+		{"127.0.0.1:51000", http.Header{"Forwarded": {"for=_hidden, for=10.0.0.5"}}, "10.0.0.5"},
+		// proxy without headers
+		{"127.0.0.1:51000", nil, "127.0.0.1"},
+	}
+	for _, requestTest := range requests {
+		r := &http.Request{RemoteAddr: requestTest.remoteAddr, Header: requestTest.header}
+		if r.Header == nil {
+			r.Header = http.Header{}
+		}
+		if ip := wsc.clientIp(r); ip != requestTest.clientIp {
+			t.Errorf("Client ip of %v %v. Expected: %v, Got: %v", requestTest.remoteAddr, requestTest.header, requestTest.clientIp, ip)
+		}
+	}
+}
+
+func TestConnectionIdsAreUnique(t *testing.T) {
+	ids := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		id := newConnectionId()
+		if _, exists := ids[id]; exists || len(id) != 32 {
+			t.Fatalf("Connection id %v is not unique or has the wrong length.", id)
+		}
+		ids[id] = struct{}{}
+	}
+}
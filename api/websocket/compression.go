@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+func (c CompressionConfig) isValidLevel() bool {
+	// see compress/flate, gorilla websocket accepts HuffmanOnly (-2) to BestCompression (9)
+	return c.Level >= -2 && c.Level <= 9
+}
+
+// compressionStats compares the payload of the written messages with the bytes that went over the wire. Without
+// compression the wire bytes are slightly bigger than the payload because of the frame headers and pings.
+type compressionStats struct {
+	payloadBytes int64
+	wireBytes    int64
+}
+
+func (cs *compressionStats) addPayload(n int) {
+	atomic.AddInt64(&cs.payloadBytes, int64(n))
+}
+
+func (cs *compressionStats) ratio() float64 {
+	payloadBytes := atomic.LoadInt64(&cs.payloadBytes)
+	if payloadBytes == 0 {
+		return 1
+	}
+	return float64(atomic.LoadInt64(&cs.wireBytes)) / float64(payloadBytes)
+}
+
+func (cs *compressionStats) String() string {
+	return fmt.Sprintf("%d payload bytes sent as %d bytes (ratio %.2f)",
+		atomic.LoadInt64(&cs.payloadBytes), atomic.LoadInt64(&cs.wireBytes), cs.ratio())
+}
+
+// countingResponseWriter hands a byte counting connection to the websocket upgrader, because gorilla websocket
+// does not report how many bytes a compressed message took.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	stats *compressionStats
+}
+
+func (w countingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not implement http.Hijacker")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return conn, brw, err
+	}
+	return &countingConn{Conn: conn, stats: w.stats}, brw, nil
+}
+
+type countingConn struct {
+	net.Conn
+	stats *compressionStats
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.stats.wireBytes, int64(n))
+	return n, err
+}
+
+func (wsc *Websocket) logCompressionStats(conn *connection) {
+	if !wsc.config.Compression.Enabled {
+		return
+	}
+	log.Info(fmt.Sprint("Compression of remote websocket ", conn, ": ", conn.stats.String()), log.Websocket)
+}
@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func compressionRatioAfterBroadcast(t *testing.T, config Config, data string) float64 {
+	wsc, server := newTestEndpoint(t, config)
+	dialer := websocket.Dialer{EnableCompression: true}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+config.EndpointPath, nil)
+	if err != nil {
+		t.Fatalf("Could not dial. Error: %v", err)
+	}
+	defer conn.Close()
+	waitForConnections(t, wsc, 1)
+
+	wsc.SendDataInBulk(EventData{Data: data, EventInfo: EventInfo{Service: "keeper"}})
+	var received EventData
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err = conn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read frame. Error: %v", err)
+	}
+	if received.Data != data {
+		t.Errorf("Received data differs from the sent data.")
+	}
+
+	for _, wsConnection := range wsc.connections() {
+		return wsConnection.stats.ratio()
+	}
+	t.Fatalf("Connection is not registered.")
+	return 0
+}
+
+func TestCompression(t *testing.T) {
+	repetitive := strings.Repeat(`{"InstituteName":"ABC1 Institute","Location":{"coordinate":{"lat":48.1,"long":11.5}}},`, 200)
+
+	compressed := compressionRatioAfterBroadcast(t, Config{EndpointPath: "/keeper", MaxConnections: 10,
+		Compression: CompressionConfig{Enabled: true, Level: 6, MinSize: 1024}}, repetitive)
+	if compressed > 0.5 {
+		t.Errorf("Repetitive frames should compress well. Got ratio: %v", compressed)
+	}
+
+	belowMinSize := compressionRatioAfterBroadcast(t, Config{EndpointPath: "/keeper", MaxConnections: 10,
+		Compression: CompressionConfig{Enabled: true, MinSize: 1024 * 1024}}, repetitive)
+	if belowMinSize < 1 {
+		t.Errorf("Frames below the minimum size should not be compressed. Got ratio: %v", belowMinSize)
+	}
+}
@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// connection is one client of an endpoint. Every connection has its own outbound queue and writer goroutine, so a
+// slow client never delays the broadcast to the other clients. Frames are queued encoded in the protocol the client
+// negotiated and written by the transport, a websocket or a server-sent events stream.
+type connection struct {
+	id               string
+	remoteAddr       string
+	ip               string // client ip, resolved through trusted proxies
+	transport        transport
+	protocol         protocol
+	queue            chan outboundMessage
+	heartbeat        time.Duration
+	done             chan struct{}
+	drained          chan struct{} // closed once the last message before shutdown is written
+	closeOnce        sync.Once
+	stats            *compressionStats
+	access           *accessToken // nil if the endpoint does not require tokens
+	subscriptionLock sync.RWMutex
+	subscription     subscription
+}
+
+// transport writes encoded messages to a client. Only the writer goroutine of a connection writes messages and
+// heartbeats, closing may happen from any goroutine.
+type transport interface {
+	write(message outboundMessage) error
+	heartbeat() error
+	closeNormally(reason string) error // tells the client that the server closes the connection on purpose
+	close() error
+}
+
+func newConnection(t transport, remoteAddr string, stats *compressionStats, access *accessToken, ip string, p protocol, queueSize int, config Config) *connection {
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	if stats == nil {
+		stats = &compressionStats{}
+	}
+	return &connection{
+		id:         newConnectionId(),
+		remoteAddr: remoteAddr,
+		ip:         ip,
+		transport:  t,
+		protocol:   p,
+		queue:      make(chan outboundMessage, queueSize),
+		heartbeat:  time.Duration(config.PingInterval) * time.Millisecond,
+		done:       make(chan struct{}),
+		drained:    make(chan struct{}),
+		stats:      stats,
+		access:     access,
+	}
+}
+
+func (c *connection) String() string {
+	if c.ip == c.remoteAddr || strings.HasPrefix(c.remoteAddr, c.ip+":") || strings.HasPrefix(c.remoteAddr, "["+c.ip+"]:") {
+		return fmt.Sprint(c.id, " (", c.remoteAddr, ")")
+	}
+	return fmt.Sprint(c.id, " (", c.ip, " via ", c.remoteAddr, ")")
+}
+
+// enqueue returns false if the queue is full. The client is then too far behind to keep up.
+func (c *connection) enqueue(message outboundMessage) bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+	}
+	select {
+	case c.queue <- message:
+		return true
+	default:
+		return false
+	}
+}
+
+// writer writes the queued frames and the heartbeats until the connection is closed. onError is called once if a
+// write fails.
+func (c *connection) writer(onError func(err error)) {
+	var heartbeatTicker <-chan time.Time
+	if c.heartbeat > 0 {
+		ticker := time.NewTicker(c.heartbeat)
+		defer ticker.Stop()
+		heartbeatTicker = ticker.C
+	}
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-heartbeatTicker:
+			if err := c.transport.heartbeat(); err != nil {
+				onError(err)
+				return
+			}
+		case message := <-c.queue:
+			if err := c.transport.write(message); err != nil {
+				onError(err)
+				return
+			}
+			c.stats.addPayload(len(message.data))
+			if message.last {
+				close(c.drained)
+			}
+		}
+	}
+}
+
+func (c *connection) close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.transport.close()
+	})
+	return err
+}
+
+func (c *connection) getSubscription() subscription {
+	c.subscriptionLock.RLock()
+	defer c.subscriptionLock.RUnlock()
+	return c.subscription
+}
+
+func (c *connection) setSubscription(s subscription) {
+	c.subscriptionLock.Lock()
+	c.subscription = s
+	c.subscriptionLock.Unlock()
+}
@@ -0,0 +1,76 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// reconnectDelay spreads reconnecting clients over the jitter, so they do not all come back at the same moment after
+// a deploy
+func (wsc *Websocket) reconnectDelay() time.Duration {
+	delay := time.Duration(wsc.config.ReconnectDelay) * time.Millisecond
+	if wsc.config.ReconnectJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(wsc.config.ReconnectJitter)+1)) * time.Millisecond
+	}
+	return delay
+}
+
+// sendGoingAway queues the going away message behind the frames the client has not received yet. Clients whose queue
+// is full are too far behind to be drained and are closed right away.
+func (wsc *Websocket) sendGoingAway(conn *connection) {
+	message, err := wsc.goingAwayMessage()
+	if err != nil {
+		log.Error("Could not encode going away message.", err, log.Websocket)
+		wsc.removeConnection(conn)
+		return
+	}
+	message.last = true
+	if !conn.enqueue(message) {
+		log.Warn(fmt.Sprint("Could not drain remote websocket ", conn, ". Its queue is full."), log.Websocket)
+		wsc.removeConnection(conn)
+	}
+}
+
+// goAway tells a client that could not be registered because the endpoint shuts down when to reconnect and closes
+// its transport. The client has no queue yet, so the message is written directly.
+func (wsc *Websocket) goAway(t transport) {
+	message, err := wsc.goingAwayMessage()
+	if err == nil {
+		err = t.write(message)
+	}
+	if err != nil {
+		log.Debug(fmt.Sprint("Could not send going away message. Error: ", err), log.Websocket)
+	}
+	if err = t.closeNormally("Server shut down."); err != nil {
+		log.Debug(fmt.Sprint("Could not send close message. Error: ", err), log.Websocket)
+	}
+	t.close()
+}
+
+func (wsc *Websocket) goingAwayMessage() (outboundMessage, error) {
+	retryAfter := wsc.reconnectDelay()
+	message, err := encodeControlMessage(ControlMessage{Control: ControlGoingAway, RetryAfter: retryAfter.Milliseconds()})
+	message.reconnectDelay = retryAfter.Milliseconds()
+	return message, err
+}
+
+// waitForDrain waits until every connection has written its going away message, was closed or the drain timeout
+// passed
+func (wsc *Websocket) waitForDrain(wsConnections map[string]*connection, timeout time.Duration) {
+	if timeout <= 0 || len(wsConnections) == 0 {
+		return
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for _, wsConnection := range wsConnections {
+		select {
+		case <-wsConnection.drained:
+		case <-wsConnection.done:
+		case <-timer.C:
+			log.Warn(fmt.Sprint("Drain timeout of ", timeout, " on ", wsc.config.EndpointPath, " passed. Closing connections that still have queued frames."), log.Websocket)
+			return
+		}
+	}
+}
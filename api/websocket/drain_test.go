@@ -0,0 +1,125 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDrainOnStop(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10, MaxQueuedFrames: 4,
+		DrainTimeout: 2000, ReconnectDelay: 1000, ReconnectJitter: 500})
+	conn := dialTestEndpoint(t, server, "/keeper")
+	waitForConnections(t, wsc, 1)
+
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "keeper", FromTimepoint: 1000}})
+	wsc.StopWebsocket()
+	waitForConnections(t, wsc, 0)
+
+	// the queued frame is flushed before the going away message and the close
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var frame EventData
+	if err := conn.ReadJSON(&frame); err != nil || frame.EventInfo.FromTimepoint != 1000 {
+		t.Fatalf("Queued frame. Expected: %v, Got: %v (%v)", 1000, frame.EventInfo.FromTimepoint, err)
+	}
+	var goingAway ControlMessage
+	if err := conn.ReadJSON(&goingAway); err != nil {
+		t.Fatalf("Could not read going away message. Error: %v", err)
+	}
+	if goingAway.Control != ControlGoingAway || goingAway.RetryAfter < 1000 || goingAway.RetryAfter > 1500 {
+		t.Errorf("Going away message. Expected: %v with retry after 1000 to 1500, Got: %v", ControlGoingAway, goingAway)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+		t.Errorf("Close after drain. Expected: %v, Got: %v", "normal closure", err)
+	}
+
+	if status := dialStatus(t, server, "/keeper", nil); status != http.StatusServiceUnavailable {
+		t.Errorf("Upgrade while shutting down. Expected: %v, Got: %v", http.StatusServiceUnavailable, status)
+	}
+}
+
+func TestDrainServerSentEvents(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/minerva", SSEPath: "/minerva/events", MaxConnections: 10,
+		DrainTimeout: 2000, ReconnectDelay: 3000})
+	reader := openEventStream(t, server, "/minerva/events", "")
+	waitForConnections(t, wsc, 1)
+
+	wsc.StopWebsocket()
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Could not read going away event. Error: %v", err)
+		}
+		if line == "\n" {
+			break
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+	if len(lines) != 3 || lines[0] != "event: control" || lines[1] != "retry: 3000" {
+		t.Fatalf("Going away event. Expected: %v, Got: %v", "control event with retry 3000", lines)
+	}
+	var goingAway ControlMessage
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &goingAway); err != nil || goingAway.Control != ControlGoingAway {
+		t.Errorf("Going away message. Expected: %v, Got: %v (%v)", ControlGoingAway, lines[2], err)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	wsc := &Websocket{}
+	// the writer of this connection never runs, so it never drains
+	conn := newConnection(nil, "192.0.2.1:4711", nil, nil, "192.0.2.1", protocolV1, 1, Config{})
+
+	started := time.Now()
+	wsc.waitForDrain(map[string]*connection{conn.id: conn}, 100*time.Millisecond)
+	if waited := time.Since(started); waited < 100*time.Millisecond || waited > time.Second {
+		t.Errorf("Drain wait. Expected: %v, Got: %v", 100*time.Millisecond, waited)
+	}
+}
+
+type recordingTransport struct {
+	written []outboundMessage
+	closed  bool
+}
+
+func (rt *recordingTransport) write(message outboundMessage) error {
+	rt.written = append(rt.written, message)
+	return nil
+}
+func (rt *recordingTransport) heartbeat() error                  { return nil }
+func (rt *recordingTransport) closeNormally(reason string) error { return nil }
+func (rt *recordingTransport) close() error {
+	rt.closed = true
+	return nil
+}
+
+func TestRegisterWhileShuttingDown(t *testing.T) {
+	wsc := &Websocket{}
+	wsc.init(Config{EndpointPath: "/keeper", MaxConnections: 10, ReconnectDelay: 2000})
+	// admitted before the shutdown started
+	wsc.pendingUpgrades = 1
+	wsc.connectionsPerIp["192.0.2.1"] = 1
+	wsc.serverShuttingDown.Store(true)
+
+	rt := &recordingTransport{}
+	if conn := wsc.register(rt, "192.0.2.1:4711", nil, nil, "192.0.2.1", protocolV1, subscription{}, 0); conn != nil {
+		t.Fatalf("Registered connection. Expected: %v, Got: %v", nil, conn)
+	}
+	if wsc.GetActiveConnections() != 0 || wsc.pendingUpgrades != 0 || len(wsc.connectionsPerIp) != 0 {
+		t.Errorf("Slot after the rejection. Expected: freed, Got: %v connections, %v pending, %v per ip",
+			wsc.GetActiveConnections(), wsc.pendingUpgrades, wsc.connectionsPerIp)
+	}
+
+	wsc.goAway(rt)
+	var goingAway ControlMessage
+	if len(rt.written) != 1 || json.Unmarshal(rt.written[0].data, &goingAway) != nil || goingAway.Control != ControlGoingAway || goingAway.RetryAfter != 2000 {
+		t.Errorf("Going away message. Expected: %v with retry after 2000, Got: %v", ControlGoingAway, rt.written)
+	}
+	if !rt.closed {
+		t.Errorf("Transport closed. Expected: %v, Got: %v", true, rt.closed)
+	}
+}
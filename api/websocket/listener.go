@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"api/utils/mail"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// listener is one http server on one listen address. Several websocket endpoints can share a listener as long as
+// their endpoint paths differ.
+type listener struct {
+	address      string
+	server       *http.Server
+	mux          *http.ServeMux
+	tlsConfig    TLSConfig
+	endpoints    map[string]*Websocket
+	shuttingDown bool
+}
+
+var (
+	listeners     = make(map[string]*listener)
+	listenersLock sync.Mutex
+)
+
+func registerEndpoint(wsc *Websocket) (*listener, error) {
+	listenersLock.Lock()
+	defer listenersLock.Unlock()
+
+	address := wsc.config.ListenAddress()
+	handlers := wsc.handlers()
+	if len(wsc.config.SSEPath) > 0 && wsc.config.SSEPath == wsc.config.EndpointPath {
+		return nil, errors.New(fmt.Sprint("sse path and endpoint path are both ", wsc.config.EndpointPath))
+	}
+	l, exists := listeners[address]
+	if exists {
+		for path := range handlers {
+			if _, pathExists := l.endpoints[path]; pathExists {
+				return nil, errors.New(fmt.Sprint("endpoint path ", path, " is already registered on ", address))
+			}
+		}
+		if l.tlsConfig != wsc.config.TLS {
+			return nil, errors.New(fmt.Sprint("endpoint ", wsc.config.EndpointPath, " has different tls settings than the other endpoints on ", address))
+		}
+	} else {
+		mux := http.NewServeMux()
+		l = &listener{
+			address:   address,
+			server:    &http.Server{Addr: address, Handler: mux},
+			mux:       mux,
+			tlsConfig: wsc.config.TLS,
+			endpoints: make(map[string]*Websocket),
+		}
+		if l.tlsConfig.IsEnabled() {
+			tlsConfig, err := newTLSConfig(l.tlsConfig)
+			if err != nil {
+				return nil, err
+			}
+			l.server.TLSConfig = tlsConfig
+		}
+		listeners[address] = l
+	}
+
+	for path, handler := range handlers {
+		l.endpoints[path] = wsc
+		l.mux.HandleFunc(path, handler)
+	}
+
+	if !exists {
+		l.start()
+	}
+
+	return l, nil
+}
+
+func unregisterEndpoint(wsc *Websocket) {
+	listenersLock.Lock()
+	l, exists := listeners[wsc.config.ListenAddress()]
+	if !exists {
+		listenersLock.Unlock()
+		return
+	}
+	for path := range wsc.handlers() {
+		delete(l.endpoints, path)
+	}
+	// the http.ServeMux can not unregister a handler, the endpoint itself rejects requests from now on
+	if len(l.endpoints) > 0 {
+		listenersLock.Unlock()
+		return
+	}
+	l.shuttingDown = true
+	delete(listeners, l.address)
+	listenersLock.Unlock()
+
+	log.Info(fmt.Sprint("No endpoints left on ", l.address, ". Stopping websocket server."), log.Websocket)
+	// the connections are already drained, this only waits for requests that are still being answered
+	shutdownTimeout := time.Duration(wsc.config.DrainTimeout) * time.Millisecond
+	if shutdownTimeout < time.Second {
+		shutdownTimeout = time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	err := l.server.Shutdown(ctx)
+	if err != nil {
+		log.Error("Could not stop websocket server", err, log.Websocket)
+	}
+}
+
+// handlers returns the http handlers of an endpoint by path
+func (wsc *Websocket) handlers() map[string]http.HandlerFunc {
+	handlers := map[string]http.HandlerFunc{wsc.config.EndpointPath: wsc.wsEndpoint}
+	if len(wsc.config.SSEPath) > 0 {
+		handlers[wsc.config.SSEPath] = wsc.sseEndpoint
+	}
+	for path, handler := range wsc.extraHandlers {
+		handlers[path] = handler
+	}
+	return handlers
+}
+
+func (l *listener) start() {
+	go func() {
+		var err error
+		if l.tlsConfig.IsEnabled() {
+			log.Info(fmt.Sprint("Starting websocket server with tls on ", l.address, "."), log.Websocket)
+			// certificate and key are served by the tls config, so they can be reloaded
+			err = l.server.ListenAndServeTLS("", "")
+		} else {
+			log.Info(fmt.Sprint("Starting websocket server on ", l.address, "."), log.Websocket)
+			err = l.server.ListenAndServe()
+		}
+		if err == nil {
+			return
+		}
+
+		listenersLock.Lock()
+		shuttingDown := l.shuttingDown
+		// the websocket and sse path of a service share one endpoint
+		endpoints := make(map[*Websocket]struct{}, len(l.endpoints))
+		for _, endpoint := range l.endpoints {
+			endpoints[endpoint] = struct{}{}
+		}
+		listenersLock.Unlock()
+
+		if shuttingDown {
+			log.Info(fmt.Sprint("Server shutting down. Error: ", err), log.Websocket)
+			return
+		}
+		logMessage := fmt.Sprint("Could not listen and serve websocket on ", l.address, ".")
+		log.Error(logMessage, err, log.Websocket)
+		mail.SendErrorMail(logMessage, err)
+		// every endpoint on this listener is affected
+		for endpoint := range endpoints {
+			endpoint.reportError(err)
+		}
+	}()
+}
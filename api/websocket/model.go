@@ -1,10 +1,80 @@
 package websocket
 
-import "api/geo"
+import (
+	"api/geo"
+	"net"
+	"strconv"
+)
 
 type Config struct {
-	EndpointPath   string `yaml:"endpointPath"`
-	MaxConnections int    `yaml:"maxConnections"`
+	Address             string            `yaml:"address"` // listen address, empty means all interfaces
+	Port                int               `yaml:"port"`    // services with the same address and port share one http server
+	EndpointPath        string            `yaml:"endpointPath"`
+	SSEPath             string            `yaml:"ssePath"`             // server-sent events endpoint for clients behind proxies that block websockets, empty disables it
+	MaxConnections      int               `yaml:"maxConnections"`      // per endpoint
+	TLS                 TLSConfig         `yaml:"tls"`                 // endpoints on the same listen address need the same tls settings
+	ReplayDuration      int               `yaml:"replayDuration"`      // seconds of recent frames sent to new clients, 0 disables replay
+	MaxQueuedFrames     int               `yaml:"maxQueuedFrames"`     // clients that fall more frames behind are dropped
+	WriteTimeout        int               `yaml:"writeTimeout"`        // milliseconds, a client that does not accept a frame in time is dropped
+	PingInterval        int               `yaml:"pingInterval"`        // milliseconds between heartbeat pings, 0 disables pings
+	PongTimeout         int               `yaml:"pongTimeout"`         // milliseconds a client has to answer a ping
+	IdleTimeout         int               `yaml:"idleTimeout"`         // milliseconds without any message or pong before a client is dropped
+	AllowedOrigins      []string          `yaml:"allowedOrigins"`      // browser origins like "https://hatnote.mpdl.mpg.de", empty allows all
+	MaxConnectionsPerIp int               `yaml:"maxConnectionsPerIp"` // 0 disables the limit
+	UpgradesPerMinute   int               `yaml:"upgradesPerMinute"`   // connection attempts per client ip, 0 disables rate limiting
+	UpgradeBurst        int               `yaml:"upgradeBurst"`        // connection attempts a client ip may make at once
+	TrustedProxies      []string          `yaml:"trustedProxies"`      // ips or cidr ranges whose X-Forwarded-For and Forwarded headers are used
+	Compression         CompressionConfig `yaml:"compression"`
+	Auth                AuthConfig        `yaml:"auth"`
+	DrainTimeout        int               `yaml:"drainTimeout"`    // milliseconds clients get on shutdown to receive their queued frames
+	ReconnectDelay      int               `yaml:"reconnectDelay"`  // milliseconds clients are told to wait before they reconnect after a shutdown
+	ReconnectJitter     int               `yaml:"reconnectJitter"` // milliseconds, random extra delay per client so they do not reconnect at once, 0 disables it
+	Broker              BrokerConfig      `yaml:"broker"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile"` // tls is enabled if certificate and key file are set
+	KeyFile      string `yaml:"keyFile"`
+	MinVersion   string `yaml:"minVersion"`   // "1.2" or "1.3", defaults to "1.2"
+	ClientCAFile string `yaml:"clientCaFile"` // optional, requires client certificates signed by this CA (mutual tls)
+}
+
+// CompressionConfig configures permessage-deflate. Clients that do not offer the extension get uncompressed frames.
+type CompressionConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Level   int  `yaml:"level"`   // flate level from 1 (fastest) to 9 (smallest), 0 keeps the default
+	MinSize int  `yaml:"minSize"` // bytes, smaller messages are not worth compressing
+}
+
+// BrokerConfig selects how frames get from the service poller to the endpoint, see Broker
+type BrokerConfig struct {
+	Type              string `yaml:"type"`              // "local" (default), "relayPublisher" or "relayEdge"
+	Address           string `yaml:"address"`           // relay listen address of the publisher, or the publisher address edges connect to
+	ReconnectInterval int    `yaml:"reconnectInterval"` // milliseconds between connection attempts of edges
+	Secret            string `yaml:"secret"`            // shared by the publisher and its edges, at least 32 random bytes
+}
+
+// AuthConfig configures the shared secrets access tokens are signed with. Clients need a valid token as soon as one key
+// is configured.
+type AuthConfig struct {
+	Keys []AuthKey `yaml:"keys"`
+}
+
+type AuthKey struct {
+	Id     string `yaml:"id"`     // matched against the kid header of JWTs, tokens without kid are checked with every key
+	Secret string `yaml:"secret"` // HMAC secret, at least 32 random bytes
+}
+
+func (c AuthConfig) IsEnabled() bool {
+	return len(c.Keys) > 0
+}
+
+func (c TLSConfig) IsEnabled() bool {
+	return len(c.CertFile) > 0 && len(c.KeyFile) > 0
+}
+
+func (c Config) ListenAddress() string {
+	return net.JoinHostPort(c.Address, strconv.Itoa(c.Port))
 }
 
 /******************************************
@@ -71,10 +141,49 @@ type KeeperActivatedUser struct {
 	InstituteName string `json:"InstituteName"`
 }
 
+type KeeperFileDeletion struct {
+	ObjectType    string       `json:"ObjectType"`
+	OperationSize int64        `json:"OperationSize"`
+	Timestamp     int64        `json:"Timestamp"`
+	InstituteName string       `json:"InstituteName"`
+	Location      geo.Location `json:"Location"`
+}
+
+type KeeperRename struct {
+	ObjectType    string       `json:"ObjectType"`
+	OperationType string       `json:"OperationType"`
+	OperationSize int64        `json:"OperationSize"`
+	Timestamp     int64        `json:"Timestamp"`
+	InstituteName string       `json:"InstituteName"`
+	Location      geo.Location `json:"Location"`
+}
+
+type KeeperShare struct {
+	ShareType     string       `json:"ShareType"`
+	OperationSize int64        `json:"OperationSize"`
+	Timestamp     int64        `json:"Timestamp"`
+	InstituteName string       `json:"InstituteName"`
+	Location      geo.Location `json:"Location"`
+}
+
+type KeeperFileDownload struct {
+	DownloadType  string       `json:"DownloadType"`
+	OperationSize int64        `json:"OperationSize"`
+	Timestamp     int64        `json:"Timestamp"`
+	InstituteName string       `json:"InstituteName"`
+	Location      geo.Location `json:"Location"`
+}
+
+// KeeperData has the optional event types only if they are turned on in the service config, so the frames of the
+// other displays do not change
 type KeeperData struct {
 	FileCreationsAndEditings []KeeperFileCreationAndEditing `json:"FileCreationsAndEditings"`
 	LibraryCreations         []KeeperLibraryCreation        `json:"LibraryCreations"`
 	ActivatedUsers           []KeeperActivatedUser          `json:"ActivatedUsers"`
+	FileDeletions            []KeeperFileDeletion           `json:"FileDeletions,omitempty"`
+	Renames                  []KeeperRename                 `json:"Renames,omitempty"`
+	Shares                   []KeeperShare                  `json:"Shares,omitempty"`
+	FileDownloads            []KeeperFileDownload           `json:"FileDownloads,omitempty"`
 }
 
 /******************************************
@@ -107,3 +216,18 @@ type BloxbergData struct {
 	ConfirmedTransactions []BloxbergConfirmedTransaction `json:"ConfirmedTransactions"`
 	LicensedContributors  []BloxbergLicensedContributor  `json:"LicensedContributors"`
 }
+
+/******************************************
+ ** sql and webhook websocket data structures **
+ *****************************************/
+
+type GenericEvent struct {
+	Timestamp     int64        `json:"Timestamp"`
+	Magnitude     float64      `json:"Magnitude"`
+	InstituteName string       `json:"InstituteName"`
+	Location      geo.Location `json:"Location"`
+}
+
+// GenericData has a list of events per event kind. The services of type sql and webhook define their event kinds in the
+// environment yaml.
+type GenericData map[string][]GenericEvent
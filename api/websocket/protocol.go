@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+)
+
+// Protocols a client can negotiate with the Sec-WebSocket-Protocol header or the 'protocol' and 'encoding' query
+// parameters. Clients that negotiate nothing get protocol v1, which the existing frontends expect.
+//
+// v1:      EventData, Data is a string that contains the json encoded service data
+// v2:      FrameV2 as json text frames, Data is the service data object
+// v2.cbor: FrameV2 as cbor binary frames, for clients that receive large bursts
+//
+// Control messages are always json text frames.
+type protocol int
+
+const (
+	protocolV1 protocol = iota
+	protocolV2
+	protocolV2Cbor
+)
+
+var subprotocols = map[string]protocol{
+	"hatnote.v1":      protocolV1,
+	"hatnote.v2":      protocolV2,
+	"hatnote.v2.cbor": protocolV2Cbor,
+}
+
+func (p protocol) String() string {
+	for name, subprotocol := range subprotocols {
+		if subprotocol == p {
+			return name
+		}
+	}
+	return "unknown"
+}
+
+// FrameV2 is the event frame of protocol v2
+type FrameV2 struct {
+	Protocol  int             `json:"Protocol"`
+	Data      json.RawMessage `json:"Data"`
+	EventInfo EventInfo       `json:"EventInfo"`
+}
+
+// negotiateProtocol picks the first subprotocol the client offers that is supported. The chosen subprotocol has to
+// be echoed in the upgrade response.
+func negotiateProtocol(r *http.Request) (p protocol, subprotocol string) {
+	for _, offered := range websocket.Subprotocols(r) {
+		if supported, exists := subprotocols[offered]; exists {
+			return supported, offered
+		}
+	}
+
+	query := r.URL.Query()
+	if strings.EqualFold(query.Get("protocol"), "v2") {
+		if strings.EqualFold(query.Get("encoding"), "cbor") {
+			return protocolV2Cbor, ""
+		}
+		return protocolV2, ""
+	}
+	return protocolV1, ""
+}
+
+// outboundMessage is an encoded websocket message, ready to be written to any connection with the same protocol
+type outboundMessage struct {
+	messageType    int
+	data           []byte
+	eventId        int64 // FromTimepoint of event frames, used as the id of server-sent events
+	reconnectDelay int64 // milliseconds server-sent events clients wait before they reconnect, 0 keeps their default
+	last           bool  // nothing is queued after this message while draining
+}
+
+func encodeControlMessage(message ControlMessage) (outboundMessage, error) {
+	data, err := json.Marshal(message)
+	return outboundMessage{messageType: websocket.TextMessage, data: data}, err
+}
+
+func encodeEventData(data EventData, p protocol) (outboundMessage, error) {
+	switch p {
+	case protocolV2:
+		frame := FrameV2{Protocol: 2, Data: rawServiceData(data), EventInfo: data.EventInfo}
+		encoded, err := json.Marshal(frame)
+		return outboundMessage{messageType: websocket.TextMessage, data: encoded, eventId: data.EventInfo.FromTimepoint}, err
+	case protocolV2Cbor:
+		serviceData, err := decodeServiceData(data)
+		if err != nil {
+			return outboundMessage{}, err
+		}
+		frame := struct {
+			Protocol  int         `json:"Protocol"`
+			Data      interface{} `json:"Data"`
+			EventInfo EventInfo   `json:"EventInfo"`
+		}{Protocol: 2, Data: serviceData, EventInfo: data.EventInfo}
+		encoded, err := cbor.Marshal(frame)
+		return outboundMessage{messageType: websocket.BinaryMessage, data: encoded, eventId: data.EventInfo.FromTimepoint}, err
+	}
+	encoded, err := json.Marshal(data)
+	return outboundMessage{messageType: websocket.TextMessage, data: encoded, eventId: data.EventInfo.FromTimepoint}, err
+}
+
+func rawServiceData(data EventData) json.RawMessage {
+	if len(data.Data) == 0 {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(data.Data)
+}
+
+// decodeServiceData turns the json service data into values cbor can encode compactly. Integers stay integers
+// instead of becoming floating point numbers.
+func decodeServiceData(data EventData) (serviceData interface{}, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(rawServiceData(data)))
+	decoder.UseNumber()
+	if err = decoder.Decode(&serviceData); err != nil {
+		return
+	}
+	return convertNumbers(serviceData), nil
+}
+
+func convertNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if integer, err := v.Int64(); err == nil {
+			return integer
+		}
+		float, _ := v.Float64()
+		return float
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = convertNumbers(item)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = convertNumbers(item)
+		}
+	}
+	return value
+}
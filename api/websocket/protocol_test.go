@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/gorilla/websocket"
+)
+
+func testMinervaEventData() EventData {
+	minervaData, _ := json.Marshal(MinervaData{Messages: []MinervaMessage{{InstituteName: "ABC1 Institute", MessageLength: 42}}})
+	return EventData{Data: string(minervaData), EventInfo: EventInfo{Service: "minerva", FromTimepoint: 1000}}
+}
+
+func TestNegotiateProtocol(t *testing.T) {
+	requests := []struct {
+		url         string
+		header      http.Header
+		protocol    protocol
+		subprotocol string
+	}{
+		{"/minerva", nil, protocolV1, ""},
+		{"/minerva", http.Header{"Sec-Websocket-Protocol": {"unknown, hatnote.v2"}}, protocolV2, "hatnote.v2"},
+		{"/minerva", http.Header{"Sec-Websocket-Protocol": {"hatnote.v2.cbor, hatnote.v2"}}, protocolV2Cbor, "hatnote.v2.cbor"},
+		{"/minerva?protocol=v2", nil, protocolV2, ""},
+		{"/minerva?protocol=v2&encoding=cbor", nil, protocolV2Cbor, ""},
+	}
+	for _, requestTest := range requests {
+		r, _ := http.NewRequest(http.MethodGet, requestTest.url, nil)
+		for key, values := range requestTest.header {
+			r.Header[key] = values
+		}
+		p, subprotocol := negotiateProtocol(r)
+		if p != requestTest.protocol || subprotocol != requestTest.subprotocol {
+			t.Errorf("Negotiate %v %v. Expected: %v %v, Got: %v %v", requestTest.url, requestTest.header, requestTest.protocol, requestTest.subprotocol, p, subprotocol)
+		}
+	}
+}
+
+func TestEncodeEventDataV2(t *testing.T) {
+	message, err := encodeEventData(testMinervaEventData(), protocolV2)
+	if err != nil || message.messageType != websocket.TextMessage {
+		t.Fatalf("Could not encode v2 frame. Error: %v", err)
+	}
+	var frame struct {
+		Protocol int
+		Data     MinervaData
+	}
+	if err = json.Unmarshal(message.data, &frame); err != nil {
+		t.Fatalf("Data of a v2 frame should be an object. Error: %v", err)
+	}
+	if frame.Protocol != 2 || frame.Data.Messages[0].MessageLength != 42 {
+		t.Errorf("Decoded v2 frame. Got: %+v", frame)
+	}
+
+	message, err = encodeEventData(testMinervaEventData(), protocolV2Cbor)
+	if err != nil || message.messageType != websocket.BinaryMessage {
+		t.Fatalf("Could not encode cbor frame. Error: %v", err)
+	}
+	frame.Data = MinervaData{}
+	if err = cbor.Unmarshal(message.data, &frame); err != nil {
+		t.Fatalf("Could not decode cbor frame. Error: %v", err)
+	}
+	if frame.Data.Messages[0].InstituteName != "ABC1 Institute" || frame.Data.Messages[0].MessageLength != 42 {
+		t.Errorf("Decoded cbor frame. Got: %+v", frame)
+	}
+}
+
+func TestProtocolV2OverConnection(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/minerva", MaxConnections: 10})
+	dialer := websocket.Dialer{Subprotocols: []string{"hatnote.v2"}}
+	conn, response, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/minerva", nil)
+	if err != nil {
+		t.Fatalf("Could not dial. Error: %v", err)
+	}
+	defer conn.Close()
+	if response.Header.Get("Sec-Websocket-Protocol") != "hatnote.v2" {
+		t.Errorf("Negotiated subprotocol. Expected: %v, Got: %v", "hatnote.v2", response.Header.Get("Sec-Websocket-Protocol"))
+	}
+	waitForConnections(t, wsc, 1)
+
+	wsc.SendDataInBulk(testMinervaEventData())
+	var frame FrameV2
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err = conn.ReadJSON(&frame); err != nil {
+		t.Fatalf("Could not read frame. Error: %v", err)
+	}
+	if frame.Protocol != 2 || !strings.HasPrefix(string(frame.Data), "{") {
+		t.Errorf("Frame should be a v2 frame with object data. Got: %v", string(frame.Data))
+	}
+}
@@ -0,0 +1,383 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The relay streams frames as newline delimited EventData json over plain tcp from the publisher, the one instance
+// that polls the databases, to any number of edge instances. It scales out the endpoints of one deployment and is
+// meant for the internal network between its api instances, the relay address should not be reachable from outside.
+// The relay service type (api/service/relay) is not a replacement: it re-broadcasts the public websocket endpoint of
+// another hatnote api, e.g. of another organisation, with access tokens and resume, but without the database status
+// of the local pollers. Edges need neither, they get every frame of the publisher as is.
+//
+// Before any frame is sent, the publisher and the edge prove to each other that they know the shared secret. Each
+// side sends a random challenge and answers the challenge of the other one with an hmac of it, so the secret never
+// crosses the network and recorded answers can not be replayed:
+//
+//	publisher -> edge: <publisher challenge>
+//	edge -> publisher: <hmac of "edge" and the publisher challenge> <edge challenge>
+//	publisher -> edge: <hmac of "publisher" and the edge challenge>
+
+const (
+	relayQueueSize        = 64 // frames an edge may fall behind before the publisher disconnects it
+	relayWriteTimeout     = 10 * time.Second
+	relayDialTimeout      = 5 * time.Second
+	relayHandshakeTimeout = 5 * time.Second
+	relayChallengeSize    = 32
+	relayHandshakeLineMax = 256 // bytes, longer handshake lines are rejected
+)
+
+var errRelayHandshake = errors.New("relay peer does not know the shared secret")
+
+func newRelayChallenge() (string, error) {
+	challenge := make([]byte, relayChallengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(challenge), nil
+}
+
+// relayProof is the answer of role to challenge. The role keeps an answer from being reflected to its sender.
+func relayProof(secret string, role string, challenge string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(role + ":" + challenge))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isRelayProof(secret string, role string, challenge string, proof string) bool {
+	return hmac.Equal([]byte(relayProof(secret, role, challenge)), []byte(proof))
+}
+
+// readHandshakeLine reads one line of at most relayHandshakeLineMax bytes
+func readHandshakeLine(reader *bufio.Reader) (string, error) {
+	line, err := reader.ReadSlice('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(line), "\n"), nil
+}
+
+/******************************************
+ ** relay publisher **
+ *****************************************/
+
+type relayPublisher struct {
+	localBroker
+	address  string
+	secret   string
+	lock     sync.Mutex
+	listener net.Listener
+	edges    map[*relayEdgeConnection]struct{}
+	closed   bool
+}
+
+type relayEdgeConnection struct {
+	conn      net.Conn
+	queue     chan []byte
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newRelayPublisher(config BrokerConfig) *relayPublisher {
+	return &relayPublisher{address: config.Address, secret: config.Secret, edges: make(map[*relayEdgeConnection]struct{})}
+}
+
+func (rp *relayPublisher) Start() error {
+	l, err := net.Listen("tcp", rp.address)
+	if err != nil {
+		return err
+	}
+	rp.lock.Lock()
+	rp.listener = l
+	rp.lock.Unlock()
+	log.Info(fmt.Sprint("Relay publisher listening for edge instances on ", l.Addr(), "."), log.Websocket)
+	go rp.accept(l)
+	return nil
+}
+
+func (rp *relayPublisher) accept(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Error("Could not accept relay edge.", err, log.Websocket)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		// a slow handshake must not hold up the other edges
+		go rp.admitEdge(conn)
+	}
+}
+
+// admitEdge adds the connection to the edges that receive frames once it passed the handshake
+func (rp *relayPublisher) admitEdge(conn net.Conn) {
+	reader := bufio.NewReaderSize(conn, relayHandshakeLineMax)
+	if err := rp.handshake(conn, reader); err != nil {
+		log.Warn(fmt.Sprint("Rejecting relay edge ", conn.RemoteAddr(), ". Handshake failed. Error: ", err), log.Websocket)
+		conn.Close()
+		return
+	}
+
+	edge := &relayEdgeConnection{conn: conn, queue: make(chan []byte, relayQueueSize), done: make(chan struct{})}
+	rp.lock.Lock()
+	if rp.closed {
+		rp.lock.Unlock()
+		conn.Close()
+		return
+	}
+	rp.edges[edge] = struct{}{}
+	rp.lock.Unlock()
+	log.Info(fmt.Sprint("Relay edge ", conn.RemoteAddr(), " connected."), log.Websocket)
+
+	go rp.writeToEdge(edge)
+	go func() {
+		// edges send nothing after the handshake, reading only detects that they are gone
+		io.Copy(io.Discard, reader)
+		rp.removeEdge(edge)
+	}()
+}
+
+func (rp *relayPublisher) handshake(conn net.Conn, reader *bufio.Reader) error {
+	conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	challenge, err := newRelayChallenge()
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(conn, challenge+"\n"); err != nil {
+		return err
+	}
+	line, err := readHandshakeLine(reader)
+	if err != nil {
+		return err
+	}
+	proof, edgeChallenge, _ := strings.Cut(line, " ")
+	if !isRelayProof(rp.secret, "edge", challenge, proof) || len(edgeChallenge) == 0 {
+		return errRelayHandshake
+	}
+	_, err = io.WriteString(conn, relayProof(rp.secret, "publisher", edgeChallenge)+"\n")
+	return err
+}
+
+// Publish delivers to the local endpoint and queues the frame for every edge
+func (rp *relayPublisher) Publish(data EventData) error {
+	rp.deliver(data)
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	encoded = append(encoded, '\n')
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	for edge := range rp.edges {
+		select {
+		case edge.queue <- encoded:
+		default:
+			log.Warn(fmt.Sprint("Relay edge ", edge.conn.RemoteAddr(), " fell ", relayQueueSize, " frames behind. Disconnecting it."), log.Websocket)
+			rp.removeEdgeLocked(edge)
+		}
+	}
+	return nil
+}
+
+func (rp *relayPublisher) writeToEdge(edge *relayEdgeConnection) {
+	for {
+		select {
+		case <-edge.done:
+			return
+		case frame := <-edge.queue:
+			edge.conn.SetWriteDeadline(time.Now().Add(relayWriteTimeout))
+			if _, err := edge.conn.Write(frame); err != nil {
+				log.Warn(fmt.Sprint("Could not write frame to relay edge ", edge.conn.RemoteAddr(), ". Error: ", err), log.Websocket)
+				rp.removeEdge(edge)
+				return
+			}
+		}
+	}
+}
+
+func (rp *relayPublisher) removeEdge(edge *relayEdgeConnection) {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.removeEdgeLocked(edge)
+}
+
+// must be called with the lock held
+func (rp *relayPublisher) removeEdgeLocked(edge *relayEdgeConnection) {
+	if _, exists := rp.edges[edge]; exists {
+		log.Info(fmt.Sprint("Relay edge ", edge.conn.RemoteAddr(), " disconnected."), log.Websocket)
+		delete(rp.edges, edge)
+	}
+	edge.closeOnce.Do(func() {
+		close(edge.done)
+		edge.conn.Close()
+	})
+}
+
+func (rp *relayPublisher) edgeCount() int {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	return len(rp.edges)
+}
+
+func (rp *relayPublisher) Close() error {
+	rp.lock.Lock()
+	defer rp.lock.Unlock()
+	rp.closed = true
+	for edge := range rp.edges {
+		rp.removeEdgeLocked(edge)
+	}
+	if rp.listener == nil {
+		return nil
+	}
+	return rp.listener.Close()
+}
+
+/******************************************
+ ** relay edge **
+ *****************************************/
+
+// relayEdge receives the frames of the relay publisher and reconnects until it is closed
+type relayEdge struct {
+	localBroker
+	address           string
+	secret            string
+	reconnectInterval time.Duration
+	lock              sync.Mutex
+	conn              net.Conn
+	done              chan struct{}
+	closeOnce         sync.Once
+}
+
+func newRelayEdge(config BrokerConfig) *relayEdge {
+	return &relayEdge{
+		address:           config.Address,
+		secret:            config.Secret,
+		reconnectInterval: time.Duration(config.ReconnectInterval) * time.Millisecond,
+		done:              make(chan struct{}),
+	}
+}
+
+func (re *relayEdge) Publish(data EventData) error {
+	return errEdgeCannotPublish
+}
+
+func (re *relayEdge) Start() error {
+	go re.run()
+	return nil
+}
+
+func (re *relayEdge) run() {
+	for {
+		conn, err := net.DialTimeout("tcp", re.address, relayDialTimeout)
+		if err != nil {
+			log.Warn(fmt.Sprint("Could not connect to relay publisher ", re.address, ". Retrying in ", re.reconnectInterval, ". Error: ", err), log.Websocket)
+		} else if re.setConnection(conn) {
+			log.Info(fmt.Sprint("Connected to relay publisher ", re.address, "."), log.Websocket)
+			err = re.receive(conn)
+			if re.isClosed() {
+				return
+			}
+			log.Warn(fmt.Sprint("Lost connection to relay publisher ", re.address, ". Reconnecting in ", re.reconnectInterval, ". Error: ", err), log.Websocket)
+		}
+
+		select {
+		case <-re.done:
+			return
+		case <-time.After(re.reconnectInterval):
+		}
+	}
+}
+
+// setConnection returns false if the edge was closed while connecting
+func (re *relayEdge) setConnection(conn net.Conn) bool {
+	re.lock.Lock()
+	defer re.lock.Unlock()
+	if re.isClosed() {
+		conn.Close()
+		return false
+	}
+	re.conn = conn
+	return true
+}
+
+func (re *relayEdge) receive(conn net.Conn) error {
+	defer conn.Close()
+	reader := bufio.NewReaderSize(conn, relayHandshakeLineMax)
+	if err := re.handshake(conn, reader); err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(reader)
+	for {
+		var data EventData
+		if err := decoder.Decode(&data); err != nil {
+			return err
+		}
+		re.deliver(data)
+	}
+}
+
+func (re *relayEdge) handshake(conn net.Conn, reader *bufio.Reader) error {
+	conn.SetDeadline(time.Now().Add(relayHandshakeTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	publisherChallenge, err := readHandshakeLine(reader)
+	if err != nil {
+		return err
+	}
+	challenge, err := newRelayChallenge()
+	if err != nil {
+		return err
+	}
+	if _, err = io.WriteString(conn, relayProof(re.secret, "edge", publisherChallenge)+" "+challenge+"\n"); err != nil {
+		return err
+	}
+	proof, err := readHandshakeLine(reader)
+	if err != nil {
+		return err
+	}
+	if !isRelayProof(re.secret, "publisher", challenge, proof) {
+		return errRelayHandshake
+	}
+	return nil
+}
+
+func (re *relayEdge) isClosed() bool {
+	select {
+	case <-re.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (re *relayEdge) Close() error {
+	re.closeOnce.Do(func() {
+		re.lock.Lock()
+		defer re.lock.Unlock()
+		close(re.done)
+		if re.conn != nil {
+			re.conn.Close()
+		}
+	})
+	return nil
+}
@@ -0,0 +1,75 @@
+package websocket
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+// replayBuffer keeps the frames that were broadcast within the replay duration, so newly connected clients do not
+// have to wait for the next service tick and reconnecting clients can resume where they stopped.
+type replayBuffer struct {
+	duration time.Duration
+	lock     sync.Mutex
+	frames   []replayFrame
+}
+
+type replayFrame struct {
+	sentAt time.Time
+	data   EventData
+}
+
+func newReplayBuffer(durationSeconds int) *replayBuffer {
+	return &replayBuffer{duration: time.Duration(durationSeconds) * time.Second}
+}
+
+func (rb *replayBuffer) isEnabled() bool {
+	return rb != nil && rb.duration > 0
+}
+
+func (rb *replayBuffer) add(data EventData) {
+	if !rb.isEnabled() {
+		return
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	now := time.Now()
+	rb.frames = append(rb.frames, replayFrame{sentAt: now, data: data})
+	rb.trim(now)
+}
+
+// since returns the buffered frames with a FromTimepoint after the given unix milliseconds. A timepoint of 0 returns
+// the whole backlog.
+func (rb *replayBuffer) since(fromTimepointMs int64) (frames []EventData) {
+	if !rb.isEnabled() {
+		return
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.trim(time.Now())
+	for _, frame := range rb.frames {
+		if frame.data.EventInfo.FromTimepoint > fromTimepointMs {
+			frames = append(frames, frame.data)
+		}
+	}
+	return
+}
+
+func (rb *replayBuffer) trim(now time.Time) {
+	expired := 0
+	for expired < len(rb.frames) && now.Sub(rb.frames[expired].sentAt) > rb.duration {
+		expired++
+	}
+	if expired > 0 {
+		// copy, so the backing array does not keep growing
+		rb.frames = append([]replayFrame(nil), rb.frames[expired:]...)
+	}
+}
+
+// resumeTimepoint reads the 'resume' query parameter. Clients pass the FromTimepoint of the last frame they received.
+func resumeTimepoint(query string) (fromTimepointMs int64, err error) {
+	if len(query) == 0 {
+		return 0, nil
+	}
+	return strconv.ParseInt(query, 10, 64)
+}
@@ -0,0 +1,54 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReplayBufferSince(t *testing.T) {
+	rb := newReplayBuffer(60)
+	rb.add(EventData{EventInfo: EventInfo{FromTimepoint: 1000}})
+	rb.add(EventData{EventInfo: EventInfo{FromTimepoint: 2000}})
+	rb.add(EventData{EventInfo: EventInfo{FromTimepoint: 3000}})
+
+	if frames := rb.since(0); len(frames) != 3 {
+		t.Errorf("Whole backlog. Expected: %v, Got: %v", 3, len(frames))
+	}
+	frames := rb.since(2000)
+	if len(frames) != 1 || frames[0].EventInfo.FromTimepoint != 3000 {
+		t.Errorf("Backlog after resume timepoint. Expected: %v, Got: %v", "[3000]", frames)
+	}
+}
+
+func TestReplayBufferExpires(t *testing.T) {
+	rb := newReplayBuffer(60)
+	rb.frames = append(rb.frames, replayFrame{sentAt: time.Now().Add(-2 * time.Minute), data: EventData{EventInfo: EventInfo{FromTimepoint: 1000}}})
+	rb.add(EventData{EventInfo: EventInfo{FromTimepoint: 2000}})
+
+	frames := rb.since(0)
+	if len(frames) != 1 || frames[0].EventInfo.FromTimepoint != 2000 {
+		t.Errorf("Expired frames should be dropped. Got: %v", frames)
+	}
+
+	disabled := newReplayBuffer(0)
+	disabled.add(EventData{})
+	if frames = disabled.since(0); len(frames) != 0 {
+		t.Errorf("Disabled replay should not keep frames. Got: %v", frames)
+	}
+}
+
+func TestReplayOnConnect(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/minerva", MaxConnections: 10, ReplayDuration: 60})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva", FromTimepoint: 1000}})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva", FromTimepoint: 2000}})
+
+	conn := dialTestEndpoint(t, server, "/minerva?resume=1000")
+	var received EventData
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read backlog. Error: %v", err)
+	}
+	if received.EventInfo.FromTimepoint != 2000 {
+		t.Errorf("Resumed backlog. Expected: %v, Got: %v", 2000, received.EventInfo.FromTimepoint)
+	}
+}
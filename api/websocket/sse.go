@@ -0,0 +1,186 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// sseEndpoint serves the same frames as the websocket endpoint as server-sent events, for clients behind proxies that
+// block websocket upgrades. Server-sent events are one way, so the subscription is chosen with the 'services' and
+// 'events' query parameters instead of control messages. Every event carries its FromTimepoint as id, browsers send
+// it back as Last-Event-ID header when they reconnect.
+func (wsc *Websocket) sseEndpoint(w http.ResponseWriter, r *http.Request) {
+	ip := wsc.clientIp(r)
+	access, rejected := wsc.admit(r, ip)
+	if rejected != nil {
+		rejected.write(w)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		log.Error("Could not start server-sent events.", errors.New("response does not implement http.Flusher"), log.Websocket)
+		wsc.releaseSlot(ip)
+		http.Error(w, "Streaming not supported.", http.StatusInternalServerError)
+		return
+	}
+
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if len(lastEventId) == 0 {
+		lastEventId = r.URL.Query().Get("resume")
+	}
+	resumeFrom, err := resumeTimepoint(lastEventId)
+	if err != nil {
+		log.Warn(fmt.Sprint("Invalid last event id ", lastEventId, ". Sending the whole backlog."), log.Websocket)
+	}
+
+	s, err := newSubscription(queryList(r, "services"), queryList(r, "events"))
+	if err == nil {
+		err = checkScope(access, queryList(r, "services"))
+	}
+	if err != nil {
+		wsc.releaseSlot(ip)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// events are text, so cbor is not available
+	p, _ := negotiateProtocol(r)
+	if p == protocolV2Cbor {
+		p = protocolV2
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	// keeps nginx from buffering the stream
+	header.Set("X-Accel-Buffering", "no")
+	if origin := r.Header.Get("Origin"); len(origin) > 0 {
+		// the origin was already checked while admitting the request
+		header.Set("Access-Control-Allow-Origin", origin)
+		header.Add("Vary", "Origin")
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	stats := &compressionStats{}
+	st := newSSETransport(w, flusher, http.NewResponseController(w), stats, wsc.config)
+	conn := wsc.register(st, r.RemoteAddr, stats, access, ip, p, s, resumeFrom)
+	if conn == nil {
+		wsc.goAway(st)
+		return
+	}
+
+	go func() {
+		select {
+		case <-r.Context().Done():
+			log.Info(fmt.Sprint("Server-sent events client ", conn, " disconnected."), log.Websocket)
+			wsc.removeConnection(conn)
+		case <-conn.done:
+		}
+	}()
+	// the response can only be written while the handler runs
+	conn.writer(func(err error) {
+		log.Error(fmt.Sprint("Could not write event to server-sent events client ", conn), err, log.Websocket)
+	})
+	wsc.removeConnection(conn)
+}
+
+// queryList reads query parameters like "services=keeper,minerva" or "services=keeper&services=minerva"
+func queryList(r *http.Request, name string) (items []string) {
+	for _, value := range r.URL.Query()[name] {
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); len(item) > 0 {
+				items = append(items, item)
+			}
+		}
+	}
+	return
+}
+
+// sseTransport writes events to a streamed http response. The writer goroutine and closeNormally may write at the
+// same time, so writes are locked.
+type sseTransport struct {
+	w            http.ResponseWriter
+	flusher      http.Flusher
+	controller   *http.ResponseController
+	stats        *compressionStats
+	writeTimeout time.Duration
+	lock         sync.Mutex
+	closed       bool
+}
+
+func newSSETransport(w http.ResponseWriter, flusher http.Flusher, controller *http.ResponseController, stats *compressionStats, config Config) *sseTransport {
+	return &sseTransport{
+		w:            w,
+		flusher:      flusher,
+		controller:   controller,
+		stats:        stats,
+		writeTimeout: time.Duration(config.WriteTimeout) * time.Millisecond,
+	}
+}
+
+func (st *sseTransport) write(message outboundMessage) error {
+	var event bytes.Buffer
+	if message.eventId > 0 {
+		event.WriteString(fmt.Sprint("id: ", message.eventId, "\n"))
+	} else {
+		// control messages do not reach the onmessage handler of event sources
+		event.WriteString("event: control\n")
+	}
+	if message.reconnectDelay > 0 {
+		event.WriteString(fmt.Sprint("retry: ", message.reconnectDelay, "\n"))
+	}
+	for _, line := range bytes.Split(message.data, []byte("\n")) {
+		event.WriteString("data: ")
+		event.Write(line)
+		event.WriteString("\n")
+	}
+	event.WriteString("\n")
+	return st.writeEvent(event.Bytes())
+}
+
+// heartbeat writes a comment, which keeps proxies from closing the idle stream and fails if the client is gone
+func (st *sseTransport) heartbeat() error {
+	return st.writeEvent([]byte(": ping\n\n"))
+}
+
+func (st *sseTransport) closeNormally(reason string) error {
+	return st.writeEvent([]byte(fmt.Sprint("event: close\ndata: ", reason, "\n\n")))
+}
+
+// close only stops further writes, the response ends when the handler returns
+func (st *sseTransport) close() error {
+	st.lock.Lock()
+	st.closed = true
+	st.lock.Unlock()
+	return nil
+}
+
+func (st *sseTransport) writeEvent(event []byte) error {
+	st.lock.Lock()
+	defer st.lock.Unlock()
+	if st.closed {
+		return errors.New("server-sent events stream is closed")
+	}
+	if st.writeTimeout > 0 {
+		// not every response writer supports deadlines, the stream still works without
+		if err := st.controller.SetWriteDeadline(time.Now().Add(st.writeTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+	}
+	n, err := st.w.Write(event)
+	atomic.AddInt64(&st.stats.wireBytes, int64(n))
+	if err != nil {
+		return err
+	}
+	st.flusher.Flush()
+	return nil
+}
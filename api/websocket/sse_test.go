@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readEvent reads one server-sent event and skips heartbeat comments
+func readEvent(t *testing.T, reader *bufio.Reader) (id string, data string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Could not read server-sent event. Error: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			return
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			data += strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func openEventStream(t *testing.T, server *httptest.Server, path string, lastEventId string) *bufio.Reader {
+	request, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatalf("Could not create request. Error: %v", err)
+	}
+	if len(lastEventId) > 0 {
+		request.Header.Set("Last-Event-ID", lastEventId)
+	}
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Could not open event stream %v. Error: %v", path, err)
+	}
+	t.Cleanup(func() { response.Body.Close() })
+	if contentType := response.Header.Get("Content-Type"); contentType != "text/event-stream" {
+		t.Fatalf("Content type. Expected: %v, Got: %v", "text/event-stream", contentType)
+	}
+	return bufio.NewReader(response.Body)
+}
+
+func TestSSEBroadcast(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", SSEPath: "/keeper/events", MaxConnections: 10})
+
+	reader := openEventStream(t, server, "/keeper/events", "")
+	dialTestEndpoint(t, server, "/keeper")
+	// both transports count as active connections
+	waitForConnections(t, wsc, 2)
+
+	wsc.SendDataInBulk(EventData{Data: "{}", EventInfo: EventInfo{Service: "keeper", FromTimepoint: 1000}})
+	id, data := readEvent(t, reader)
+	if id != "1000" {
+		t.Errorf("Event id. Expected: %v, Got: %v", "1000", id)
+	}
+	var received EventData
+	if err := json.Unmarshal([]byte(data), &received); err != nil {
+		t.Fatalf("Could not decode event. Error: %v", err)
+	}
+	if received.EventInfo.Service != "keeper" {
+		t.Errorf("Event service. Expected: %v, Got: %v", "keeper", received.EventInfo.Service)
+	}
+}
+
+func TestSSEResumeFromLastEventId(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/minerva", SSEPath: "/minerva/events", MaxConnections: 10, ReplayDuration: 60})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva", FromTimepoint: 1000}})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva", FromTimepoint: 2000}})
+
+	reader := openEventStream(t, server, "/minerva/events", "1000")
+	if id, _ := readEvent(t, reader); id != "2000" {
+		t.Errorf("Resumed event id. Expected: %v, Got: %v", "2000", id)
+	}
+}
+
+func TestSSEDisconnectRemovesConnection(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/bloxberg", SSEPath: "/bloxberg/events", MaxConnections: 10})
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL+"/bloxberg/events", nil)
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Could not open event stream. Error: %v", err)
+	}
+	waitForConnections(t, wsc, 1)
+	response.Body.Close()
+	waitForConnections(t, wsc, 0)
+}
+
+func TestSSERejectsUnknownEvents(t *testing.T) {
+	_, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", SSEPath: "/keeper/events", MaxConnections: 10})
+
+	client := http.Client{Timeout: 2 * time.Second}
+	response, err := client.Get(server.URL + "/keeper/events?services=keeper&events=Unknown")
+	if err != nil {
+		t.Fatalf("Could not request event stream. Error: %v", err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Status code. Expected: %v, Got: %v", http.StatusBadRequest, response.StatusCode)
+	}
+}
+
+func TestSSEBacklogFollowsSubscription(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", SSEPath: "/keeper/events", MaxConnections: 10, ReplayDuration: 60})
+	wsc.SendDataInBulk(EventData{Data: `{"Messages": []}`, EventInfo: EventInfo{Service: "minerva", FromTimepoint: 1000}})
+	wsc.SendDataInBulk(EventData{Data: `{"Renames": [], "Shares": []}`, EventInfo: EventInfo{Service: "keeper", FromTimepoint: 2000}})
+
+	reader := openEventStream(t, server, "/keeper/events?services=keeper&events=Shares", "")
+	id, data := readEvent(t, reader)
+	if id != "2000" {
+		t.Fatalf("First backlog event id. Expected: %v, Got: %v", "2000", id)
+	}
+	var received EventData
+	if err := json.Unmarshal([]byte(data), &received); err != nil {
+		t.Fatalf("Could not decode event. Error: %v", err)
+	}
+	if received.Data != `{"Renames":null,"Shares":[]}` {
+		t.Errorf("Backlog event data. Expected: %v, Got: %v", `{"Renames":null,"Shares":[]}`, received.Data)
+	}
+}
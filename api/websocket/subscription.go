@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Event kinds are the top level fields of the service data. Services that are not listed accept any event kind.
+var eventKinds = map[string][]string{
+	"keeper":   {"FileCreationsAndEditings", "LibraryCreations", "ActivatedUsers", "FileDeletions", "Renames", "Shares", "FileDownloads"},
+	"minerva":  {"Messages"},
+	"bloxberg": {"Blocks", "ConfirmedTransactions", "LicensedContributors"},
+}
+
+// subscription limits which frames and event kinds a connection receives. Empty sets mean everything.
+type subscription struct {
+	services map[string]struct{}
+	events   map[string]struct{}
+}
+
+func newSubscription(services []string, events []string) (s subscription, err error) {
+	for _, event := range events {
+		if !isKnownEventKind(services, event) {
+			err = errors.New(fmt.Sprint("unknown event kind ", event))
+			return
+		}
+	}
+	s.services = toSet(services)
+	s.events = toSet(events)
+	return
+}
+
+func isKnownEventKind(services []string, event string) bool {
+	if len(services) == 0 {
+		for service := range eventKinds {
+			services = append(services, service)
+		}
+	}
+	for _, service := range services {
+		kinds, exists := eventKinds[service]
+		if !exists {
+			return true
+		}
+		for _, kind := range kinds {
+			if kind == event {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func toSet(items []string) map[string]struct{} {
+	if len(items) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		set[item] = struct{}{}
+	}
+	return set
+}
+
+func (s subscription) isEverything() bool {
+	return len(s.services) == 0 && len(s.events) == 0
+}
+
+func (s subscription) wantsService(service string) bool {
+	if len(s.services) == 0 {
+		return true
+	}
+	_, exists := s.services[service]
+	return exists
+}
+
+// key identifies equal subscriptions, so a frame is filtered only once per distinct subscription
+func (s subscription) key() string {
+	return setToString(s.services) + "|" + setToString(s.events)
+}
+
+func setToString(set map[string]struct{}) string {
+	items := make([]string, 0, len(set))
+	for item := range set {
+		items = append(items, item)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// filter removes the event kinds that are not subscribed from the service data. Removed kinds are sent as null,
+// the same way as a service sends an event kind without events.
+func (s subscription) filter(data EventData) (EventData, error) {
+	if len(s.events) == 0 || len(data.Data) == 0 {
+		return data, nil
+	}
+
+	var serviceData map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data.Data), &serviceData); err != nil {
+		return data, err
+	}
+	for kind := range serviceData {
+		if _, exists := s.events[kind]; !exists {
+			serviceData[kind] = json.RawMessage("null")
+		}
+	}
+	filteredData, err := json.Marshal(serviceData)
+	if err != nil {
+		return data, err
+	}
+	data.Data = string(filteredData)
+	return data, nil
+}
+
+/******************************************
+ ** control protocol **
+ *****************************************/
+
+const (
+	ControlSubscribe   = "subscribe"   // client to server, replaces the subscription of the connection
+	ControlUnsubscribe = "unsubscribe" // client to server, resets the subscription to everything
+	ControlSubscribed  = "subscribed"  // server to client, acknowledges the current subscription
+	ControlError       = "error"       // server to client, the control message could not be processed
+	ControlGoingAway   = "goingAway"   // server to client, the server shuts down, reconnect after RetryAfter
+)
+
+// ControlMessage is sent by clients to change their subscription and answered by the server. It can be told apart
+// from event frames by the Control field.
+type ControlMessage struct {
+	Control    string   `json:"Control"`
+	Services   []string `json:"Services,omitempty"`
+	Events     []string `json:"Events,omitempty"`
+	Error      string   `json:"Error,omitempty"`
+	RetryAfter int64    `json:"RetryAfter,omitempty"` // milliseconds, includes a random jitter per client
+}
+
+func (wsc *Websocket) handleControlMessage(conn *connection, message []byte) ControlMessage {
+	var request ControlMessage
+	if err := json.Unmarshal(message, &request); err != nil {
+		return ControlMessage{Control: ControlError, Error: "message is not a valid control message"}
+	}
+
+	switch request.Control {
+	case ControlSubscribe:
+		s, err := newSubscription(request.Services, request.Events)
+		if err == nil {
+			err = checkScope(conn.access, request.Services)
+		}
+		if err != nil {
+			return ControlMessage{Control: ControlError, Error: err.Error()}
+		}
+		conn.setSubscription(s)
+		return ControlMessage{Control: ControlSubscribed, Services: request.Services, Events: request.Events}
+	case ControlUnsubscribe:
+		conn.setSubscription(subscription{})
+		return ControlMessage{Control: ControlSubscribed}
+	}
+	return ControlMessage{Control: ControlError, Error: fmt.Sprint("unknown control ", request.Control)}
+}
+
+// checkScope rejects subscriptions to services the access token does not allow
+func checkScope(access *accessToken, services []string) error {
+	for _, service := range services {
+		if !access.allowsService(service) {
+			return errors.New(fmt.Sprint("service ", service, " is not in the scope of the access token"))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSubscriptionFilter(t *testing.T) {
+	keeperData, _ := json.Marshal(KeeperData{
+		FileCreationsAndEditings: []KeeperFileCreationAndEditing{{OperationType: "create"}},
+		LibraryCreations:         []KeeperLibraryCreation{{InstituteName: "ABC1 Institute"}},
+		ActivatedUsers:           []KeeperActivatedUser{{InstituteName: "ABC2 Institute"}},
+	})
+	data := EventData{Data: string(keeperData), EventInfo: EventInfo{Service: "keeper"}}
+
+	s, err := newSubscription([]string{"keeper"}, []string{"LibraryCreations"})
+	if err != nil {
+		t.Fatalf("Subscription should be valid. Error: %v", err)
+	}
+	filtered, err := s.filter(data)
+	if err != nil {
+		t.Fatalf("Could not filter data. Error: %v", err)
+	}
+
+	var filteredData KeeperData
+	json.Unmarshal([]byte(filtered.Data), &filteredData)
+	if len(filteredData.LibraryCreations) != 1 {
+		t.Errorf("Subscribed library creations. Expected: %v, Got: %v", 1, len(filteredData.LibraryCreations))
+	}
+	if len(filteredData.FileCreationsAndEditings) != 0 || len(filteredData.ActivatedUsers) != 0 {
+		t.Errorf("Not subscribed event kinds should be removed. Got: %v", filtered.Data)
+	}
+	if !s.wantsService("keeper") || s.wantsService("bloxberg") {
+		t.Errorf("Subscription should only want keeper.")
+	}
+}
+
+func TestSubscriptionValidation(t *testing.T) {
+	subscriptions := []struct {
+		services    []string
+		events      []string
+		shouldExist bool
+	}{
+		{nil, nil, true},
+		{[]string{"bloxberg"}, []string{"Blocks"}, true},
+		{nil, []string{"Messages"}, true},
+		{[]string{"bloxberg"}, []string{"Messages"}, false},
+		{nil, []string{"Unknown"}, false},
+		{[]string{"other"}, []string{"Anything"}, true},
+	}
+	for _, subscriptionTest := range subscriptions {
+		_, err := newSubscription(subscriptionTest.services, subscriptionTest.events)
+		if (err == nil) != subscriptionTest.shouldExist {
+			t.Errorf("Check subscription %v %v. Expected valid: %v, Got error: %v", subscriptionTest.services, subscriptionTest.events, subscriptionTest.shouldExist, err)
+		}
+	}
+}
+
+func TestSubscribeOverConnection(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/bloxberg", MaxConnections: 10})
+	conn := dialTestEndpoint(t, server, "/bloxberg")
+	waitForConnections(t, wsc, 1)
+
+	conn.WriteJSON(ControlMessage{Control: ControlSubscribe, Services: []string{"keeper"}})
+	var answer ControlMessage
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(&answer); err != nil || answer.Control != ControlSubscribed {
+		t.Fatalf("Subscription should be acknowledged. Got: %v, Error: %v", answer, err)
+	}
+
+	// bloxberg frames are not subscribed and must not arrive, keeper frames must arrive
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "bloxberg"}})
+	wsc.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "keeper"}})
+	var received EventData
+	if err := conn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read broadcast. Error: %v", err)
+	}
+	if received.EventInfo.Service != "keeper" {
+		t.Errorf("Broadcast service. Expected: %v, Got: %v", "keeper", received.EventInfo.Service)
+	}
+}
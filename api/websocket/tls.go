@@ -0,0 +1,126 @@
+package websocket
+
+import (
+	"api/utils/log"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// how often the certificate files are checked for changes at most
+const certificateCheckInterval = time.Second
+
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	minVersion, err := config.tlsMinVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	reloader := &certificateReloader{certFile: config.CertFile, keyFile: config.KeyFile}
+	if err = reloader.load(); err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if len(config.ClientCAFile) > 0 {
+		caPem, readErr := os.ReadFile(config.ClientCAFile)
+		if readErr != nil {
+			return nil, readErr
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caPem) {
+			return nil, errors.New(fmt.Sprint("no certificate found in client CA file ", config.ClientCAFile))
+		}
+		tlsConfig.ClientCAs = clientCAs
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func (c TLSConfig) tlsMinVersion() (uint16, error) {
+	switch c.MinVersion {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, errors.New(fmt.Sprint("unsupported minimum tls version ", c.MinVersion))
+}
+
+// certificateReloader serves the certificate for new tls handshakes and reloads it when the certificate or key
+// file changed on disk, so renewed certificates are picked up without a restart.
+type certificateReloader struct {
+	certFile    string
+	keyFile     string
+	lock        sync.RWMutex
+	certificate *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+func (cr *certificateReloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.reloadIfChanged()
+	cr.lock.RLock()
+	defer cr.lock.RUnlock()
+	return cr.certificate, nil
+}
+
+func (cr *certificateReloader) load() error {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		return err
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		return err
+	}
+
+	cr.lock.Lock()
+	cr.certificate = &certificate
+	cr.certModTime = certInfo.ModTime()
+	cr.keyModTime = keyInfo.ModTime()
+	cr.lastCheck = time.Now()
+	cr.lock.Unlock()
+	return nil
+}
+
+func (cr *certificateReloader) reloadIfChanged() {
+	cr.lock.Lock()
+	if time.Since(cr.lastCheck) < certificateCheckInterval {
+		cr.lock.Unlock()
+		return
+	}
+	cr.lastCheck = time.Now()
+	certModTime, keyModTime := cr.certModTime, cr.keyModTime
+	cr.lock.Unlock()
+
+	certInfo, certErr := os.Stat(cr.certFile)
+	keyInfo, keyErr := os.Stat(cr.keyFile)
+	if certErr != nil || keyErr != nil {
+		log.Warn(fmt.Sprint("Could not check tls certificate files for changes. Keeping the loaded certificate. Errors: ", certErr, ", ", keyErr), log.Websocket)
+		return
+	}
+	if certInfo.ModTime().Equal(certModTime) && keyInfo.ModTime().Equal(keyModTime) {
+		return
+	}
+
+	log.Info(fmt.Sprint("Tls certificate ", cr.certFile, " changed on disk. Reloading it."), log.Websocket)
+	if err := cr.load(); err != nil {
+		// certificate and key are usually not replaced at the exact same moment, try again on the next check
+		log.Error("Could not reload tls certificate. Keeping the loaded certificate.", err, log.Websocket)
+	}
+}
@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCertificate(t *testing.T, certFile string, keyFile string, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Could not generate key. Error: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	certDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Could not create certificate. Error: %v", err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Could not marshal key. Error: %v", err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer}), 0600); err != nil {
+		t.Fatalf("Could not write certificate. Error: %v", err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("Could not write key. Error: %v", err)
+	}
+}
+
+func certificateCommonName(t *testing.T, reloader *certificateReloader) string {
+	certificate, _ := reloader.GetCertificate(nil)
+	parsed, err := x509.ParseCertificate(certificate.Certificate[0])
+	if err != nil {
+		t.Fatalf("Could not parse served certificate. Error: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertificateReloadOnChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCertificate(t, certFile, keyFile, "first")
+
+	reloader := &certificateReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		t.Fatalf("Could not load certificate. Error: %v", err)
+	}
+	if name := certificateCommonName(t, reloader); name != "first" {
+		t.Errorf("Served certificate. Expected: %v, Got: %v", "first", name)
+	}
+
+	writeTestCertificate(t, certFile, keyFile, "second")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	reloader.lastCheck = time.Time{}
+
+	if name := certificateCommonName(t, reloader); name != "second" {
+		t.Errorf("Served certificate after change. Expected: %v, Got: %v", "second", name)
+	}
+}
+
+func TestTLSMinVersion(t *testing.T) {
+	versions := []struct {
+		minVersion  string
+		shouldExist bool
+	}{
+		{"", true},
+		{"1.2", true},
+		{"1.3", true},
+		{"1.0", false},
+	}
+	for _, versionTest := range versions {
+		_, err := TLSConfig{MinVersion: versionTest.minVersion}.tlsMinVersion()
+		if (err == nil) != versionTest.shouldExist {
+			t.Errorf("Check tls min version %v. Expected supported: %v, Got error: %v", versionTest.minVersion, versionTest.shouldExist, err)
+		}
+	}
+}
@@ -2,26 +2,36 @@ package websocket
 
 import (
 	"api/utils/log"
-	"api/utils/mail"
-	"context"
-	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// Websocket serves one endpoint path. Every service has its own instance, so connections, connection limits and
+// broadcasts are never shared between services.
 type Websocket struct {
-	wsConnections             map[string]*websocket.Conn
-	server                    *http.Server
+	wsConnections             map[string]*connection // by connection id
+	listener                  *listener
+	replay                    *replayBuffer
+	broker                    Broker
 	config                    Config
-	serverShuttingDown        bool
+	serverShuttingDown        atomic.Bool
 	initialisedAndStartedOnce bool
 	initLock                  sync.Mutex
 	sendLock                  sync.Mutex
+	connectionsLock           sync.RWMutex
 	errorChannel              chan error
+	slowConsumerDrops         int64
+	connectionsPerIp          map[string]int // includes pending upgrades
+	pendingUpgrades           int
+	upgradeLimiter            *rateLimiter
+	trustedProxies            []*net.IPNet
+	extraHandlers             map[string]http.HandlerFunc // by path, served on the listener of the endpoint
 }
 
 type WebsocketInterface interface {
@@ -32,6 +42,23 @@ type WebsocketInterface interface {
 	GetActiveConnections() int
 }
 
+// HandlerRegistrar is implemented by websockets that can serve further http handlers of their service, e.g. the POST
+// endpoint of a webhook service, on the listener of their endpoint
+type HandlerRegistrar interface {
+	HandleFunc(path string, handler http.HandlerFunc)
+}
+
+// HandleFunc serves the handler on the listener of the endpoint. It has to be called before InitAndStartOnce. Like the
+// endpoint, the handler can not be unregistered, it has to reject requests itself once its service is stopped.
+func (wsc *Websocket) HandleFunc(path string, handler http.HandlerFunc) {
+	wsc.initLock.Lock()
+	defer wsc.initLock.Unlock()
+	if wsc.extraHandlers == nil {
+		wsc.extraHandlers = make(map[string]http.HandlerFunc)
+	}
+	wsc.extraHandlers[path] = handler
+}
+
 func (wsc *Websocket) InitAndStartOnce(config Config) {
 	wsc.initLock.Lock()
 	if !wsc.initialisedAndStartedOnce {
@@ -44,142 +71,324 @@ func (wsc *Websocket) InitAndStartOnce(config Config) {
 
 func (wsc *Websocket) GetErrorChannel() *chan error {
 	if wsc.errorChannel == nil {
-		wsc.errorChannel = make(chan error)
+		wsc.errorChannel = make(chan error, 1)
 	}
 	return &wsc.errorChannel
 }
 
+// SendDataInBulk publishes the frame to the broker, which delivers it to this endpoint and, depending on the broker,
+// to the endpoints of other instances
 func (wsc *Websocket) SendDataInBulk(data EventData) {
+	if err := wsc.broker.Publish(data); err != nil {
+		log.Error(fmt.Sprint("Could not publish data of ", data.EventInfo.Service, "."), err, log.Websocket)
+	}
+}
+
+// deliver is called by the broker for every published frame
+func (wsc *Websocket) deliver(data EventData) {
+	if wsc.config.Broker.IsEdge() {
+		// the frames carry the connections of the publisher, every instance reports its own clients
+		data.EventInfo.ActiveConnections = wsc.GetActiveConnections()
+	}
+	wsc.broadcast(data)
+}
+
+func (wsc *Websocket) broadcast(data EventData) {
 	wsc.sendLock.Lock()
+	defer wsc.sendLock.Unlock()
+	if wsc.serverShuttingDown.Load() {
+		return
+	}
 
-	if len(wsc.wsConnections) == 0 {
-		log.Warn("There is no active websocket connection yet.", log.Websocket)
-		wsc.sendLock.Unlock()
+	wsc.replay.add(data)
+
+	wsConnections := wsc.connections()
+	if len(wsConnections) == 0 {
+		log.Warn(fmt.Sprint("There is no active websocket connection on ", wsc.config.EndpointPath, " yet."), log.Websocket)
 		return
 	}
+	now := time.Now()
 
-	for remoteAddr, wsConnection := range wsc.wsConnections {
-		err := wsConnection.WriteJSON(data)
-		if err != nil {
-			e := wsConnection.Close()
-			if e != nil {
-				log.Error("Could not close websocket connection.", e, log.Websocket)
+	// connections with the same subscription and protocol get the same encoded frame
+	encodedFrames := make(map[string]outboundMessage)
+	for _, wsConnection := range wsConnections {
+		if wsConnection.access.isExpired(now) {
+			log.Info(fmt.Sprint("Access token of remote websocket ", wsConnection, " expired. Closing connection."), log.Websocket)
+			if err := wsConnection.transport.closeNormally("Access token expired."); err != nil {
+				log.Debug(fmt.Sprint("Could not send close message. Error: ", err), log.Websocket)
 			}
-			log.Info(fmt.Sprint("Will delete websocket connection: ", remoteAddr), log.Websocket)
-			delete(wsc.wsConnections, remoteAddr)
-			log.Error(fmt.Sprint("Could not write JSON data to remote websocket ", remoteAddr), err, log.Websocket)
+			wsc.removeConnection(wsConnection)
+			continue
+		}
+		s := wsConnection.getSubscription()
+		if !s.wantsService(data.EventInfo.Service) || !wsConnection.access.allowsService(data.EventInfo.Service) {
+			continue
+		}
+		frameKey := fmt.Sprint(wsConnection.protocol, "|", s.key())
+		message, encoded := encodedFrames[frameKey]
+		if !encoded {
+			frame, filterErr := s.filter(data)
+			if filterErr != nil {
+				log.Error(fmt.Sprint("Could not filter data for remote websocket ", wsConnection, ". Sending unfiltered data."), filterErr, log.Websocket)
+			}
+			var encodeErr error
+			message, encodeErr = encodeEventData(frame, wsConnection.protocol)
+			if encodeErr != nil {
+				log.Error(fmt.Sprint("Could not encode data as ", wsConnection.protocol, "."), encodeErr, log.Websocket)
+				continue
+			}
+			encodedFrames[frameKey] = message
+		}
+
+		if !wsConnection.enqueue(message) {
+			drops := atomic.AddInt64(&wsc.slowConsumerDrops, 1)
+			log.Warn(fmt.Sprint("Remote websocket ", wsConnection, " fell ", wsc.config.MaxQueuedFrames,
+				" frames behind. Dropping slow client (", drops, " slow clients dropped on ", wsc.config.EndpointPath, " so far)."), log.Websocket)
+			wsc.removeConnection(wsConnection)
 		}
 	}
+}
 
-	wsc.sendLock.Unlock()
+// GetSlowConsumerDrops returns how many clients were dropped because they could not keep up with the broadcast
+func (wsc *Websocket) GetSlowConsumerDrops() int64 {
+	return atomic.LoadInt64(&wsc.slowConsumerDrops)
 }
 
 func (wsc *Websocket) init(config Config) {
 	wsc.config = config
 	if wsc.errorChannel == nil {
-		wsc.errorChannel = make(chan error)
+		wsc.errorChannel = make(chan error, 1)
 	}
-	wsc.wsConnections = make(map[string]*websocket.Conn)
-	wsc.serverShuttingDown = false
-
-	wsc.server = &http.Server{Addr: fmt.Sprintf(":%d", 8080), Handler: nil}
-
-	// setup endpoint route
-	http.HandleFunc(wsc.config.EndpointPath, wsc.wsEndpoint)
+	wsc.wsConnections = make(map[string]*connection)
+	wsc.connectionsPerIp = make(map[string]int)
+	wsc.pendingUpgrades = 0
+	wsc.upgradeLimiter = newRateLimiter(config.UpgradesPerMinute, config.UpgradeBurst)
+	wsc.trustedProxies = parseTrustedProxies(config.TrustedProxies)
+	if !wsc.config.Compression.isValidLevel() {
+		log.Warn(fmt.Sprint("Invalid compression level ", wsc.config.Compression.Level, ". Using the default level."), log.Websocket)
+		wsc.config.Compression.Level = 0
+	}
+	wsc.replay = newReplayBuffer(config.ReplayDuration)
+	broker, err := NewBroker(config.Broker)
+	if err != nil {
+		log.Error("Invalid broker. Using the local broker.", err, log.Websocket)
+		broker = &localBroker{}
+	}
+	wsc.broker = broker
+	wsc.broker.Subscribe(wsc.deliver)
+	wsc.serverShuttingDown.Store(false)
 }
 
 func (wsc *Websocket) startWebsocket() {
-	wsc.serverShuttingDown = false
-	if wsc.server == nil {
-		err := errors.New("websocket server not initialised")
+	wsc.serverShuttingDown.Store(false)
+	log.Info(fmt.Sprint("Registering websocket endpoint ", wsc.config.EndpointPath, " on ", wsc.config.ListenAddress(), "."), log.Websocket)
+	l, err := registerEndpoint(wsc)
+	if err != nil {
 		log.Error("Can not start websocket.", err, log.Websocket)
-		wsc.errorChannel <- err
+		wsc.reportError(err)
+		return
+	}
+	wsc.listener = l
+
+	if err = wsc.broker.Start(); err != nil {
+		log.Error(fmt.Sprint("Can not start broker of ", wsc.config.EndpointPath, "."), err, log.Websocket)
+		wsc.reportError(err)
 	}
-	log.Info(fmt.Sprint("Starting websocket on port ", 8080, "."), log.Websocket)
-	go func() {
-		err := wsc.server.ListenAndServe()
-		if err != nil {
-			if wsc.serverShuttingDown {
-				log.Info(fmt.Sprint("Server shutting down. Error: ", err), log.Websocket)
-			} else {
-				logMessage := fmt.Sprint("Could not listen and serve websocket on port ", 8080, ".")
-				log.Error(logMessage, err, log.Websocket)
-				mail.SendErrorMail(logMessage, err)
-				wsc.errorChannel <- err
-			}
-		}
-	}()
 }
 
+// StopWebsocket drains the endpoint: new clients are rejected, connected clients are told when to reconnect and get
+// their queued frames before they are closed.
 func (wsc *Websocket) StopWebsocket() {
-	if wsc.serverShuttingDown {
+	wsc.sendLock.Lock()
+	if wsc.serverShuttingDown.Swap(true) {
+		wsc.sendLock.Unlock()
 		log.Info("Server is already shutting down or has finished shutdown.", log.Websocket)
 		return
 	}
+	log.Info(fmt.Sprint("Draining open connections and stopping websocket endpoint ", wsc.config.EndpointPath, "."), log.Websocket)
+	if err := wsc.broker.Close(); err != nil {
+		log.Error("Could not close broker.", err, log.Websocket)
+	}
+	// no broadcast can be queued behind the going away message
+	wsConnections := wsc.connections()
+	for _, wsConnection := range wsConnections {
+		wsc.sendGoingAway(wsConnection)
+	}
+	wsc.sendLock.Unlock()
 
-	log.Info("Closing open connections and stopping websocket server.", log.Websocket)
-	wsc.serverShuttingDown = true
-	for _, wsConnection := range wsc.wsConnections {
-		closeNormalClosure := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "Server shut down.")
-		if err := wsConnection.WriteControl(websocket.CloseMessage, closeNormalClosure, time.Now().Add(time.Second)); err != nil {
-			log.Error("Error while stopping websocket connections", err, log.Websocket)
+	wsc.waitForDrain(wsConnections, time.Duration(wsc.config.DrainTimeout)*time.Millisecond)
+	for _, wsConnection := range wsConnections {
+		if err := wsConnection.transport.closeNormally("Server shut down."); err != nil {
+			log.Debug(fmt.Sprint("Could not send close message to ", wsConnection, ". Error: ", err), log.Websocket)
 		}
-		wsConnection.Close()
+		wsc.removeConnection(wsConnection)
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
-	defer cancel()
-	err := wsc.server.Shutdown(ctx)
-	if err != nil {
-		log.Error("Could not stop websocket server", err, log.Websocket)
+	if wsc.listener != nil {
+		unregisterEndpoint(wsc)
+		wsc.listener = nil
 	}
 }
 
 func (wsc *Websocket) GetActiveConnections() int {
+	wsc.connectionsLock.RLock()
+	defer wsc.connectionsLock.RUnlock()
 	return len(wsc.wsConnections)
 }
 
 func (wsc *Websocket) wsEndpoint(w http.ResponseWriter, r *http.Request) {
-	if len(wsc.wsConnections) > wsc.config.MaxConnections {
-		log.Warn(fmt.Sprint("Max websocket connections of ", wsc.config.MaxConnections, " reached. Ignoring new connection."), log.Websocket)
+	ip := wsc.clientIp(r)
+	access, rejected := wsc.admit(r, ip)
+	if rejected != nil {
+		rejected.write(w)
 		return
 	}
 
+	resumeFrom, err := resumeTimepoint(r.URL.Query().Get("resume"))
+	if err != nil {
+		log.Warn(fmt.Sprint("Invalid resume timepoint ", r.URL.Query().Get("resume"), ". Sending the whole backlog."), log.Websocket)
+	}
+
 	var upgrader = websocket.Upgrader{
-		ReadBufferSize:  1024,
-		WriteBufferSize: 1024,
+		ReadBufferSize:    1024,
+		WriteBufferSize:   1024,
+		EnableCompression: wsc.config.Compression.Enabled,
 	}
 
+	// the origin was already checked while admitting the request
 	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
 
-	ws, err := upgrader.Upgrade(w, r, nil)
+	p, subprotocol := negotiateProtocol(r)
+	var responseHeader http.Header
+	if len(subprotocol) > 0 {
+		responseHeader = http.Header{"Sec-Websocket-Protocol": {subprotocol}}
+	}
+
+	stats := &compressionStats{}
+	ws, err := upgrader.Upgrade(countingResponseWriter{ResponseWriter: w, stats: stats}, r, responseHeader)
 	if err != nil {
 		log.Error("Could not upgrade http connection to websocket.", err, log.Websocket)
+		wsc.releaseSlot(ip)
+		return
 	}
 
-	wsc.wsConnections[ws.RemoteAddr().String()] = ws
+	wt := newWebsocketTransport(ws, wsc.config)
+	conn := wsc.register(wt, ws.RemoteAddr().String(), stats, access, ip, p, subscription{}, resumeFrom)
+	if conn == nil {
+		wsc.goAway(wt)
+		return
+	}
+	go conn.writer(func(err error) {
+		log.Error(fmt.Sprint("Could not write JSON data to remote websocket ", conn), err, log.Websocket)
+		wsc.removeConnection(conn)
+	})
+	wsc.reader(conn, wt)
+}
 
-	wsc.reader(ws)
+// register queues the frames of the subscription the client missed since resumeFrom and adds the connection to the
+// registry. The connection takes over the slot reserved by admit. If the endpoint started to shut down after the
+// client was admitted, the slot is freed and nil is returned, the client has to be sent away with goAway.
+func (wsc *Websocket) register(t transport, remoteAddr string, stats *compressionStats, access *accessToken, ip string, p protocol, s subscription, resumeFrom int64) *connection {
+	// holding the send lock makes sure that no broadcast is lost or sent twice between the backlog and registering
+	wsc.sendLock.Lock()
+	defer wsc.sendLock.Unlock()
+	backlog := wsc.replay.since(resumeFrom)
+	// the backlog must not count as falling behind
+	conn := newConnection(t, remoteAddr, stats, access, ip, p, wsc.config.MaxQueuedFrames+len(backlog), wsc.config)
+	conn.setSubscription(s)
+	for _, frame := range backlog {
+		if !s.wantsService(frame.EventInfo.Service) || !access.allowsService(frame.EventInfo.Service) {
+			continue
+		}
+		frame, filterErr := s.filter(frame)
+		if filterErr != nil {
+			log.Error(fmt.Sprint("Could not filter backlog for remote websocket ", conn, ". Sending unfiltered data."), filterErr, log.Websocket)
+		}
+		message, encodeErr := encodeEventData(frame, p)
+		if encodeErr != nil {
+			log.Error(fmt.Sprint("Could not encode backlog as ", p, "."), encodeErr, log.Websocket)
+			continue
+		}
+		conn.enqueue(message)
+	}
+	wsc.connectionsLock.Lock()
+	defer wsc.connectionsLock.Unlock()
+	wsc.pendingUpgrades--
+	if wsc.serverShuttingDown.Load() {
+		// the drain already took its snapshot of the registry, the connection would never be closed
+		wsc.decrementConnectionsPerIp(ip)
+		return nil
+	}
+	wsc.wsConnections[conn.id] = conn
+	return conn
 }
 
-func (wsc *Websocket) reader(conn *websocket.Conn) {
+func (wsc *Websocket) reader(conn *connection, wt *websocketTransport) {
 	for {
-		remoteAddr := conn.RemoteAddr().String()
-		if _, exists := wsc.wsConnections[remoteAddr]; !exists {
+		if !wsc.hasConnection(conn.id) {
 			return
 		}
 		// read in a message
-		_, p, err := conn.ReadMessage()
+		_, p, err := wt.ws.ReadMessage()
 		if err != nil {
-			log.Error("Could not read incomming message.", err, log.Websocket)
-			e := conn.Close()
-			if e != nil {
-				log.Error("Could not close websocket connection.", e, log.Websocket)
+			if netErr, isNetErr := err.(net.Error); isNetErr && netErr.Timeout() {
+				log.Info(fmt.Sprint("Remote websocket ", conn, " did not answer the heartbeat in time."), log.Websocket)
+			} else {
+				log.Error("Could not read incomming message.", err, log.Websocket)
 			}
-			log.Info(fmt.Sprint("Will delete websocket connection: ", remoteAddr), log.Websocket)
-			delete(wsc.wsConnections, remoteAddr)
+			wsc.removeConnection(conn)
 			return
 		}
+		wt.markAlive()
 
 		log.Debug(fmt.Sprint("Incomming message was:\n", string(p)), log.Websocket)
+		response, encodeErr := encodeControlMessage(wsc.handleControlMessage(conn, p))
+		if encodeErr != nil {
+			log.Error("Could not encode control message answer.", encodeErr, log.Websocket)
+			continue
+		}
+		if !conn.enqueue(response) {
+			log.Warn(fmt.Sprint("Could not answer control message of remote websocket ", conn, ". Its queue is full."), log.Websocket)
+		}
+	}
+}
+
+// connections returns a snapshot of the registry, so it can be iterated without holding the lock
+func (wsc *Websocket) connections() map[string]*connection {
+	wsc.connectionsLock.RLock()
+	defer wsc.connectionsLock.RUnlock()
+	wsConnections := make(map[string]*connection, len(wsc.wsConnections))
+	for id, wsConnection := range wsc.wsConnections {
+		wsConnections[id] = wsConnection
+	}
+	return wsConnections
+}
+
+func (wsc *Websocket) hasConnection(id string) bool {
+	wsc.connectionsLock.RLock()
+	defer wsc.connectionsLock.RUnlock()
+	_, exists := wsc.wsConnections[id]
+	return exists
+}
+
+func (wsc *Websocket) removeConnection(conn *connection) {
+	e := conn.close()
+	if e != nil {
+		log.Debug(fmt.Sprint("Could not close websocket connection. Error: ", e), log.Websocket)
+	}
+	wsc.connectionsLock.Lock()
+	defer wsc.connectionsLock.Unlock()
+	if wsc.wsConnections[conn.id] == conn {
+		log.Info(fmt.Sprint("Will delete websocket connection: ", conn), log.Websocket)
+		wsc.logCompressionStats(conn)
+		delete(wsc.wsConnections, conn.id)
+		wsc.decrementConnectionsPerIp(conn.ip)
+	}
+}
+
+func (wsc *Websocket) reportError(err error) {
+	select {
+	case wsc.errorChannel <- err:
+	default:
+		log.Warn(fmt.Sprint("Websocket error on ", wsc.config.EndpointPath, " was not consumed: ", err), log.Websocket)
 	}
 }
@@ -0,0 +1,129 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// within this directory: go test
+
+func newTestEndpoint(t *testing.T, config Config) (*Websocket, *httptest.Server) {
+	wsc := &Websocket{}
+	wsc.init(config)
+	mux := http.NewServeMux()
+	for path, handler := range wsc.handlers() {
+		mux.HandleFunc(path, handler)
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return wsc, server
+}
+
+func dialTestEndpoint(t *testing.T, server *httptest.Server, path string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + path
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("Could not dial %v. Error: %v", url, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func waitForConnections(t *testing.T, wsc *Websocket, expected int) {
+	deadline := time.Now().Add(2 * time.Second)
+	for wsc.GetActiveConnections() != expected {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected %v active connections on %v, Got: %v", expected, wsc.config.EndpointPath, wsc.GetActiveConnections())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestEndpointsKeepSeparateRegistries(t *testing.T) {
+	keeper, keeperServer := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10})
+	minerva, minervaServer := newTestEndpoint(t, Config{EndpointPath: "/minerva", MaxConnections: 10})
+
+	dialTestEndpoint(t, keeperServer, "/keeper")
+	dialTestEndpoint(t, keeperServer, "/keeper")
+	minervaConn := dialTestEndpoint(t, minervaServer, "/minerva")
+
+	waitForConnections(t, keeper, 2)
+	waitForConnections(t, minerva, 1)
+
+	minerva.SendDataInBulk(EventData{EventInfo: EventInfo{Service: "minerva"}})
+	var received EventData
+	minervaConn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := minervaConn.ReadJSON(&received); err != nil {
+		t.Fatalf("Could not read broadcast. Error: %v", err)
+	}
+	if received.EventInfo.Service != "minerva" {
+		t.Errorf("Broadcast service. Expected: %v, Got: %v", "minerva", received.EventInfo.Service)
+	}
+}
+
+func TestMaxConnectionsPerEndpoint(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/bloxberg", MaxConnections: 1})
+
+	dialTestEndpoint(t, server, "/bloxberg")
+	waitForConnections(t, wsc, 1)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/bloxberg"
+	if conn, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		conn.Close()
+		t.Errorf("Second connection should have been rejected.")
+	}
+	waitForConnections(t, wsc, 1)
+}
+
+func TestSlowConsumerIsDropped(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10, MaxQueuedFrames: 2})
+	dialTestEndpoint(t, server, "/keeper") // never reads
+	fastConn := dialTestEndpoint(t, server, "/keeper")
+	waitForConnections(t, wsc, 2)
+
+	// frames are big enough to fill the tcp buffers of the client that never reads
+	frame := EventData{Data: strings.Repeat("x", 256*1024), EventInfo: EventInfo{Service: "keeper"}}
+	received := make(chan struct{}, 200)
+	go func() {
+		var data EventData
+		for fastConn.ReadJSON(&data) == nil {
+			received <- struct{}{}
+		}
+	}()
+	for i := 0; i < 200 && wsc.GetSlowConsumerDrops() == 0; i++ {
+		wsc.SendDataInBulk(frame)
+		<-received
+	}
+
+	if wsc.GetSlowConsumerDrops() != 1 {
+		t.Errorf("Slow consumer drops. Expected: %v, Got: %v", 1, wsc.GetSlowConsumerDrops())
+	}
+	waitForConnections(t, wsc, 1)
+}
+
+func TestHeartbeatDropsUnresponsiveClient(t *testing.T) {
+	wsc, server := newTestEndpoint(t, Config{EndpointPath: "/keeper", MaxConnections: 10, MaxQueuedFrames: 2,
+		PingInterval: 50, PongTimeout: 100, IdleTimeout: 1000})
+	// a gorilla client only answers pings while it reads
+	dialTestEndpoint(t, server, "/keeper")
+	aliveConn := dialTestEndpoint(t, server, "/keeper")
+	go func() {
+		for {
+			if _, _, err := aliveConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	waitForConnections(t, wsc, 2)
+
+	waitForConnections(t, wsc, 1)
+	time.Sleep(300 * time.Millisecond)
+	if wsc.GetActiveConnections() != 1 {
+		t.Errorf("Client answering pings should stay connected. Expected: %v, Got: %v", 1, wsc.GetActiveConnections())
+	}
+}
@@ -0,0 +1,104 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketTransport writes to a gorilla websocket connection and detects dead peers with ping/pong. Gorilla
+// websocket connections support only one concurrent writer, which is the writer goroutine of the connection.
+type websocketTransport struct {
+	ws              *websocket.Conn
+	writeTimeout    time.Duration
+	pingInterval    time.Duration
+	pongTimeout     time.Duration
+	idleTimeout     time.Duration
+	compressionSize int // messages smaller than this are sent uncompressed
+	deadlineLock    sync.Mutex
+	readDeadline    time.Time
+}
+
+func newWebsocketTransport(ws *websocket.Conn, config Config) *websocketTransport {
+	wt := &websocketTransport{
+		ws:           ws,
+		writeTimeout: time.Duration(config.WriteTimeout) * time.Millisecond,
+		pingInterval: time.Duration(config.PingInterval) * time.Millisecond,
+		pongTimeout:  time.Duration(config.PongTimeout) * time.Millisecond,
+		idleTimeout:  time.Duration(config.IdleTimeout) * time.Millisecond,
+	}
+	if config.Compression.Enabled {
+		wt.compressionSize = config.Compression.MinSize
+		if config.Compression.Level != 0 {
+			wt.ws.SetCompressionLevel(config.Compression.Level)
+		}
+	}
+	wt.ws.SetPongHandler(func(string) error {
+		wt.markAlive()
+		return nil
+	})
+	wt.markAlive()
+	return wt
+}
+
+// markAlive is called whenever the client sent something. A client that sends nothing, not even pongs, within the
+// idle timeout is considered dead and its pending read fails.
+func (wt *websocketTransport) markAlive() {
+	wt.deadlineLock.Lock()
+	defer wt.deadlineLock.Unlock()
+	// without idle timeout this only lifts the pong deadline
+	wt.readDeadline = time.Time{}
+	if wt.idleTimeout > 0 {
+		wt.readDeadline = time.Now().Add(wt.idleTimeout)
+	}
+	wt.ws.SetReadDeadline(wt.readDeadline)
+}
+
+// expectPong shortens the read deadline after a ping, so a half-open connection is detected within the pong
+// timeout instead of the idle timeout
+func (wt *websocketTransport) expectPong() {
+	if wt.pongTimeout <= 0 {
+		return
+	}
+	wt.deadlineLock.Lock()
+	defer wt.deadlineLock.Unlock()
+	pongDeadline := time.Now().Add(wt.pongTimeout)
+	if wt.readDeadline.IsZero() || pongDeadline.Before(wt.readDeadline) {
+		wt.readDeadline = pongDeadline
+		wt.ws.SetReadDeadline(wt.readDeadline)
+	}
+}
+
+func (wt *websocketTransport) write(message outboundMessage) error {
+	if wt.writeTimeout > 0 {
+		wt.ws.SetWriteDeadline(time.Now().Add(wt.writeTimeout))
+	}
+	// only has an effect if the client negotiated permessage-deflate
+	wt.ws.EnableWriteCompression(len(message.data) >= wt.compressionSize)
+	return wt.ws.WriteMessage(message.messageType, message.data)
+}
+
+func (wt *websocketTransport) heartbeat() error {
+	if err := wt.ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(wt.controlWriteTimeout())); err != nil {
+		return err
+	}
+	wt.expectPong()
+	return nil
+}
+
+func (wt *websocketTransport) closeNormally(reason string) error {
+	closeNormalClosure := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
+	return wt.ws.WriteControl(websocket.CloseMessage, closeNormalClosure, time.Now().Add(time.Second))
+}
+
+func (wt *websocketTransport) close() error {
+	return wt.ws.Close()
+}
+
+func (wt *websocketTransport) controlWriteTimeout() time.Duration {
+	if wt.writeTimeout > 0 {
+		return wt.writeTimeout
+	}
+	return wt.pingInterval
+}
@@ -64,10 +64,48 @@ export interface KeeperWebsocketActivatedUsers {
     InstituteName: string,
 }
 
+export interface KeeperWebsocketFileDeletions {
+    ObjectType: string,
+    OperationSize: number,
+    Timestamp: number,
+    InstituteName: string,
+    Location: Location
+}
+
+export interface KeeperWebsocketRenames {
+    ObjectType: string,
+    OperationType: string,
+    OperationSize: number,
+    Timestamp: number,
+    InstituteName: string,
+    Location: Location
+}
+
+export interface KeeperWebsocketShares {
+    ShareType: string,
+    OperationSize: number,
+    Timestamp: number,
+    InstituteName: string,
+    Location: Location
+}
+
+export interface KeeperWebsocketFileDownloads {
+    DownloadType: string,
+    OperationSize: number,
+    Timestamp: number,
+    InstituteName: string,
+    Location: Location
+}
+
 export interface KeeperWebsocketData {
     FileCreationsAndEditings: KeeperWebsocketFileCreationsAndEditings[],
     LibraryCreations: KeeperWebsocketLibraryCreations[],
     ActivatedUsers: KeeperWebsocketActivatedUsers[],
+    // only sent if turned on in the keeper config of the service
+    FileDeletions?: KeeperWebsocketFileDeletions[],
+    Renames?: KeeperWebsocketRenames[],
+    Shares?: KeeperWebsocketShares[],
+    FileDownloads?: KeeperWebsocketFileDownloads[],
 }
 
 /******************************************